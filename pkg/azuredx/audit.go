@@ -0,0 +1,224 @@
+package azuredx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+// Outcomes of an audited query.
+const (
+	auditOutcomeSuccess  = "success"
+	auditOutcomePartial  = "partial"
+	auditOutcomeCanceled = "canceled"
+	auditOutcomeError    = "error"
+)
+
+// auditEntry is the audit record of one executed query. The query itself is not recorded, only a
+// hash of its interpolated text, so the log does not leak the values it filters on.
+type auditEntry struct {
+	Time          time.Time `json:"time"`
+	User          string    `json:"user"`
+	DatasourceUID string    `json:"datasourceUid"`
+	Cluster       string    `json:"cluster"`
+	Database      string    `json:"database"`
+	QueryHash     string    `json:"queryHash"`
+	QuerySource   string    `json:"querySource"`
+	DurationMs    int64     `json:"durationMs"`
+	Rows          int       `json:"rows"`
+	Outcome       string    `json:"outcome"`
+	ErrorSource   string    `json:"errorSource,omitempty"`
+}
+
+// auditLog writes one entry per executed query, either as JSON lines to a rotating file or to the
+// plugin logs. A nil auditLog records nothing.
+type auditLog struct {
+	datasourceUID string
+	// file is nil when the entries go to the plugin logs.
+	file *rotatingFile
+}
+
+// auditFiles holds the audit log files opened by the plugin, which are shared by all datasources
+// configured with the same path.
+var auditFiles = struct {
+	sync.Mutex
+	files map[string]*rotatingFile
+}{files: map[string]*rotatingFile{}}
+
+// newAuditLog returns the audit log of a datasource, or nil when its settings disable it.
+func newAuditLog(settings *models.DatasourceSettings, datasourceUID string) (*auditLog, error) {
+	if !settings.AuditLog {
+		return nil, nil
+	}
+	a := &auditLog{datasourceUID: datasourceUID}
+	if settings.AuditLogPath == "" {
+		return a, nil
+	}
+
+	auditFiles.Lock()
+	defer auditFiles.Unlock()
+	f, ok := auditFiles.files[settings.AuditLogPath]
+	if !ok {
+		var err error
+		f, err = openRotatingFile(settings.AuditLogPath, int64(settings.AuditLogMaxSizeMB)<<20, settings.AuditLogMaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open audit log: %w", err)
+		}
+		auditFiles.files[settings.AuditLogPath] = f
+	}
+	a.file = f
+	return a, nil
+}
+
+// recordQuery records a query that was sent to the cluster at e.Time, completing e with the
+// duration and outcome of the query.
+func (a *auditLog) recordQuery(ctx context.Context, e auditEntry, tableRes *models.TableResponse, resp backend.DataResponse, err error) {
+	if a == nil {
+		return
+	}
+	e.DurationMs = time.Since(e.Time).Milliseconds()
+	if err == nil {
+		err = resp.Error
+	}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		e.Outcome = auditOutcomeCanceled
+	case err != nil:
+		e.Outcome = auditOutcomeError
+		e.ErrorSource = string(helpers.ErrorSource(err))
+	case tableRes != nil && len(tableRes.Exceptions) > 0:
+		e.Outcome = auditOutcomePartial
+	default:
+		e.Outcome = auditOutcomeSuccess
+	}
+	for _, f := range resp.Frames {
+		e.Rows += f.Rows()
+	}
+	a.record(e)
+}
+
+func (a *auditLog) record(e auditEntry) {
+	if a == nil {
+		return
+	}
+	e.DatasourceUID = a.datasourceUID
+
+	if a.file == nil {
+		backend.Logger.Info("ADX query audit",
+			"user", e.User,
+			"datasourceUid", e.DatasourceUID,
+			"cluster", e.Cluster,
+			"database", e.Database,
+			"queryHash", e.QueryHash,
+			"querySource", e.QuerySource,
+			"durationMs", e.DurationMs,
+			"rows", e.Rows,
+			"outcome", e.Outcome,
+			"errorSource", e.ErrorSource,
+		)
+		return
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		backend.Logger.Error("failed to encode audit entry", "error", err.Error())
+		return
+	}
+	if _, err := a.file.Write(append(b, '\n')); err != nil {
+		backend.Logger.Error("failed to write audit entry", "error", err.Error())
+	}
+}
+
+// queryHash returns the hex encoded SHA-256 of a query, so audited queries can be matched against
+// known queries without storing them.
+func queryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// rotatingFile is an append-only file that is renamed to path.1 once it reaches maxSize, shifting
+// older files to path.2 and so on, and removing those past maxBackups.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating it first when p would make it exceed its maximum size.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.maxBackups == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f.open()
+	}
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(f.backup(i), f.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, f.backup(1)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
+
+var _ io.Writer = new(rotatingFile)
@@ -0,0 +1,155 @@
+package azuredx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+func readAuditEntries(t *testing.T, path string) []auditEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e auditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	t.Run("is disabled by default", func(t *testing.T) {
+		a, err := newAuditLog(&models.DatasourceSettings{}, "uid")
+		require.NoError(t, err)
+		require.Nil(t, a)
+		// a nil audit log records nothing
+		a.recordQuery(context.Background(), auditEntry{}, nil, backend.DataResponse{}, nil)
+	})
+
+	t.Run("records the outcome of queries", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		a, err := newAuditLog(&models.DatasourceSettings{AuditLog: true, AuditLogPath: path, AuditLogMaxSizeMB: 1}, "ds-uid")
+		require.NoError(t, err)
+
+		start := time.Now().Add(-time.Second)
+		ok := &models.TableResponse{}
+		partial := &models.TableResponse{Exceptions: []string{"Query execution has exceeded the allowed limits"}}
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		a.recordQuery(context.Background(), auditEntry{Time: start, User: "admin", Cluster: "help.kusto.windows.net", Database: "Samples", QueryHash: queryHash("StormEvents | take 10"), QuerySource: "raw"}, ok, backend.DataResponse{}, nil)
+		a.recordQuery(context.Background(), auditEntry{Time: start}, partial, backend.DataResponse{}, nil)
+		a.recordQuery(context.Background(), auditEntry{Time: start}, nil, backend.DataResponse{}, backend.DownstreamError(errors.New("bad request")))
+		a.recordQuery(canceled, auditEntry{Time: start}, nil, backend.DataResponse{}, context.Canceled)
+
+		entries := readAuditEntries(t, path)
+		require.Len(t, entries, 4)
+		require.Equal(t, "admin", entries[0].User)
+		require.Equal(t, "ds-uid", entries[0].DatasourceUID)
+		require.Equal(t, "help.kusto.windows.net", entries[0].Cluster)
+		require.Equal(t, "Samples", entries[0].Database)
+		require.Equal(t, queryHash("StormEvents | take 10"), entries[0].QueryHash)
+		require.Len(t, entries[0].QueryHash, 64)
+		require.GreaterOrEqual(t, entries[0].DurationMs, int64(1000))
+		require.Equal(t, auditOutcomeSuccess, entries[0].Outcome)
+		require.Equal(t, auditOutcomePartial, entries[1].Outcome)
+		require.Equal(t, auditOutcomeError, entries[2].Outcome)
+		require.Equal(t, string(backend.ErrorSourceDownstream), entries[2].ErrorSource)
+		require.Equal(t, auditOutcomeCanceled, entries[3].Outcome)
+	})
+
+	t.Run("datasources with the same path share the file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		settings := &models.DatasourceSettings{AuditLog: true, AuditLogPath: path, AuditLogMaxSizeMB: 1}
+		first, err := newAuditLog(settings, "first")
+		require.NoError(t, err)
+		second, err := newAuditLog(settings, "second")
+		require.NoError(t, err)
+		require.Same(t, first.file, second.file)
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := openRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	read := func(name string) string {
+		b, err := os.ReadFile(name)
+		require.NoError(t, err)
+		return string(b)
+	}
+	require.Equal(t, "fourth\n", read(path))
+	require.Equal(t, "third\n", read(path+".1"))
+	require.Equal(t, "second\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err))
+
+	t.Run("without backups the file is truncated", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		f, err := openRotatingFile(path, 10, 0)
+		require.NoError(t, err)
+		for _, line := range []string{"first\n", "second\n"} {
+			_, err := f.Write([]byte(line))
+			require.NoError(t, err)
+		}
+		require.Equal(t, "second\n", read(path))
+		_, err = os.Stat(path + ".1")
+		require.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestAuditedQueries(t *testing.T) {
+	kustoRequestMock = func(_ string, _ string, _ models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+		return &models.TableResponse{
+			Tables: []models.Table{
+				{TableName: "PrimaryResult", TableKind: models.TableKindPrimaryResult, Columns: []models.Column{{ColumnName: "Count", ColumnType: "long"}}, Rows: []models.Row{[]interface{}{json.Number("1")}, []interface{}{json.Number("2")}}},
+			},
+		}, nil
+	}
+	path := filepath.Join(t.TempDir(), "audit.log")
+	settings := &models.DatasourceSettings{ClusterURL: "https://help.kusto.windows.net", DefaultDatabase: "Samples", AuditLog: true, AuditLogPath: path}
+	audit, err := newAuditLog(settings, "ds-uid")
+	require.NoError(t, err)
+	adx := &AzureDataExplorer{client: &fakeClient{}, settings: settings, audit: audit}
+
+	res := adx.handleQuery(context.Background(), backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: time.Unix(0, 0), To: time.Unix(3600, 0)},
+		JSON:      []byte(`{"resultFormat": "table","querySource": "raw","query": "StormEvents | where $__timeFilter() | count"}`),
+	}, &backend.User{Login: "admin"})
+	require.NoError(t, res.Error)
+
+	entries := readAuditEntries(t, path)
+	require.Len(t, entries, 1)
+	require.Equal(t, "admin", entries[0].User)
+	require.Equal(t, "ds-uid", entries[0].DatasourceUID)
+	require.Equal(t, "help.kusto.windows.net", entries[0].Cluster)
+	require.Equal(t, "Samples", entries[0].Database)
+	require.Equal(t, "raw", entries[0].QuerySource)
+	require.Equal(t, 2, entries[0].Rows)
+	require.Equal(t, auditOutcomeSuccess, entries[0].Outcome)
+	// the hash is of the interpolated query, as sent to the cluster
+	require.NotEqual(t, queryHash("StormEvents | where $__timeFilter() | count"), entries[0].QueryHash)
+}
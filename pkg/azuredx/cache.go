@@ -0,0 +1,115 @@
+package azuredx
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+// queryCache is a least recently used cache of query results. Every entry expires after the
+// cache max age that was worked out for its query.
+type queryCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+}
+
+type queryCacheEntry struct {
+	key     string
+	result  *models.TableResponse
+	expires time.Time
+}
+
+func newQueryCache(size int) *queryCache {
+	return &queryCache{
+		size:    size,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// get returns the cached result for key, unless it is missing or expired.
+func (c *queryCache) get(key string) (*models.TableResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if ok && c.now().After(el.Value.(*queryCacheEntry).expires) {
+		c.remove(el)
+		ok = false
+	}
+	if !ok {
+		queryCacheMisses.Inc()
+		return nil, false
+	}
+
+	queryCacheHits.Inc()
+	c.order.MoveToFront(el)
+	return el.Value.(*queryCacheEntry).result, true
+}
+
+// set caches result for key until ttl has passed, evicting the least recently used entry when
+// the cache is full.
+func (c *queryCache) set(key string, result *models.TableResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*queryCacheEntry)
+		entry.result = result
+		entry.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&queryCacheEntry{key: key, result: result, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *queryCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*queryCacheEntry).key)
+}
+
+// queryResultKey identifies the results of a query, both in the query cache and among the requests
+// in flight. The user is only part of the key when the datasource authenticates as the user, as the
+// results may then differ between users.
+func queryResultKey(cluster string, payload models.RequestPayload, tr *backend.TimeRange, user string) (string, error) {
+	key := struct {
+		Cluster    string
+		Database   string
+		Query      string
+		From, To   time.Time
+		Properties *models.Properties
+		User       string
+	}{
+		Cluster:    cluster,
+		Database:   payload.DB,
+		Query:      payload.CSL,
+		Properties: payload.Properties,
+		User:       user,
+	}
+	if tr != nil {
+		key.From, key.To = tr.From.UTC(), tr.To.UTC()
+	}
+
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
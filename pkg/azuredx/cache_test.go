@@ -0,0 +1,190 @@
+package azuredx
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+func TestQueryCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newCache := func(size int) *queryCache {
+		c := newQueryCache(size)
+		c.now = func() time.Time { return now }
+		return c
+	}
+	result := func(name string) *models.TableResponse {
+		return &models.TableResponse{Tables: []models.Table{{TableName: name}}}
+	}
+
+	t.Run("returns cached results until they expire", func(t *testing.T) {
+		c := newCache(2)
+		c.set("a", result("a"), time.Minute)
+
+		res, ok := c.get("a")
+		require.True(t, ok)
+		require.Equal(t, "a", res.Tables[0].TableName)
+
+		now = now.Add(2 * time.Minute)
+		_, ok = c.get("a")
+		require.False(t, ok)
+		require.Empty(t, c.entries)
+	})
+
+	t.Run("evicts the least recently used result", func(t *testing.T) {
+		c := newCache(2)
+		c.set("a", result("a"), time.Minute)
+		c.set("b", result("b"), time.Minute)
+		_, ok := c.get("a")
+		require.True(t, ok)
+
+		c.set("c", result("c"), time.Minute)
+		_, ok = c.get("b")
+		require.False(t, ok)
+		_, ok = c.get("a")
+		require.True(t, ok)
+		_, ok = c.get("c")
+		require.True(t, ok)
+	})
+
+	t.Run("replaces the result of an existing key", func(t *testing.T) {
+		c := newCache(2)
+		c.set("a", result("old"), time.Minute)
+		c.set("a", result("new"), time.Minute)
+
+		res, ok := c.get("a")
+		require.True(t, ok)
+		require.Equal(t, "new", res.Tables[0].TableName)
+		require.Equal(t, 1, c.order.Len())
+	})
+}
+
+func TestQueryResultKey(t *testing.T) {
+	tr := &backend.TimeRange{From: time.Unix(0, 0), To: time.Unix(3600, 0)}
+	payload := models.RequestPayload{
+		DB:  "db",
+		CSL: "T | take 10",
+		Properties: &models.Properties{
+			Parameters: map[string]string{"a": "long(1)", "b": "long(2)", "c": "long(3)"},
+		},
+	}
+	key, err := queryResultKey("https://cluster", payload, tr, "")
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		again, err := queryResultKey("https://cluster", payload, tr, "")
+		require.NoError(t, err)
+		require.Equal(t, key, again)
+	}
+
+	other := payload
+	other.CSL = "T | take 11"
+	otherKey, err := queryResultKey("https://cluster", other, tr, "")
+	require.NoError(t, err)
+	require.NotEqual(t, key, otherKey)
+
+	userKey, err := queryResultKey("https://cluster", payload, tr, "user")
+	require.NoError(t, err)
+	require.NotEqual(t, key, userKey)
+
+	laterKey, err := queryResultKey("https://cluster", payload, &backend.TimeRange{From: tr.From, To: tr.To.Add(time.Minute)}, "")
+	require.NoError(t, err)
+	require.NotEqual(t, key, laterKey)
+}
+
+func TestCachedQueries(t *testing.T) {
+	var requests int
+	countRequests := func(_ string, _ string, _ models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+		requests++
+		return &models.TableResponse{
+			Tables: []models.Table{
+				{TableName: "PrimaryResult", TableKind: models.TableKindPrimaryResult, Columns: []models.Column{{ColumnName: "Count", ColumnType: "long"}}, Rows: []models.Row{[]interface{}{json.Number("1")}}},
+			},
+		}, nil
+	}
+	kustoRequestMock = countRequests
+	newADX := func(cacheMaxAge string) *AzureDataExplorer {
+		return &AzureDataExplorer{
+			client:   &fakeClient{},
+			settings: &models.DatasourceSettings{ClusterURL: "base-url", DefaultDatabase: "db", CacheMaxAge: cacheMaxAge},
+			cache:    newQueryCache(models.DefaultQueryCacheSize),
+		}
+	}
+	query := backend.DataQuery{
+		RefID:     "A",
+		TimeRange: backend.TimeRange{From: time.Unix(0, 0), To: time.Unix(3600, 0)},
+		JSON:      []byte(`{"resultFormat": "table","querySource": "raw","query": "T | count"}`),
+	}
+
+	t.Run("identical queries are answered from the cache", func(t *testing.T) {
+		requests = 0
+		adx := newADX("5m")
+		for i := 0; i < 3; i++ {
+			res := adx.handleQuery(context.Background(), query, &backend.User{Login: "user"})
+			require.NoError(t, res.Error)
+			require.Len(t, res.Frames, 1)
+			require.Equal(t, 1, res.Frames[0].Rows())
+		}
+		require.Equal(t, 1, requests)
+	})
+
+	t.Run("queries are not cached without a cache max age", func(t *testing.T) {
+		requests = 0
+		adx := newADX("")
+		for i := 0; i < 3; i++ {
+			res := adx.handleQuery(context.Background(), query, &backend.User{Login: "user"})
+			require.NoError(t, res.Error)
+		}
+		require.Equal(t, 3, requests)
+	})
+
+	t.Run("identical queries in flight are sent once", func(t *testing.T) {
+		requests = 0
+		release := make(chan struct{})
+		started := make(chan struct{}, 1)
+		kustoRequestMock = func(_ string, _ string, _ models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			requests++
+			started <- struct{}{}
+			<-release
+			return &models.TableResponse{Tables: []models.Table{{TableName: "PrimaryResult", TableKind: models.TableKindPrimaryResult}}}, nil
+		}
+		defer func() { kustoRequestMock = countRequests }()
+
+		adx := newADX("")
+		first := make(chan backend.DataResponse)
+		go func() { first <- adx.handleQuery(context.Background(), query, &backend.User{Login: "first"}) }()
+		<-started
+		second := make(chan backend.DataResponse)
+		go func() { second <- adx.handleQuery(context.Background(), query, &backend.User{Login: "second"}) }()
+		require.Eventually(t, func() bool {
+			adx.inflight.mu.Lock()
+			defer adx.inflight.mu.Unlock()
+			for _, c := range adx.inflight.calls {
+				return c.waiters == 2
+			}
+			return false
+		}, time.Second, time.Millisecond)
+		close(release)
+
+		require.NoError(t, (<-first).Error)
+		require.NoError(t, (<-second).Error)
+		require.Equal(t, 1, requests)
+	})
+
+	t.Run("results are not shared between users when authenticating as the user", func(t *testing.T) {
+		requests = 0
+		adx := newADX("5m")
+		adx.userResults = true
+		for _, login := range []string{"first", "second", "first"} {
+			res := adx.handleQuery(context.Background(), query, &backend.User{Login: login})
+			require.NoError(t, res.Error)
+		}
+		require.Equal(t, 2, requests)
+	})
+}
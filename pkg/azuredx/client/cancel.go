@@ -0,0 +1,89 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	// 100% compatible drop-in replacement of "encoding/json"
+	json "github.com/json-iterator/go"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+// cancelQueryTimeout bounds how long the cancellation of an aborted query may take.
+const cancelQueryTimeout = 10 * time.Second
+
+// cancelIfAborted cancels the query sent with clientRequestID on the cluster when ctx was cancelled
+// while the query ran, as the cluster keeps running a query when its connection is dropped. The
+// cancellation is best-effort and runs in the background.
+func (c *Client) cancelIfAborted(ctx context.Context, clusterURL string, path string, database string, clientRequestID string, application string) {
+	if ctx.Err() == nil || path == ManagementV1Path {
+		return
+	}
+	// keep the values of ctx, such as the current user, which are needed to authenticate
+	cancelCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cancelQueryTimeout)
+	go func() {
+		defer cancel()
+		if err := c.cancelQuery(cancelCtx, clusterURL, database, clientRequestID, application); err != nil {
+			backend.Logger.Warn("failed to cancel aborted query", "clientRequestId", clientRequestID, "error", err.Error())
+			return
+		}
+		backend.Logger.Debug("cancelled aborted query", "clientRequestId", clientRequestID)
+	}()
+}
+
+// cancelQuery sends a .cancel query management command for the query sent with clientRequestID, as
+// the same application as the query.
+// https://learn.microsoft.com/en-us/kusto/management/cancel-query-command
+func (c *Client) cancelQuery(ctx context.Context, clusterURL string, database string, clientRequestID string, application string) error {
+	buf, err := json.Marshal(models.RequestPayload{
+		DB:  database,
+		CSL: ".cancel query " + quoteCSLString(clientRequestID),
+	})
+	if err != nil {
+		return err
+	}
+
+	fullURL, err := url.JoinPath(clusterURL, ManagementV1Path)
+	if err != nil {
+		return fmt.Errorf("invalid Azure request URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fullURL, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-ms-app", application)
+
+	resp, err := c.httpClientKusto.Do(req)
+	if err != nil {
+		return err
+	}
+	defer helpers.HandleResponseBodyClose(resp)
+
+	if resp.StatusCode/100 != 2 {
+		var r models.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			return fmt.Errorf("azure HTTP %q", resp.Status)
+		}
+		return fmt.Errorf("azure HTTP %q: %q", resp.Status, r.Error.Message)
+	}
+	return nil
+}
+
+// quoteCSLString returns s as a double quoted Kusto string literal.
+func quoteCSLString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
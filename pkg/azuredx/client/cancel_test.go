@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+func TestCancelAbortedQuery(t *testing.T) {
+	type cancellation struct {
+		payload     models.RequestPayload
+		application string
+	}
+
+	newServer := func(t *testing.T, cancellations chan<- cancellation, queryStarted chan<- string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			var payload models.RequestPayload
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+			if req.URL.Path == ManagementV1Path {
+				cancellations <- cancellation{payload: payload, application: req.Header.Get("x-ms-app")}
+				rw.WriteHeader(http.StatusOK)
+				_, _ = rw.Write([]byte(`{"Tables": [{"TableName": "Table_0", "Columns": [], "Rows": []}]}`))
+				return
+			}
+			queryStarted <- req.Header.Get("x-ms-client-request-id")
+			// keep the query running until the client goes away
+			<-req.Context().Done()
+		}))
+	}
+
+	t.Run("an aborted query is cancelled on the cluster", func(t *testing.T) {
+		cancellations := make(chan cancellation, 1)
+		queryStarted := make(chan string, 1)
+		server := newServer(t, cancellations, queryStarted)
+		defer server.Close()
+
+		client := &Client{httpClientKusto: server.Client()}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			_, err := client.KustoRequest(ctx, server.URL, QueryV2Path, models.RequestPayload{DB: "db-name", CSL: "T | take 10", QuerySource: "raw"}, false, "my-app")
+			done <- err
+		}()
+
+		clientRequestID := <-queryStarted
+		cancel()
+		require.Error(t, <-done)
+
+		select {
+		case c := <-cancellations:
+			require.Equal(t, "db-name", c.payload.DB)
+			require.Equal(t, `.cancel query "`+clientRequestID+`"`, c.payload.CSL)
+			require.Equal(t, "my-app", c.application)
+		case <-time.After(5 * time.Second):
+			t.Fatal("query was not cancelled")
+		}
+	})
+
+	t.Run("a failed query is not cancelled", func(t *testing.T) {
+		cancellations := make(chan models.RequestPayload, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == ManagementV1Path {
+				cancellations <- models.RequestPayload{}
+			}
+			rw.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		client := &Client{httpClientKusto: server.Client()}
+		_, err := client.KustoRequest(context.Background(), server.URL, QueryV2Path, models.RequestPayload{CSL: "T | take 10"}, false, "Grafana-ADX")
+		require.Error(t, err)
+
+		select {
+		case <-cancellations:
+			t.Fatal("failed query must not be cancelled")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
+
+func TestQuoteCSLString(t *testing.T) {
+	require.Equal(t, `"KGC.raw;1f"`, quoteCSLString("KGC.raw;1f"))
+	require.Equal(t, `"KGC.raw;1f;a\"b\\c"`, quoteCSLString(`KGC.raw;1f;a"b\c`))
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/grafana/grafana-azure-sdk-go/v2/azsettings"
 	"github.com/grafana/grafana-azure-sdk-go/v2/azusercontext"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"go.opentelemetry.io/otel/propagation"
 
 	// 100% compatible drop-in replacement of "encoding/json"
 	json "github.com/json-iterator/go"
@@ -22,6 +23,13 @@ import (
 	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
 )
 
+// Paths of Azure Data Explorer's REST API.
+const (
+	QueryV1Path      = "/v1/rest/query"
+	QueryV2Path      = "/v2/rest/query"
+	ManagementV1Path = "/v1/rest/mgmt"
+)
+
 type AdxClient interface {
 	TestKustoRequest(ctx context.Context, datasourceSettings *models.DatasourceSettings, properties *models.Properties, additionalHeaders map[string]string) error
 	TestARGsRequest(ctx context.Context, datasourceSettings *models.DatasourceSettings, properties *models.Properties, additionalHeaders map[string]string) error
@@ -36,6 +44,9 @@ type Client struct {
 	httpClientKusto      *http.Client
 	httpClientManagement *http.Client
 	cloudSettings        *azsettings.AzureCloudSettings
+	retry                retryPolicy
+	// clusterURL is the cluster configured in the datasource, the only one labelling metrics
+	clusterURL string
 }
 
 // NewClient creates a Grafana Plugin SDK Go Http Client
@@ -59,7 +70,13 @@ func New(ctx context.Context, instanceSettings *backend.DataSourceInstanceSettin
 	if err != nil {
 		return nil, err
 	}
-	return &Client{httpClientKusto: httpClientAzureCloud, httpClientManagement: httpClientManagement, cloudSettings: cloudSettings}, nil
+	return &Client{
+		httpClientKusto:      httpClientAzureCloud,
+		httpClientManagement: httpClientManagement,
+		cloudSettings:        cloudSettings,
+		retry:                newRetryPolicy(dsSettings.QueryTimeout),
+		clusterURL:           dsSettings.ClusterURL,
+	}, nil
 }
 
 func (c *Client) TestARGsRequest(ctx context.Context, datasourceSettings *models.DatasourceSettings, properties *models.Properties, additionalHeaders map[string]string) error {
@@ -110,7 +127,7 @@ func (c *Client) testKustoClient(ctx context.Context, datasourceSettings *models
 		return err
 	}
 
-	fullUrl, err := url.JoinPath(clusterURL, "/v1/rest/query")
+	fullUrl, err := url.JoinPath(clusterURL, QueryV1Path)
 	if err != nil {
 		return fmt.Errorf("invalid Azure request URL: %w", err)
 	}
@@ -192,10 +209,25 @@ func (c *Client) testManagementClient(ctx context.Context, _ *models.DatasourceS
 	return nil
 }
 
-// KustoRequest executes a Kusto Query language request to Azure's Data Explorer V1 REST API
-// and returns a TableResponse. If there is a query syntax error, the error message inside
-// the API's JSON error response is returned as well (if available).
-func (c *Client) KustoRequest(ctx context.Context, clusterUrl string, path string, payload models.RequestPayload, userTrackingEnabled bool, application string) (*models.TableResponse, error) {
+// KustoRequest executes a Kusto Query language request to Azure's Data Explorer V1 or V2 REST API,
+// depending on the path, and returns a TableResponse. If there is a query syntax error, the error
+// message inside the API's JSON error response is returned as well (if available).
+func (c *Client) KustoRequest(ctx context.Context, clusterUrl string, path string, payload models.RequestPayload, userTrackingEnabled bool, application string) (table *models.TableResponse, err error) {
+	if payload.QuerySource == "" {
+		payload.QuerySource = "unspecified"
+	}
+	metrics := newRequestMetrics(helpers.MetricsCluster(clusterUrl, c.clusterURL), path, payload.QuerySource)
+	ctx, span := helpers.StartSpan(ctx, "adx.kustoRequest",
+		helpers.AttributeCluster.String(helpers.ClusterHost(clusterUrl)),
+		helpers.AttributeDatabase.String(payload.DB),
+		helpers.AttributeQuerySource.String(payload.QuerySource),
+		helpers.AttributeEndpoint.String(metrics.endpoint),
+	)
+	defer func() {
+		metrics.observe(ctx, table != nil && len(table.Exceptions) > 0, err)
+		helpers.EndSpan(span, err)
+	}()
+
 	buf, err := json.Marshal(payload)
 	if err != nil {
 		return nil, backend.DownstreamError(fmt.Errorf("no Azure request serial: %w", err))
@@ -218,9 +250,6 @@ func (c *Client) KustoRequest(ctx context.Context, clusterUrl string, path strin
 	}
 	req.Header.Set("x-ms-app", application)
 	// req.Header.Set("x-ms-app", "Grafana-ADX")
-	if payload.QuerySource == "" {
-		payload.QuerySource = "unspecified"
-	}
 
 	msClientRequestIDHeader := fmt.Sprintf("KGC.%s;%x", payload.QuerySource, rand.Uint64())
 	user, ok := azusercontext.GetCurrentUser(ctx)
@@ -230,13 +259,21 @@ func (c *Client) KustoRequest(ctx context.Context, clusterUrl string, path strin
 		req.Header.Set("x-ms-user-id", login)
 	}
 	req.Header.Set("x-ms-client-request-id", msClientRequestIDHeader)
+	span.SetAttributes(helpers.AttributeClientRequestID.String(msClientRequestIDHeader))
+	// the cluster accepts a W3C trace context, so its own traces can be correlated with ours
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-	resp, err := c.httpClientKusto.Do(req)
+	// queries only read, but management commands may change the cluster
+	idempotent := path != ManagementV1Path || isManagementRead(payload.CSL)
+	resp, err := c.retry.do(c.httpClientKusto, req, idempotent, metrics)
 	if err != nil {
+		c.cancelIfAborted(ctx, clusterUrl, path, payload.DB, msClientRequestIDHeader, application)
 		return nil, backend.DownstreamError(err)
 	}
 
 	defer helpers.HandleResponseBodyClose(resp)
+	resp.Body = metrics.countBody(resp.Body)
+	span.SetAttributes(helpers.AttributeStatusCode.Int(resp.StatusCode))
 
 	switch {
 	case resp.StatusCode == http.StatusUnauthorized:
@@ -249,13 +286,29 @@ func (c *Client) KustoRequest(ctx context.Context, clusterUrl string, path strin
 		if err != nil {
 			return nil, backend.DownstreamError(fmt.Errorf("azure HTTP %q with malformed error response: %s", resp.Status, err))
 		}
-		return nil, backend.NewErrorWithSource(fmt.Errorf("azure HTTP %q: %q.\nReceived %q: %q", resp.Status, r.Error.Message, r.Error.Type, r.Error.Description), backend.ErrorSourceFromHTTPStatus(resp.StatusCode))
+		return nil, backend.NewErrorWithSource(models.NewKustoError(resp.StatusCode, resp.Status, r), backend.ErrorSourceFromHTTPStatus(resp.StatusCode))
 	}
 
-	return models.TableFromJSON(resp.Body)
+	_, decodeSpan := helpers.StartSpan(ctx, "adx.decode", helpers.AttributeClientRequestID.String(msClientRequestIDHeader))
+	if path == QueryV2Path {
+		table, err = models.TableFromV2JSON(resp.Body)
+	} else {
+		table, err = models.TableFromJSON(resp.Body)
+	}
+	if table != nil {
+		rows := table.RowCount()
+		decodeSpan.SetAttributes(helpers.AttributeRows.Int(rows))
+		span.SetAttributes(helpers.AttributeRows.Int(rows))
+	}
+	helpers.EndSpan(decodeSpan, err)
+	if err != nil {
+		// the body of a v2 response streams while the query runs, so it can be aborted while decoding
+		c.cancelIfAborted(ctx, clusterUrl, path, payload.DB, msClientRequestIDHeader, application)
+	}
+	return table, err
 }
 
-func (c *Client) ARGClusterRequest(ctx context.Context, payload models.ARGRequestPayload, additionalHeaders map[string]string) ([]models.ClusterOption, error) {
+func (c *Client) ARGClusterRequest(ctx context.Context, payload models.ARGRequestPayload, additionalHeaders map[string]string) (clusterOptions []models.ClusterOption, err error) {
 	buf, err := json.Marshal(payload)
 	if err != nil {
 		return nil, backend.DownstreamError(fmt.Errorf("no Azure request serial: %w", err))
@@ -278,6 +331,12 @@ func (c *Client) ARGClusterRequest(ctx context.Context, payload models.ARGReques
 	params.Add("api-version", "2021-03-01")
 	u.RawQuery = params.Encode()
 
+	// the resource manager comes from the cloud settings, so its host is one of a few
+	metrics := newRequestMetrics(helpers.ClusterHost(resourceManager), u.Path, "arg")
+	defer func() {
+		metrics.observe(ctx, false, err)
+	}()
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(buf))
 	if err != nil {
 		return nil, fmt.Errorf("no Azure request instance: %w", err)
@@ -291,12 +350,13 @@ func (c *Client) ARGClusterRequest(ctx context.Context, payload models.ARGReques
 		req.Header.Set(key, value)
 	}
 
-	resp, err := c.httpClientManagement.Do(req)
+	resp, err := c.retry.do(c.httpClientManagement, req, true, metrics)
 	if err != nil {
 		return nil, backend.DownstreamError(err)
 	}
 
 	defer helpers.HandleResponseBodyClose(resp)
+	resp.Body = metrics.countBody(resp.Body)
 
 	switch {
 	case resp.StatusCode == http.StatusUnauthorized:
@@ -309,7 +369,7 @@ func (c *Client) ARGClusterRequest(ctx context.Context, payload models.ARGReques
 		if err != nil {
 			return nil, backend.DownstreamError(fmt.Errorf("azure HTTP %q with malformed error response: %s", resp.Status, err))
 		}
-		return nil, backend.NewErrorWithSource(fmt.Errorf("azure HTTP %q: %q", resp.Status, r.Error.Message), backend.ErrorSourceFromHTTPStatus(resp.StatusCode))
+		return nil, backend.NewErrorWithSource(models.NewKustoError(resp.StatusCode, resp.Status, r), backend.ErrorSourceFromHTTPStatus(resp.StatusCode))
 	}
 	var clusterData struct {
 		Data []struct {
@@ -330,7 +390,7 @@ func (c *Client) ARGClusterRequest(ctx context.Context, payload models.ARGReques
 		return nil, err
 	}
 
-	clusterOptions := []models.ClusterOption{}
+	clusterOptions = []models.ClusterOption{}
 	for _, v := range clusterData.Data {
 		if v.Properties.State != "Running" {
 			continue
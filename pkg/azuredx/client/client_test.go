@@ -42,6 +42,35 @@ func TestClient(t *testing.T) {
 		require.NotNil(t, table)
 	})
 
+	t.Run("When server returns 200 for a v2 query", func(t *testing.T) {
+		filename := "./testdata/successful-v2-response.json"
+		testDataRes, err := loadTestFile(filename)
+		if err != nil {
+			t.Errorf("test logic error: file doesn't exist: %s", filename)
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			require.Equal(t, QueryV2Path, req.URL.Path)
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write(testDataRes)
+			if err != nil {
+				t.Errorf("test logic error: %s", err.Error())
+			}
+		}))
+		defer server.Close()
+
+		payload := models.RequestPayload{
+			DB:          "db-name",
+			CSL:         "print XBool = true",
+			QuerySource: "raw",
+		}
+
+		client := &Client{httpClientKusto: server.Client()}
+		table, err := client.KustoRequest(context.Background(), server.URL, QueryV2Path, payload, false, "Grafana-ADX")
+		require.NoError(t, err)
+		require.Len(t, table.Tables, 3)
+		require.Equal(t, models.TableKindPrimaryResult, table.Tables[1].TableKind)
+	})
+
 	t.Run("When server returns 400", func(t *testing.T) {
 		filename := "./testdata/error-response.json"
 		testDataRes, err := loadTestFile(filename)
@@ -68,6 +97,14 @@ func TestClient(t *testing.T) {
 		require.Nil(t, table)
 		require.NotNil(t, err)
 		require.Contains(t, err.Error(), "Request is invalid and cannot be processed: Syntax error: SYN0002: A recognition error occurred. [line:position=1:9]. Query: 'PerfTest take 5'")
+
+		var kustoErr *models.KustoError
+		require.ErrorAs(t, err, &kustoErr)
+		require.Equal(t, http.StatusBadRequest, kustoErr.StatusCode)
+		require.Equal(t, 1, kustoErr.Line)
+		require.Equal(t, 9, kustoErr.Position)
+		require.True(t, kustoErr.Permanent)
+		require.True(t, backend.IsDownstreamError(err))
 	})
 
 	t.Run("Headers are set - excluding tracking headers", func(t *testing.T) {
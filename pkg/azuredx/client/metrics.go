@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
+)
+
+const metricsNamespace = "grafana_plugin_adx"
+
+// Values of the endpoint label.
+const (
+	endpointQuery      = "query"
+	endpointManagement = "mgmt"
+	endpointARG        = "arg"
+)
+
+// Values of the outcome label.
+const (
+	outcomeSuccess  = "success"
+	outcomePartial  = "partial"
+	outcomeCanceled = "canceled"
+	outcomeError    = "error"
+)
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "request_duration_seconds",
+		Help:      "Duration of requests to Azure Data Explorer clusters and Azure Resource Graph, including retries and decoding.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"cluster", "endpoint", "source", "wire_format", "outcome"})
+	responseBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "response_bytes",
+		Help:      "Size of the response bodies read from Azure Data Explorer clusters and Azure Resource Graph.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+	}, []string{"cluster", "endpoint", "source", "wire_format"})
+	requestRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "request_retries_total",
+		Help:      "Number of requests sent again after a throttled or transient failure.",
+	}, []string{"cluster", "endpoint"})
+	requestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "request_errors_total",
+		Help:      "Number of failed requests by the source of the error.",
+	}, []string{"cluster", "endpoint", "source", "error_source"})
+)
+
+// requestMetrics holds the labels of one request. The cluster and source labels are already mapped
+// to a bounded set, see helpers.MetricsCluster and helpers.MetricsSource.
+type requestMetrics struct {
+	start    time.Time
+	cluster  string
+	endpoint string
+	source   string
+	// wireFormat is the format of the response, v1 or v2 for clusters, rather than the result format
+	// of the query.
+	wireFormat string
+	body       *countingReader
+}
+
+func newRequestMetrics(cluster string, path string, source string) *requestMetrics {
+	m := &requestMetrics{
+		start:    time.Now(),
+		cluster:  cluster,
+		endpoint: endpointLabel(path),
+		source:   helpers.MetricsSource(source),
+	}
+	switch path {
+	case QueryV1Path, ManagementV1Path:
+		m.wireFormat = "v1"
+	case QueryV2Path:
+		m.wireFormat = "v2"
+	default:
+		m.wireFormat = "json"
+	}
+	return m
+}
+
+// countBody makes the metrics count the bytes read from body, which it returns wrapped.
+func (m *requestMetrics) countBody(body io.ReadCloser) io.ReadCloser {
+	m.body = &countingReader{ReadCloser: body}
+	return m.body
+}
+
+// observe records a finished request. partial is set when the response held query exceptions.
+func (m *requestMetrics) observe(ctx context.Context, partial bool, err error) {
+	outcome := outcomeSuccess
+	switch {
+	case err != nil && ctx.Err() != nil:
+		outcome = outcomeCanceled
+	case err != nil:
+		outcome = outcomeError
+		requestErrors.WithLabelValues(m.cluster, m.endpoint, m.source, string(helpers.ErrorSource(err))).Inc()
+	case partial:
+		outcome = outcomePartial
+	}
+	requestDuration.WithLabelValues(m.cluster, m.endpoint, m.source, m.wireFormat, outcome).Observe(time.Since(m.start).Seconds())
+	if m.body != nil {
+		responseBytes.WithLabelValues(m.cluster, m.endpoint, m.source, m.wireFormat).Observe(float64(m.body.n))
+	}
+}
+
+// retried records that the request is sent again.
+func (m *requestMetrics) retried() {
+	requestRetries.WithLabelValues(m.cluster, m.endpoint).Inc()
+}
+
+// endpointLabel returns the endpoint label of a request path.
+func endpointLabel(path string) string {
+	switch {
+	case strings.HasSuffix(path, ManagementV1Path):
+		return endpointManagement
+	case strings.HasSuffix(path, QueryV1Path), strings.HasSuffix(path, QueryV2Path):
+		return endpointQuery
+	}
+	return endpointARG
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
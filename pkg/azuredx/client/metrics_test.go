@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	body, err := os.ReadFile("./testdata/successful-v2-response.json")
+	require.NoError(t, err)
+
+	t.Run("a successful query records its duration and response size", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			_, _ = rw.Write(body)
+		}))
+		defer server.Close()
+		cluster := helpers.ClusterHost(server.URL)
+
+		// every new combination of labels adds a series
+		durations, sizes := testutil.CollectAndCount(requestDuration), testutil.CollectAndCount(responseBytes)
+
+		client := &Client{httpClientKusto: server.Client(), clusterURL: server.URL}
+		_, err := client.KustoRequest(context.Background(), server.URL, QueryV2Path, models.RequestPayload{CSL: "T", QuerySource: "visual"}, false, "")
+		require.NoError(t, err)
+
+		require.Equal(t, durations+1, testutil.CollectAndCount(requestDuration))
+		require.Equal(t, sizes+1, testutil.CollectAndCount(responseBytes))
+		require.Equal(t, float64(0), testutil.ToFloat64(requestErrors.WithLabelValues(cluster, endpointQuery, "visual", "downstream")))
+	})
+
+	t.Run("a failed query is counted by the source of its error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusBadRequest)
+			_, _ = rw.Write([]byte(`{"error": {"message": "Bad request"}}`))
+		}))
+		defer server.Close()
+		cluster := helpers.ClusterHost(server.URL)
+
+		client := &Client{httpClientKusto: server.Client(), clusterURL: server.URL}
+		errors := testutil.ToFloat64(requestErrors.WithLabelValues(cluster, endpointManagement, "schema", "downstream"))
+		_, err := client.KustoRequest(context.Background(), server.URL, ManagementV1Path, models.RequestPayload{CSL: ".show tables", QuerySource: "schema"}, false, "")
+		require.Error(t, err)
+
+		require.Equal(t, errors+1, testutil.ToFloat64(requestErrors.WithLabelValues(cluster, endpointManagement, "schema", "downstream")))
+	})
+
+	t.Run("clusters and sources set by queries are labelled other", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		client := &Client{httpClientKusto: server.Client(), clusterURL: "https://help.kusto.windows.net"}
+		errors := testutil.ToFloat64(requestErrors.WithLabelValues("other", endpointQuery, "other", "downstream"))
+		_, err := client.KustoRequest(context.Background(), server.URL, QueryV2Path, models.RequestPayload{CSL: "T", QuerySource: "made-up"}, false, "")
+		require.Error(t, err)
+
+		require.Equal(t, errors+1, testutil.ToFloat64(requestErrors.WithLabelValues("other", endpointQuery, "other", "downstream")))
+	})
+}
+
+func TestEndpointLabel(t *testing.T) {
+	require.Equal(t, endpointQuery, endpointLabel(QueryV1Path))
+	require.Equal(t, endpointQuery, endpointLabel(QueryV2Path))
+	require.Equal(t, endpointManagement, endpointLabel(ManagementV1Path))
+	require.Equal(t, endpointARG, endpointLabel("/providers/Microsoft.ResourceGraph/resources"))
+}
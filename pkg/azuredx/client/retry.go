@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
+)
+
+const (
+	defaultMaxAttempts = 4
+	defaultBaseDelay   = 500 * time.Millisecond
+	defaultMaxDelay    = 10 * time.Second
+)
+
+// retryPolicy retries idempotent requests that failed because the cluster throttled them, was
+// temporarily unavailable or dropped the connection. The zero value does not retry.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	// budget is the time all attempts of a request, and the waits between them, must fit in.
+	budget time.Duration
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+	// jitter returns a random duration between d/2 and d.
+	jitter func(d time.Duration) time.Duration
+}
+
+func newRetryPolicy(budget time.Duration) retryPolicy {
+	return retryPolicy{
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+		maxDelay:    defaultMaxDelay,
+		budget:      budget,
+		now:         time.Now,
+		sleep:       sleepContext,
+		jitter: func(d time.Duration) time.Duration {
+			return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+		},
+	}
+}
+
+// do sends req with client, retrying it when idempotent is set and the failure is transient.
+// The body of req must be rewindable, which is the case for requests built from a bytes.Reader.
+// When the retries are exhausted the last response or error is returned. Retries are recorded in the
+// metrics of the request.
+func (p retryPolicy) do(client *http.Client, req *http.Request, idempotent bool, metrics *requestMetrics) (*http.Response, error) {
+	if !idempotent || p.maxAttempts <= 1 || req.GetBody == nil {
+		return client.Do(req)
+	}
+
+	ctx := req.Context()
+	start := p.now()
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(req)
+		if attempt >= p.maxAttempts || !retryable(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay := p.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), p.now()); ok {
+				delay = retryAfter
+			}
+		}
+		if p.now().Sub(start)+delay >= p.budget {
+			return resp, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && p.now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		if resp != nil {
+			backend.Logger.Debug("retrying kusto request", "status", resp.StatusCode, "attempt", attempt, "delay", delay)
+			helpers.HandleResponseBodyClose(resp)
+		} else {
+			backend.Logger.Debug("retrying kusto request", "error", err.Error(), "attempt", attempt, "delay", delay)
+		}
+		if err := p.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(ctx)
+		req.Body = body
+		metrics.retried()
+	}
+}
+
+// backoff returns the jittered wait before the given retry, doubling with every attempt.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.baseDelay << (attempt - 1)
+	if d <= 0 || d > p.maxDelay {
+		d = p.maxDelay
+	}
+	return p.jitter(d)
+}
+
+// retryable reports whether a request failed in a way that may succeed when sent again.
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header holding either a number of seconds or an HTTP date.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// isManagementRead reports whether a management command only reads, so it is safe to retry.
+func isManagementRead(csl string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(csl)), ".show ")
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+func testRetryPolicy(delays *[]time.Duration) retryPolicy {
+	p := newRetryPolicy(time.Minute)
+	p.jitter = func(d time.Duration) time.Duration { return d }
+	p.sleep = func(_ context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return nil
+	}
+	return p
+}
+
+func TestKustoRequestRetries(t *testing.T) {
+	successfulResponse, err := os.ReadFile("./testdata/successful-response.json")
+	require.NoError(t, err)
+
+	// newServer responds with the given statuses in turn, followed by a successful response.
+	newServer := func(statuses ...int) (*httptest.Server, *atomic.Int32) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			n := int(requests.Add(1))
+			if n <= len(statuses) {
+				if statuses[n-1] == http.StatusTooManyRequests {
+					rw.Header().Set("Retry-After", "2")
+				}
+				rw.WriteHeader(statuses[n-1])
+				_, _ = rw.Write([]byte(`{"error": {"message": "try again later"}}`))
+				return
+			}
+			rw.WriteHeader(http.StatusOK)
+			_, _ = rw.Write(successfulResponse)
+		}))
+		return server, &requests
+	}
+	payload := models.RequestPayload{DB: "db-name", CSL: "T | take 1"}
+
+	t.Run("throttled and unavailable queries are retried", func(t *testing.T) {
+		server, requests := newServer(http.StatusTooManyRequests, http.StatusServiceUnavailable)
+		defer server.Close()
+		var delays []time.Duration
+		client := &Client{httpClientKusto: server.Client(), retry: testRetryPolicy(&delays)}
+
+		table, err := client.KustoRequest(context.Background(), server.URL, QueryV1Path, payload, false, "Grafana-ADX")
+		require.NoError(t, err)
+		require.NotNil(t, table)
+		require.Equal(t, int32(3), requests.Load())
+		// the first wait follows Retry-After, the second one the backoff of the second attempt
+		assert.Equal(t, []time.Duration{2 * time.Second, time.Second}, delays)
+	})
+
+	t.Run("the last error is returned once the attempts are exhausted", func(t *testing.T) {
+		server, requests := newServer(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+		defer server.Close()
+		var delays []time.Duration
+		client := &Client{httpClientKusto: server.Client(), retry: testRetryPolicy(&delays)}
+
+		_, err := client.KustoRequest(context.Background(), server.URL, QueryV1Path, payload, false, "Grafana-ADX")
+		require.ErrorContains(t, err, "503")
+		require.Equal(t, int32(defaultMaxAttempts), requests.Load())
+	})
+
+	t.Run("retries stop when they would exceed the budget", func(t *testing.T) {
+		server, requests := newServer(http.StatusTooManyRequests)
+		defer server.Close()
+		var delays []time.Duration
+		retry := testRetryPolicy(&delays)
+		retry.budget = time.Second
+		client := &Client{httpClientKusto: server.Client(), retry: retry}
+
+		_, err := client.KustoRequest(context.Background(), server.URL, QueryV1Path, payload, false, "Grafana-ADX")
+		require.ErrorContains(t, err, "429")
+		require.Equal(t, int32(1), requests.Load())
+		require.Empty(t, delays)
+	})
+
+	t.Run("other errors are not retried", func(t *testing.T) {
+		server, requests := newServer(http.StatusBadRequest)
+		defer server.Close()
+		var delays []time.Duration
+		client := &Client{httpClientKusto: server.Client(), retry: testRetryPolicy(&delays)}
+
+		_, err := client.KustoRequest(context.Background(), server.URL, QueryV1Path, payload, false, "Grafana-ADX")
+		require.Error(t, err)
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("management commands that change the cluster are not retried", func(t *testing.T) {
+		server, requests := newServer(http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+		defer server.Close()
+		var delays []time.Duration
+		client := &Client{httpClientKusto: server.Client(), retry: testRetryPolicy(&delays)}
+
+		_, err := client.KustoRequest(context.Background(), server.URL, ManagementV1Path, models.RequestPayload{CSL: ".drop table T"}, false, "Grafana-ADX")
+		require.ErrorContains(t, err, "503")
+		require.Equal(t, int32(1), requests.Load())
+
+		_, err = client.KustoRequest(context.Background(), server.URL, ManagementV1Path, models.RequestPayload{CSL: ".show databases"}, false, "Grafana-ADX")
+		require.NoError(t, err)
+		require.Equal(t, int32(3), requests.Load())
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	d, ok := parseRetryAfter("5", now)
+	require.True(t, ok)
+	assert.Equal(t, 5*time.Second, d)
+
+	d, ok = parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now)
+	require.True(t, ok)
+	assert.Equal(t, 30*time.Second, d)
+
+	d, ok = parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now)
+	require.True(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+
+	for _, header := range []string{"", "-1", "soon"} {
+		_, ok = parseRetryAfter(header, now)
+		assert.False(t, ok, header)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := newRetryPolicy(time.Minute)
+	p.jitter = func(d time.Duration) time.Duration { return d }
+	assert.Equal(t, 500*time.Millisecond, p.backoff(1))
+	assert.Equal(t, time.Second, p.backoff(2))
+	assert.Equal(t, 2*time.Second, p.backoff(3))
+	assert.Equal(t, defaultMaxDelay, p.backoff(10))
+	assert.Equal(t, defaultMaxDelay, p.backoff(100))
+
+	p = newRetryPolicy(time.Minute)
+	for i := 0; i < 100; i++ {
+		d := p.backoff(2)
+		assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+		assert.LessOrEqual(t, d, time.Second)
+	}
+}
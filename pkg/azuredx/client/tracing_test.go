@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+func TestKustoRequestTracing(t *testing.T) {
+	body, err := os.ReadFile("./testdata/successful-v2-response.json")
+	require.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := tracing.DefaultTracer()
+	tracing.InitDefaultTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test"))
+	defer tracing.InitDefaultTracer(previous)
+
+	var traceparent, clientRequestID string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+		clientRequestID = req.Header.Get("x-ms-client-request-id")
+		_, _ = rw.Write(body)
+	}))
+	defer server.Close()
+
+	ctx, parent := tracing.DefaultTracer().Start(context.Background(), "query")
+	client := &Client{httpClientKusto: server.Client()}
+	table, err := client.KustoRequest(ctx, server.URL, QueryV2Path, models.RequestPayload{DB: "db-name", CSL: "T", QuerySource: "raw"}, false, "")
+	require.NoError(t, err)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	decode, request := spans[0], spans[1]
+	require.Equal(t, "adx.decode", decode.Name())
+	require.Equal(t, "adx.kustoRequest", request.Name())
+	require.Equal(t, request.SpanContext().SpanID(), decode.Parent().SpanID())
+	require.Equal(t, parent.SpanContext().SpanID(), request.Parent().SpanID())
+
+	attributes := map[string]interface{}{}
+	for _, kv := range request.Attributes() {
+		attributes[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	require.Equal(t, helpers.ClusterHost(server.URL), attributes["adx.cluster"])
+	require.Equal(t, "db-name", attributes["adx.database"])
+	require.Equal(t, clientRequestID, attributes["adx.client_request_id"])
+	require.Equal(t, int64(table.RowCount()), attributes["adx.rows"])
+	require.Equal(t, int64(http.StatusOK), attributes["http.response.status_code"])
+
+	require.Contains(t, traceparent, request.SpanContext().TraceID().String())
+	require.Contains(t, traceparent, request.SpanContext().SpanID().String())
+}
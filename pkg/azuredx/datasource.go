@@ -2,13 +2,17 @@ package azuredx
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/adxauth/adxcredentials"
 	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
+	"github.com/grafana/grafana-azure-sdk-go/v2/azcredentials"
 	"github.com/grafana/grafana-azure-sdk-go/v2/azsettings"
 	"github.com/grafana/grafana-azure-sdk-go/v2/azusercontext"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -18,6 +22,7 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
 
 	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/client"
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/expression"
 	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
 
 	// 100% compatible drop-in replacement of "encoding/json"
@@ -29,6 +34,14 @@ type AzureDataExplorer struct {
 	backend.CallResourceHandler
 	client   client.AdxClient
 	settings *models.DatasourceSettings
+	cache    *queryCache
+	inflight inflightGroup
+	audit    *auditLog
+	schemas  schemaStore
+	// querySlots bounds the queries the datasource runs at the same time, across all requests
+	querySlots chan struct{}
+	// userResults is set when the datasource authenticates as the user, so results are not shared between users
+	userResults bool
 }
 
 func NewDatasource(ctx context.Context, instanceSettings backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
@@ -46,6 +59,7 @@ func NewDatasource(ctx context.Context, instanceSettings backend.DataSourceInsta
 		return nil, err
 	}
 	adx.settings = datasourceSettings
+	adx.querySlots = newQuerySlots(datasourceSettings)
 	adx.settings.OpenAIAPIKey = strings.TrimSpace(instanceSettings.DecryptedSecureJSONData["OpenAIAPIKey"])
 
 	azureSettings, err := azsettings.ReadSettings(ctx)
@@ -67,6 +81,16 @@ func NewDatasource(ctx context.Context, instanceSettings backend.DataSourceInsta
 		return nil, err
 	}
 	adx.client = adxClient
+	adx.cache = newQueryCache(datasourceSettings.QueryCacheSize)
+	adx.audit, err = newAuditLog(datasourceSettings, instanceSettings.UID)
+	if err != nil {
+		backend.Logger.Error("failed to create ADX audit log", "error", err.Error())
+		return nil, err
+	}
+	switch credentials.AzureAuthType() {
+	case azcredentials.AzureAuthClientSecretObo, azcredentials.AzureAuthCurrentUserIdentity:
+		adx.userResults = true
+	}
 
 	mux := http.NewServeMux()
 	adx.registerRoutes(mux)
@@ -82,13 +106,83 @@ func (adx *AzureDataExplorer) QueryData(ctx context.Context, req *backend.QueryD
 
 	res := backend.NewQueryDataResponse()
 
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
 	for _, q := range req.Queries {
-		res.Responses[q.RefID] = adx.handleQuery(ctx, q, req.PluginContext.User)
+		wg.Add(1)
+		go func(q backend.DataQuery) {
+			defer wg.Done()
+			adx.querySlots <- struct{}{}
+			defer func() { <-adx.querySlots }()
+
+			resp := adx.handleQuerySafe(ctx, q, req.PluginContext.User)
+
+			mu.Lock()
+			res.Responses[q.RefID] = resp
+			mu.Unlock()
+		}(q)
 	}
+	wg.Wait()
 
 	return res, nil
 }
 
+// newQuerySlots returns the slots of the queries a datasource runs at the same time.
+func newQuerySlots(settings *models.DatasourceSettings) chan struct{} {
+	limit := models.DefaultMaxConcurrentQueries
+	if settings.MaxConcurrentQueries > 0 {
+		limit = settings.MaxConcurrentQueries
+	}
+	return make(chan struct{}, limit)
+}
+
+// sharedKustoRequest runs the query against the cluster, unless its result is still in the query
+// cache or an identical query is already in flight, in which case its result is shared. Results are
+// only cached when the query has a cache max age and completed without exceptions.
+func (adx *AzureDataExplorer) sharedKustoRequest(ctx context.Context, cluster string, payload models.RequestPayload, cs *models.CacheSettings, user *backend.User, application string) (*models.TableResponse, error) {
+	login := ""
+	if adx.userResults && user != nil {
+		login = user.Login
+	}
+	key, err := queryResultKey(cluster, payload, cs.TimeRange, login)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := cs.MaxAge()
+	cacheable := adx.cache != nil && ttl > 0
+	if cacheable {
+		if tableRes, ok := adx.cache.get(key); ok {
+			return tableRes, nil
+		}
+	}
+
+	return adx.inflight.do(ctx, key, func(ctx context.Context) (*models.TableResponse, error) {
+		tableRes, err := adx.client.KustoRequest(ctx, cluster, client.QueryV2Path, payload, adx.settings.EnableUserTracking, application)
+		if err != nil {
+			return nil, err
+		}
+		if cacheable && len(tableRes.Exceptions) == 0 {
+			adx.cache.set(key, tableRes, ttl)
+		}
+		return tableRes, nil
+	})
+}
+
+// handleQuerySafe runs handleQuery and converts a panic into an error response, so that
+// a single failing query does not take down the other queries of the same request.
+func (adx *AzureDataExplorer) handleQuerySafe(ctx context.Context, q backend.DataQuery, user *backend.User) (resp backend.DataResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			backend.Logger.Error("panic while handling query", "refId", q.RefID, "panic", r)
+			resp = backend.ErrDataResponseWithSource(backend.StatusInternal, backend.ErrorSourcePlugin, fmt.Sprintf("unexpected error while handling query: %v", r))
+		}
+	}()
+	return adx.handleQuery(ctx, q, user)
+}
+
 func (adx *AzureDataExplorer) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
 	return adx.CallResourceHandler.CallResource(azusercontext.WithUserFromResourceReq(ctx, req), req, sender)
 }
@@ -98,7 +192,7 @@ func (adx *AzureDataExplorer) CheckHealth(ctx context.Context, req *backend.Chec
 	ctx = azusercontext.WithUserFromHealthCheckReq(ctx, req)
 	headers := map[string]string{}
 
-	err := adx.client.TestKustoRequest(ctx, adx.settings, models.NewConnectionProperties(adx.settings, nil), headers)
+	err := adx.client.TestKustoRequest(ctx, adx.settings, models.NewConnectionProperties(adx.settings, nil, nil), headers)
 	if err != nil {
 		return &backend.CheckHealthResult{
 			Status:  backend.HealthStatusError,
@@ -106,7 +200,7 @@ func (adx *AzureDataExplorer) CheckHealth(ctx context.Context, req *backend.Chec
 		}, nil
 	}
 
-	err = adx.client.TestARGsRequest(ctx, adx.settings, models.NewConnectionProperties(adx.settings, nil), headers)
+	err = adx.client.TestARGsRequest(ctx, adx.settings, models.NewConnectionProperties(adx.settings, nil, nil), headers)
 	if err != nil {
 		return &backend.CheckHealthResult{
 			Status:  backend.HealthStatusOk,
@@ -126,19 +220,114 @@ func (adx *AzureDataExplorer) handleQuery(ctx context.Context, q backend.DataQue
 	if err != nil {
 		return backend.DataResponse{Error: fmt.Errorf("malformed request query: %w", err)}
 	}
+	if err := qm.ValidateClientRequestProperties(); err != nil {
+		return backend.DataResponse{Error: err, ErrorSource: backend.ErrorSourceDownstream}
+	}
+	if isMetadataQuery(qm.QueryType) {
+		return adx.metadataQuery(ctx, qm)
+	}
+	if err := adx.compileExpression(ctx, &qm); err != nil {
+		return backend.ErrorResponseWithErrorSource(backend.DownstreamError(fmt.Errorf("invalid query expression: %w", err)))
+	}
+
+	return adx.executeQuery(ctx, q, qm, models.NewCacheSettings(adx.settings, &q, &qm), user)
+}
+
+// compileExpression compiles the expression of a query of the visual query editor, so that the query
+// runs even when the KQL compiled by the browser is stale or missing. That KQL is kept when the
+// expression refers to template variables, which only the browser replaces, or when the columns of
+// its table are unknown, as the time column and casts of the query depend on them. Without that KQL,
+// an expression referring to template variables cannot run.
+func (adx *AzureDataExplorer) compileExpression(ctx context.Context, qm *models.QueryModel) error {
+	if qm.RawMode == nil || *qm.RawMode || qm.Expression == nil || qm.Expression.From == nil || qm.Expression.From.Property == nil {
+		return nil
+	}
+	columns, known := adx.expressionColumns(ctx, *qm, qm.Expression.From.Property.Name)
+	result, err := expression.Compile(*qm.Expression, columns)
+	if err != nil {
+		return err
+	}
+	if qm.Query != "" && (!known || len(result.Unresolved) > 0) {
+		backend.Logger.Debug("running the query compiled by the browser", "columnsKnown", known, "unresolved", result.Unresolved)
+		return nil
+	}
+	if len(result.Variables) > 0 {
+		return fmt.Errorf("template variables are only replaced by the query editor: %s", strings.Join(result.Variables, ", "))
+	}
+	qm.Query = result.Query
+	return nil
+}
+
+// expressionColumns returns the columns of the table a query expression queries from, and whether
+// they are known. They come from the schema cache, which fetches the schema when it is not cached.
+func (adx *AzureDataExplorer) expressionColumns(ctx context.Context, qm models.QueryModel, table string) ([]expression.Column, bool) {
+	clusterURL := qm.ClusterUri
+	if clusterURL == "" {
+		clusterURL = adx.settings.ClusterURL
+	}
+	database := qm.Database
+	if database == "" {
+		database = adx.settings.DefaultDatabase
+	}
+	sanitized, err := helpers.SanitizeClusterUri(clusterURL)
+	if err != nil || database == "" {
+		return nil, false
+	}
 
-	cs := models.NewCacheSettings(adx.settings, &q, &qm)
-	qm.MacroData = models.NewMacroData(cs.TimeRange, q.Interval.Milliseconds())
-	if err := qm.Interpolate(); err != nil {
-		return backend.DataResponse{Error: err}
+	user := adx.schemaUser(ctx)
+	db := adx.schemas.database(sanitized, database, user)
+	if db == nil {
+		// the fetched schema is not cached when the schema cache TTL is zero
+		if schema, err := adx.schema(ctx, sanitized, database, false); err != nil {
+			backend.Logger.Warn("failed to fetch the schema of a query expression", "database", database, "error", err.Error())
+		} else {
+			db = schema.Databases[database]
+		}
+	}
+	if db == nil {
+		return nil, false
+	}
+	schemas, ok := db.ColumnSchemas(table)
+	if !ok || schemas == nil {
+		return nil, false
+	}
+	columns := make([]expression.Column, 0, len(schemas))
+	for _, c := range schemas {
+		columns = append(columns, expression.Column{Name: c.Name, CslType: c.CslType})
+	}
+	return columns, true
+}
+
+// executeQuery interpolates the macros and declares the parameters of a validated query, then runs
+// it against the cluster with the given cache settings.
+func (adx *AzureDataExplorer) executeQuery(ctx context.Context, q backend.DataQuery, qm models.QueryModel, cs *models.CacheSettings, user *backend.User) backend.DataResponse {
+	qm.MacroData = models.NewMacroData(cs.TimeRange, q.Interval.Milliseconds()).WithTimezone(qm.Timezone)
+	_, span := helpers.StartSpan(ctx, "adx.interpolate", helpers.AttributeQuerySource.String(qm.QuerySource))
+	err := qm.Interpolate()
+	helpers.EndSpan(span, err)
+	if err != nil {
+		return backend.ErrorResponseWithErrorSource(backend.DownstreamError(err))
 	}
-	props := models.NewConnectionProperties(adx.settings, cs)
+	parameters, err := qm.DeclareParameters()
+	if err != nil {
+		return backend.DataResponse{Error: err, ErrorSource: backend.ErrorSourceDownstream}
+	}
+	props := models.NewConnectionProperties(adx.settings, cs, &qm)
+	props.Parameters = parameters
 
-	resp, err := adx.modelQuery(ctx, qm, props, user)
+	resp, err := adx.modelQuery(ctx, qm, props, cs, user)
 	if err != nil {
+		meta := &data.FrameMeta{ExecutedQueryString: qm.Query}
+		// the details of errors of the cluster let the query editor mark the position of the error
+		// in the executed query
+		var kustoErr *models.KustoError
+		if errors.As(err, &kustoErr) {
+			meta.Custom = &models.ErrorFrameMD{KustoError: kustoErr}
+			resp.Status = backend.Status(kustoErr.StatusCode)
+		}
 		resp.Frames = append(resp.Frames, &data.Frame{
 			RefID: q.RefID,
-			Meta:  &data.FrameMeta{ExecutedQueryString: qm.Query},
+			Meta:  meta,
 		})
 		resp.Error = err
 		errWithSource, ok := err.(errorsource.Error)
@@ -149,7 +338,7 @@ func (adx *AzureDataExplorer) handleQuery(ctx context.Context, q backend.DataQue
 	return resp
 }
 
-func (adx *AzureDataExplorer) modelQuery(ctx context.Context, q models.QueryModel, props *models.Properties, user *backend.User) (backend.DataResponse, error) {
+func (adx *AzureDataExplorer) modelQuery(ctx context.Context, q models.QueryModel, props *models.Properties, cs *models.CacheSettings, user *backend.User) (resp backend.DataResponse, err error) {
 	headers := map[string]string{}
 	msClientRequestIDHeader := fmt.Sprintf("KGC.%s;%x", q.QuerySource, rand.Uint64())
 	if adx.settings.EnableUserTracking {
@@ -164,6 +353,9 @@ func (adx *AzureDataExplorer) modelQuery(ctx context.Context, q models.QueryMode
 	if clusterURL == "" {
 		clusterURL = adx.settings.ClusterURL
 	}
+	defer func() {
+		observeQuery(ctx, clusterURL, adx.settings.ClusterURL, q, resp, err)
+	}()
 
 	database := q.Database
 	if database == "" {
@@ -178,35 +370,76 @@ func (adx *AzureDataExplorer) modelQuery(ctx context.Context, q models.QueryMode
 		// errorsource set in SanitizeClusterUri
 		return backend.DataResponse{}, err
 	}
+	// stream the primary result as fragments so it can be decoded while the body is read
+	props.Options.ResultsProgressiveEnabled = true
+
 	application := adx.settings.Application
-	tableRes, err := adx.client.KustoRequest(ctx, sanitized, "/v1/rest/query", models.RequestPayload{
+	payload := models.RequestPayload{
 		CSL:         q.Query,
 		DB:          database,
 		Properties:  props,
 		QuerySource: q.QuerySource,
-	}, adx.settings.EnableUserTracking, application)
+	}
+	var tableRes *models.TableResponse
+	audit := auditEntry{
+		Time:        time.Now(),
+		Cluster:     helpers.ClusterHost(sanitized),
+		Database:    database,
+		QueryHash:   queryHash(q.Query),
+		QuerySource: q.QuerySource,
+	}
+	if user != nil {
+		audit.User = user.Login
+	}
+	defer func() {
+		adx.audit.recordQuery(ctx, audit, tableRes, resp, err)
+	}()
+
+	tableRes, err = adx.sharedKustoRequest(ctx, sanitized, payload, cs, user, application)
 	if err != nil {
 		backend.Logger.Debug("error building kusto request", "error", err.Error())
 		// errorsource set in KustoRequest
 		return backend.DataResponse{}, err
 	}
+	if adx.settings.PartialResultsAsErrors {
+		if err := tableRes.ExceptionsError(); err != nil {
+			return backend.DataResponse{}, err
+		}
+	}
+
+	toDataFrames := tableRes.ToDataFrames
+	if q.AllResultTables {
+		toDataFrames = tableRes.ToAllDataFrames
+	}
+	ctx, span := helpers.StartSpan(ctx, "adx.convert",
+		helpers.AttributeCluster.String(helpers.ClusterHost(sanitized)),
+		helpers.AttributeDatabase.String(database),
+		helpers.AttributeFormat.String(q.Format),
+	)
+	defer func() {
+		rows := 0
+		for _, f := range resp.Frames {
+			rows += f.Rows()
+		}
+		span.SetAttributes(helpers.AttributeFrames.Int(len(resp.Frames)), helpers.AttributeRows.Int(rows))
+		helpers.EndSpan(span, err)
+	}()
 
-	var resp backend.DataResponse
 	switch q.Format {
 	case "table":
-		resp.Frames, err = tableRes.ToDataFrames(q.Query, q.Format)
+		resp.Frames, err = toDataFrames(q.Query, q.Format)
 		if err != nil {
 			backend.Logger.Debug("error converting response to data frames", "error", err.Error())
 			return resp, fmt.Errorf("error converting response to data frames: %w", err)
 		}
 	case "trace":
-		resp.Frames, err = tableRes.ToDataFrames(q.Query, q.Format)
+		resp.Frames, err = toDataFrames(q.Query, q.Format)
 		if err != nil {
 			backend.Logger.Debug("error converting response to data frames", "error", err.Error())
 			return resp, fmt.Errorf("error converting response to data frames: %w", err)
 		}
 	case "time_series":
-		frames, err := tableRes.ToDataFrames(q.Query, q.Format)
+		frames, err := toDataFrames(q.Query, q.Format)
 		if err != nil {
 			return resp, err
 		}
@@ -221,7 +454,9 @@ func (adx *AzureDataExplorer) modelQuery(ctx context.Context, q models.QueryMode
 				resp.Frames = append(resp.Frames, f)
 				continue
 			case data.TimeSeriesTypeLong:
+				_, wideSpan := helpers.StartSpan(ctx, "adx.longToWide", helpers.AttributeRows.Int(f.Rows()))
 				wideFrame, err := data.LongToWide(f, nil)
+				helpers.EndSpan(wideSpan, err)
 				if err != nil {
 					f.AppendNotices(data.Notice{
 						Severity: data.NoticeSeverityWarning,
@@ -230,25 +465,30 @@ func (adx *AzureDataExplorer) modelQuery(ctx context.Context, q models.QueryMode
 					resp.Frames = append(resp.Frames, f)
 					continue
 				}
+				models.ApplyAlias(wideFrame, q.Alias)
 				resp.Frames = append(resp.Frames, wideFrame)
 			default:
+				models.ApplyAlias(f, q.Alias)
 				resp.Frames = append(resp.Frames, f)
 			}
 		}
 	case "time_series_adx_series":
-		originalDFs, err := tableRes.ToDataFrames(q.Query, q.Format)
+		originalDFs, err := toDataFrames(q.Query, q.Format)
 		if err != nil {
 			return resp, fmt.Errorf("error converting response to data frames: %w", err)
 		}
 		for _, f := range originalDFs {
+			_, seriesSpan := helpers.StartSpan(ctx, "adx.toADXTimeSeries", helpers.AttributeRows.Int(f.Rows()))
 			formattedDF, err := models.ToADXTimeSeries(f)
+			helpers.EndSpan(seriesSpan, err)
 			if err != nil {
 				return resp, backend.DownstreamError(err)
 			}
+			models.ApplyAlias(formattedDF, q.Alias)
 			resp.Frames = append(resp.Frames, formattedDF)
 		}
 	case "logs":
-		resp.Frames, err = tableRes.ToDataFrames(q.Query, q.Format)
+		resp.Frames, err = toDataFrames(q.Query, q.Format)
 		if err != nil {
 			backend.Logger.Debug("error converting response to data frames", "error", err.Error())
 			return resp, fmt.Errorf("error converting response to data frames: %w", err)
@@ -257,5 +497,16 @@ func (adx *AzureDataExplorer) modelQuery(ctx context.Context, q models.QueryMode
 		resp.Error = fmt.Errorf("unsupported query type: '%v'", q.Format)
 	}
 
+	if len(tableRes.Exceptions) > 0 {
+		// without any decoded rows there are no partial results to return
+		if len(resp.Frames) == 0 {
+			return resp, tableRes.ExceptionsError()
+		}
+		notices := tableRes.ExceptionNotices()
+		for _, f := range resp.Frames {
+			f.AppendNotices(notices...)
+		}
+	}
+
 	return resp, nil
 }
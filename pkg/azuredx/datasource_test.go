@@ -2,12 +2,19 @@ package azuredx
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/stretchr/testify/require"
 )
 
@@ -44,7 +51,8 @@ func TestDatasource(t *testing.T) {
 			JSON:          []byte(`{"resultFormat": "table","querySource": "schema","database":"test-database"}`),
 		}
 		kustoRequestMock = func(url string, cluster string, payload models.RequestPayload, enableUserTracking bool, application string) (*models.TableResponse, error) {
-			require.Equal(t, "/v1/rest/query", url)
+			require.Equal(t, "/v2/rest/query", url)
+			require.True(t, payload.Properties.Options.ResultsProgressiveEnabled)
 			require.Equal(t, ClusterURL, cluster)
 			require.Equal(t, payload.DB, "test-database")
 			require.Equal(t, enableUserTracking, true)
@@ -73,6 +81,185 @@ func TestDatasource(t *testing.T) {
 		require.NoError(t, res.Error)
 	})
 
+	t.Run("When allResultTables is set every result table is returned", func(t *testing.T) {
+		adx = AzureDataExplorer{}
+		adx.client = &fakeClient{}
+		adx.settings = &models.DatasourceSettings{ClusterURL: ClusterURL, DefaultDatabase: "test-default-database"}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"resultFormat": "table","querySource": "raw","allResultTables": true}`),
+		}
+		kustoRequestMock = func(_ string, _ string, _ models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			return &models.TableResponse{
+				Tables: []models.Table{
+					{TableName: "Requests", TableKind: models.TableKindPrimaryResult, Columns: []models.Column{{ColumnName: "Count", ColumnType: "long"}}, Rows: []models.Row{[]interface{}{json.Number("1")}}},
+					{TableName: "Failures", TableKind: models.TableKindPrimaryResult, Columns: []models.Column{{ColumnName: "Count", ColumnType: "long"}}, Rows: []models.Row{[]interface{}{json.Number("2")}}},
+					{TableName: "QueryCompletionInformation", TableKind: models.TableKindQueryCompletionInformation},
+				},
+			}, nil
+		}
+		res := adx.handleQuery(context.Background(), query, &backend.User{Login: UserLogin})
+		require.NoError(t, res.Error)
+		require.Len(t, res.Frames, 2)
+		require.Equal(t, "Requests", res.Frames[0].Name)
+		require.Equal(t, "Failures", res.Frames[1].Name)
+	})
+
+	t.Run("Truncation limits of the query override the datasource settings", func(t *testing.T) {
+		adx = AzureDataExplorer{}
+		adx.client = &fakeClient{}
+		adx.settings = &models.DatasourceSettings{ClusterURL: ClusterURL, DefaultDatabase: "test-default-database", TruncationMaxRecords: 1000, TruncationMaxSize: 2048}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"resultFormat": "table","querySource": "raw","truncationMaxRecords": 10}`),
+		}
+		kustoRequestMock = func(_ string, _ string, payload models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			require.Equal(t, int64(10), payload.Properties.Options.TruncationMaxRecords)
+			require.Equal(t, int64(2048), payload.Properties.Options.TruncationMaxSize)
+			return table, nil
+		}
+		res := adx.handleQuery(context.Background(), query, &backend.User{Login: UserLogin})
+		require.NoError(t, res.Error)
+	})
+
+	t.Run("Client request properties of the query are sent with the request", func(t *testing.T) {
+		adx = AzureDataExplorer{}
+		adx.client = &fakeClient{}
+		adx.settings = &models.DatasourceSettings{ClusterURL: ClusterURL, DefaultDatabase: "test-default-database"}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"resultFormat": "table","querySource": "raw","clientRequestProperties": {"query_datascope": "hotcache", "query_take_max_records": 100}}`),
+		}
+		kustoRequestMock = func(_ string, _ string, payload models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			require.Equal(t, map[string]interface{}{"query_datascope": "hotcache", "query_take_max_records": int64(100)}, payload.Properties.Options.Extra)
+			return table, nil
+		}
+		res := adx.handleQuery(context.Background(), query, &backend.User{Login: UserLogin})
+		require.NoError(t, res.Error)
+	})
+
+	t.Run("Returns an error if the query sets an unsupported client request property", func(t *testing.T) {
+		adx = AzureDataExplorer{}
+		adx.client = &fakeClient{}
+		adx.settings = &models.DatasourceSettings{ClusterURL: ClusterURL, DefaultDatabase: "test-default-database"}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"resultFormat": "table","querySource": "raw","clientRequestProperties": {"servertimeout": "01:00:00"}}`),
+		}
+		kustoRequestMock = func(_ string, _ string, _ models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			t.Fatal("query with an unsupported client request property must not be sent")
+			return nil, nil
+		}
+		res := adx.handleQuery(context.Background(), query, &backend.User{Login: UserLogin})
+		require.Error(t, res.Error)
+		require.Equal(t, backend.ErrorSourceDownstream, res.ErrorSource)
+	})
+
+	t.Run("Query parameters are declared and sent with the request", func(t *testing.T) {
+		adx = AzureDataExplorer{}
+		adx.client = &fakeClient{}
+		adx.settings = &models.DatasourceSettings{ClusterURL: ClusterURL, DefaultDatabase: "test-default-database"}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"resultFormat": "table","querySource": "raw","query": "T | where Name == name","parameters": {"name": {"type": "string", "value": "x\" | take 1"}}}`),
+		}
+		kustoRequestMock = func(_ string, _ string, payload models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			require.Equal(t, "declare query_parameters(name:string);\nT | where Name == name", payload.CSL)
+			require.Equal(t, map[string]string{"name": `"x\" | take 1"`}, payload.Properties.Parameters)
+			return table, nil
+		}
+		res := adx.handleQuery(context.Background(), query, &backend.User{Login: UserLogin})
+		require.NoError(t, res.Error)
+	})
+
+	t.Run("Partial results are returned with the exceptions as warnings", func(t *testing.T) {
+		adx = AzureDataExplorer{}
+		adx.client = &fakeClient{}
+		adx.settings = &models.DatasourceSettings{ClusterURL: ClusterURL, DefaultDatabase: "test-default-database"}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"resultFormat": "table","querySource": "raw"}`),
+		}
+		kustoRequestMock = func(_ string, _ string, _ models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			return partialTableResponse(), nil
+		}
+		res := adx.handleQuery(context.Background(), query, &backend.User{Login: UserLogin})
+		require.NoError(t, res.Error)
+		require.Len(t, res.Frames, 1)
+		require.Len(t, res.Frames[0].Meta.Notices, 1)
+		require.Equal(t, data.NoticeSeverityWarning, res.Frames[0].Meta.Notices[0].Severity)
+		require.Contains(t, res.Frames[0].Meta.Notices[0].Text, "E_LOW_MEMORY_CONDITION")
+	})
+
+	t.Run("Partial results are returned as an error when configured", func(t *testing.T) {
+		adx = AzureDataExplorer{}
+		adx.client = &fakeClient{}
+		adx.settings = &models.DatasourceSettings{ClusterURL: ClusterURL, DefaultDatabase: "test-default-database", PartialResultsAsErrors: true}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"resultFormat": "table","querySource": "raw"}`),
+		}
+		kustoRequestMock = func(_ string, _ string, _ models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			return partialTableResponse(), nil
+		}
+		res := adx.handleQuery(context.Background(), query, &backend.User{Login: UserLogin})
+		require.Error(t, res.Error)
+		require.Equal(t, backend.ErrorSourceDownstream, res.ErrorSource)
+		require.Contains(t, res.Error.Error(), "E_LOW_MEMORY_CONDITION")
+	})
+
+	t.Run("Exceptions without any rows are returned as an error", func(t *testing.T) {
+		adx = AzureDataExplorer{}
+		adx.client = &fakeClient{}
+		adx.settings = &models.DatasourceSettings{ClusterURL: ClusterURL, DefaultDatabase: "test-default-database"}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"resultFormat": "table","querySource": "raw"}`),
+		}
+		kustoRequestMock = func(_ string, _ string, _ models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			tr := partialTableResponse()
+			tr.Tables[0].Rows = []models.Row{}
+			return tr, nil
+		}
+		res := adx.handleQuery(context.Background(), query, &backend.User{Login: UserLogin})
+		require.Error(t, res.Error)
+		require.Contains(t, res.Error.Error(), "E_LOW_MEMORY_CONDITION")
+	})
+
+	t.Run("Errors of the cluster are returned with their details", func(t *testing.T) {
+		adx = AzureDataExplorer{}
+		adx.client = &fakeClient{}
+		adx.settings = &models.DatasourceSettings{ClusterURL: ClusterURL, DefaultDatabase: "test-default-database"}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"resultFormat": "table","querySource": "raw","query": "PerfTest take 5"}`),
+		}
+		kustoErr := &models.KustoError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request", Message: "Syntax error", Permanent: true, Line: 1, Position: 9}
+		kustoRequestMock = func(_ string, _ string, _ models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			return nil, backend.NewErrorWithSource(kustoErr, backend.ErrorSourceDownstream)
+		}
+		res := adx.handleQuery(context.Background(), query, &backend.User{Login: UserLogin})
+		require.Error(t, res.Error)
+		require.Equal(t, backend.StatusBadRequest, res.Status)
+		require.Equal(t, backend.ErrorSourceDownstream, res.ErrorSource)
+		require.Len(t, res.Frames, 1)
+		require.Equal(t, "PerfTest take 5", res.Frames[0].Meta.ExecutedQueryString)
+		require.Equal(t, &models.ErrorFrameMD{KustoError: kustoErr}, res.Frames[0].Meta.Custom)
+	})
+
+	t.Run("Errors of macros are downstream errors", func(t *testing.T) {
+		adx = AzureDataExplorer{}
+		adx.client = &fakeClient{}
+		adx.settings = &models.DatasourceSettings{ClusterURL: ClusterURL, DefaultDatabase: "test-default-database"}
+		query := backend.DataQuery{
+			RefID: "A",
+			JSON:  []byte(`{"resultFormat": "table","querySource": "raw","query": "T | summarize count() by $__timeBin(t, 1h, 2h)"}`),
+		}
+		res := adx.handleQuery(context.Background(), query, &backend.User{Login: UserLogin})
+		require.ErrorContains(t, res.Error, "$__timeBin at line 1, column 26: expected at most 2 arguments, got 3")
+		require.Equal(t, backend.ErrorSourceDownstream, res.ErrorSource)
+	})
+
 	t.Run("Returns an error if query does not specify a database and none is available in the data source", func(t *testing.T) {
 		adx = AzureDataExplorer{}
 		adx.client = &fakeClient{}
@@ -93,6 +280,119 @@ func TestDatasource(t *testing.T) {
 	})
 }
 
+func TestQueryExpression(t *testing.T) {
+	schema := &models.Schema{Databases: map[string]*models.DatabaseSchema{
+		"db": {Name: "db", Tables: map[string]*models.TableSchema{"StormEvents": {Name: "StormEvents", OrderedColumns: []models.ColumnSchema{
+			{Name: "StartTime", CslType: "datetime"},
+			{Name: "State", CslType: "string"},
+		}}}},
+	}}
+	query := func(kql string, value string) backend.DataQuery {
+		return backend.DataQuery{
+			RefID: "A",
+			JSON: []byte(fmt.Sprintf(`{"resultFormat": "table", "database": "db", "rawMode": false, "query": %q, "expression": {
+				"from": {"type": "property", "property": {"type": "string", "name": "StormEvents"}},
+				"where": {"type": "and", "expressions": [{"type": "operator", "property": {"type": "string", "name": "State"}, "operator": {"name": "==", "value": %q}}]},
+				"reduce": {"type": "and", "expressions": []},
+				"groupBy": {"type": "and", "expressions": []}
+			}}`, kql, value)),
+		}
+	}
+	newADX := func(executed *[]string) *AzureDataExplorer {
+		adx := &AzureDataExplorer{client: &fakeClient{}, settings: &models.DatasourceSettings{ClusterURL: schemaCluster}}
+		kustoRequestMock = func(url string, _ string, payload models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			if url == ManagementApiPath {
+				return schemaResponse(t, schema), nil
+			}
+			*executed = append(*executed, payload.CSL)
+			return table, nil
+		}
+		return adx
+	}
+
+	t.Run("A stale query is compiled again from its expression", func(t *testing.T) {
+		var executed []string
+		adx := newADX(&executed)
+		adx.schemas.set(schemaKey{cluster: schemaCluster, database: "db"}, schema, "")
+		res := adx.handleQuery(context.Background(), query("StormEvents | where State == 'TEXAS'", "O'Hare"), nil)
+		require.NoError(t, res.Error)
+		require.Len(t, executed, 1)
+		require.True(t, strings.HasPrefix(executed[0], "StormEvents\n| where [\"StartTime\"] >= datetime("), executed[0])
+		require.True(t, strings.HasSuffix(executed[0], "\n| where [\"State\"] == 'O\\'Hare'\n| order by [\"StartTime\"] asc"), executed[0])
+	})
+
+	t.Run("The schema is fetched for queries without KQL", func(t *testing.T) {
+		var executed []string
+		adx := newADX(&executed)
+		res := adx.handleQuery(context.Background(), query("", "TEXAS"), nil)
+		require.NoError(t, res.Error)
+		require.Len(t, executed, 1)
+		require.Contains(t, executed[0], "order by [\"StartTime\"] asc")
+	})
+
+	t.Run("The query of the browser is kept when it replaces template variables", func(t *testing.T) {
+		var executed []string
+		adx := newADX(&executed)
+		adx.schemas.set(schemaKey{cluster: schemaCluster, database: "db"}, schema, "")
+		res := adx.handleQuery(context.Background(), query("StormEvents | where State == 'TEXAS'", "$state"), nil)
+		require.NoError(t, res.Error)
+		require.Equal(t, []string{"StormEvents | where State == 'TEXAS'"}, executed)
+	})
+
+	t.Run("The schema is fetched for stale queries", func(t *testing.T) {
+		var executed []string
+		adx := newADX(&executed)
+		res := adx.handleQuery(context.Background(), query("StormEvents | where State == 'TEXAS'", "O'Hare"), nil)
+		require.NoError(t, res.Error)
+		require.Len(t, executed, 1)
+		require.True(t, strings.HasSuffix(executed[0], "\n| where [\"State\"] == 'O\\'Hare'\n| order by [\"StartTime\"] asc"), executed[0])
+	})
+
+	t.Run("The query of the browser is kept when the columns are unknown", func(t *testing.T) {
+		var executed []string
+		adx := newADX(&executed)
+		kustoRequestMock = func(url string, _ string, payload models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+			if url == ManagementApiPath {
+				return nil, fmt.Errorf("schema unavailable")
+			}
+			executed = append(executed, payload.CSL)
+			return table, nil
+		}
+		res := adx.handleQuery(context.Background(), query("StormEvents | where State == 'TEXAS'", "TEXAS"), nil)
+		require.NoError(t, res.Error)
+		require.Equal(t, []string{"StormEvents | where State == 'TEXAS'"}, executed)
+	})
+
+	t.Run("Template variables without the query of the browser are downstream errors", func(t *testing.T) {
+		var executed []string
+		adx := newADX(&executed)
+		res := adx.handleQuery(context.Background(), query("", "$state"), nil)
+		require.EqualError(t, res.Error, "invalid query expression: template variables are only replaced by the query editor: $state")
+		require.Equal(t, backend.ErrorSourceDownstream, res.ErrorSource)
+		require.Empty(t, executed)
+	})
+
+	t.Run("Invalid expressions are downstream errors", func(t *testing.T) {
+		var executed []string
+		adx := newADX(&executed)
+		q := query("", "x")
+		q.JSON = []byte(strings.Replace(string(q.JSON), `"name": "=="`, `"name": "== 'x' or 1 =="`, 1))
+		res := adx.handleQuery(context.Background(), q, nil)
+		require.EqualError(t, res.Error, `invalid query expression: unsupported operator "== 'x' or 1 =="`)
+		require.Equal(t, backend.ErrorSourceDownstream, res.ErrorSource)
+		require.Empty(t, executed)
+	})
+}
+
+func partialTableResponse() *models.TableResponse {
+	return &models.TableResponse{
+		Tables: []models.Table{
+			{TableName: "PrimaryResult", TableKind: models.TableKindPrimaryResult, Columns: []models.Column{{ColumnName: "Count", ColumnType: "long"}}, Rows: []models.Row{[]interface{}{json.Number("1")}}},
+		},
+		Exceptions: []string{"Partial query failure: Low memory condition (E_LOW_MEMORY_CONDITION)"},
+	}
+}
+
 func TestTrustedEndpoints(t *testing.T) {
 	tests := []struct {
 		name                      string
@@ -223,3 +523,144 @@ func (c *fakeClient) KustoRequest(_ context.Context, cluster string, url string,
 func (c *fakeClient) ARGClusterRequest(_ context.Context, payload models.ARGRequestPayload, additionalHeaders map[string]string) ([]models.ClusterOption, error) {
 	return ARGClusterRequestMock(payload, additionalHeaders)
 }
+
+func TestQueryDataConcurrency(t *testing.T) {
+	newRequest := func(refIDs ...string) *backend.QueryDataRequest {
+		queries := make([]backend.DataQuery, 0, len(refIDs))
+		for _, refID := range refIDs {
+			queries = append(queries, backend.DataQuery{
+				RefID: refID,
+				JSON:  []byte(fmt.Sprintf(`{"resultFormat": "table","database":"test-database","query":"%s"}`, refID)),
+			})
+		}
+		return &backend.QueryDataRequest{
+			PluginContext: backend.PluginContext{
+				DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{Name: "test-datasource"},
+			},
+			Queries: queries,
+		}
+	}
+
+	t.Run("queries of a request overlap", func(t *testing.T) {
+		client := newConcurrentFakeClient()
+		settings := &models.DatasourceSettings{ClusterURL: "base-url", MaxConcurrentQueries: 4}
+		adx := &AzureDataExplorer{client: client, settings: settings, querySlots: newQuerySlots(settings)}
+
+		done := make(chan *backend.QueryDataResponse)
+		go func() {
+			res, _ := adx.QueryData(context.Background(), newRequest("A", "B", "C", "D"))
+			done <- res
+		}()
+
+		// All four queries must be in flight at the same time before any of them is released.
+		require.Eventually(t, func() bool { return client.inFlight.Load() == 4 }, 5*time.Second, time.Millisecond)
+		close(client.release)
+
+		res := <-done
+		require.Len(t, res.Responses, 4)
+		for _, refID := range []string{"A", "B", "C", "D"} {
+			require.NoError(t, res.Responses[refID].Error)
+		}
+		require.Equal(t, int32(4), client.maxInFlight.Load())
+	})
+
+	t.Run("concurrency is bounded by the datasource limit", func(t *testing.T) {
+		client := newConcurrentFakeClient()
+		close(client.release)
+		client.delay = 20 * time.Millisecond
+		settings := &models.DatasourceSettings{ClusterURL: "base-url", MaxConcurrentQueries: 2}
+		adx := &AzureDataExplorer{client: client, settings: settings, querySlots: newQuerySlots(settings)}
+
+		res, err := adx.QueryData(context.Background(), newRequest("A", "B", "C", "D", "E", "F"))
+		require.NoError(t, err)
+		require.Len(t, res.Responses, 6)
+		require.Equal(t, int32(2), client.maxInFlight.Load())
+		require.Equal(t, int32(6), client.calls.Load())
+	})
+
+	t.Run("concurrency is bounded across the requests of the datasource", func(t *testing.T) {
+		client := newConcurrentFakeClient()
+		close(client.release)
+		client.delay = 20 * time.Millisecond
+		settings := &models.DatasourceSettings{ClusterURL: "base-url", MaxConcurrentQueries: 2}
+		adx := &AzureDataExplorer{client: client, settings: settings, querySlots: newQuerySlots(settings)}
+
+		var wg sync.WaitGroup
+		for _, refIDs := range [][]string{{"A", "B", "C"}, {"D", "E", "F"}} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _ = adx.QueryData(context.Background(), newRequest(refIDs...))
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, int32(2), client.maxInFlight.Load())
+		require.Equal(t, int32(6), client.calls.Load())
+	})
+
+	t.Run("a slow or failing query does not affect the others", func(t *testing.T) {
+		client := newConcurrentFakeClient()
+		client.blockOn = map[string]bool{"slow": true}
+		client.failOn = map[string]bool{"failing": true}
+		settings := &models.DatasourceSettings{ClusterURL: "base-url", MaxConcurrentQueries: 2}
+		adx := &AzureDataExplorer{client: client, settings: settings, querySlots: newQuerySlots(settings)}
+
+		done := make(chan *backend.QueryDataResponse)
+		go func() {
+			res, _ := adx.QueryData(context.Background(), newRequest("slow", "failing", "A", "B"))
+			done <- res
+		}()
+
+		// Everything except the slow query finishes while the slow query still holds a slot.
+		require.Eventually(t, func() bool { return client.completed.Load() == 3 }, 5*time.Second, time.Millisecond)
+		close(client.release)
+
+		res := <-done
+		require.Len(t, res.Responses, 4)
+		require.NoError(t, res.Responses["slow"].Error)
+		require.NoError(t, res.Responses["A"].Error)
+		require.NoError(t, res.Responses["B"].Error)
+		require.Error(t, res.Responses["failing"].Error)
+		require.Equal(t, backend.ErrorSourceDownstream, res.Responses["failing"].ErrorSource)
+	})
+}
+
+// concurrentFakeClient is a thread safe client.AdxClient which records how many
+// Kusto requests are executed at the same time.
+type concurrentFakeClient struct {
+	fakeClient
+	release     chan struct{}
+	delay       time.Duration
+	blockOn     map[string]bool
+	failOn      map[string]bool
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	calls       atomic.Int32
+	completed   atomic.Int32
+}
+
+func newConcurrentFakeClient() *concurrentFakeClient {
+	return &concurrentFakeClient{release: make(chan struct{})}
+}
+
+func (c *concurrentFakeClient) KustoRequest(_ context.Context, _ string, _ string, payload models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+	c.calls.Add(1)
+	current := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	defer c.completed.Add(1)
+	for {
+		max := c.maxInFlight.Load()
+		if current <= max || c.maxInFlight.CompareAndSwap(max, current) {
+			break
+		}
+	}
+
+	if c.failOn[payload.CSL] {
+		return nil, backend.DownstreamError(errors.New("query failed"))
+	}
+	if c.blockOn == nil || c.blockOn[payload.CSL] {
+		<-c.release
+	}
+	time.Sleep(c.delay)
+	return table, nil
+}
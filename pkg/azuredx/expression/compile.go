@@ -0,0 +1,491 @@
+package expression
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dynamicArrayDelimiter stands for any element of an array in the name of a dynamic column, such
+// as Col["`indexer`"]["a"]. Arrays are expanded to a row per element before they are filtered or
+// aggregated.
+const dynamicArrayDelimiter = "[\"`indexer`\"]"
+
+var (
+	// dynamicSelectorRE matches columns that are already quoted or that select dynamic properties,
+	// such as ["a b"] and Col["a"]["b"]
+	dynamicSelectorRE = regexp.MustCompile(`^(?:[A-Za-z_][A-Za-z0-9_]*)?(?:\["(?:[^"\\\n]|\\.)*"\])+$`)
+	identifierRE      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// tableVariableRE matches tables named by a template variable, such as $table and ${table}
+	tableVariableRE = regexp.MustCompile(`^\$(?:\w+|\{\w+(?::\w+)?\})$`)
+	// tableFunctionRE matches the schema mappings that call a function, such as
+	// MyFunction($__timeFrom, 'x', 10)
+	tableFunctionRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\((?:` + tableArgument + `(?:,` + tableArgument + `)*)?\)$`)
+	// variableReferenceRE matches the references to variables in a table name
+	variableReferenceRE = regexp.MustCompile(`\$\{?(\w+)`)
+	numberRE            = regexp.MustCompile(`^-?\d+(\.\d+)?([eE][+-]?\d+)?$`)
+	timeshiftRE         = regexp.MustCompile(`^\d{1,15}(d|h|ms|s|m)?$`)
+	timespanRE          = regexp.MustCompile(`^\d+(\.\d+)?(d|h|m|s|ms|microsecond|tick)?$`)
+	// templateVariableRE matches the values the query editor leaves for the browser to replace:
+	// $var, '$var', ${var} and ${var:format}
+	templateVariableRE = regexp.MustCompile(`^(?:\$(\w+)|'\$(\w+)'|\$\{(\w+)(?::\w+)?\})$`)
+
+	stringEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	columnEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// tableArgument is an argument of a function a schema mapping calls: a variable, an identifier, a
+// number, a timespan or a string.
+const tableArgument = `\s*(?:\$\w+|\$\{\w+(?::\w+)?\}|[A-Za-z_][A-Za-z0-9_]*|-?\d+(?:\.\d+)?[A-Za-z]*|'(?:[^'\\\n]|\\.)*'|"(?:[^"\\\n]|\\.)*")\s*`
+
+// operators are the operators of the filters of the query editor.
+var operators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "=~": true, "!~": true,
+	"in": true, "!in": true, "in~": true, "!in~": true, "has_all": true, "has_any": true,
+	"contains": true, "!contains": true, "contains_cs": true, "!contains_cs": true,
+	"startswith": true, "!startswith": true, "startswith_cs": true, "!startswith_cs": true,
+	"endswith": true, "!endswith": true, "endswith_cs": true, "!endswith_cs": true,
+	"has": true, "!has": true, "has_cs": true, "!has_cs": true,
+	"hasprefix": true, "!hasprefix": true, "hasprefix_cs": true, "!hasprefix_cs": true,
+	"hassuffix": true, "!hassuffix": true, "hassuffix_cs": true, "!hassuffix_cs": true,
+	"matches regex": true, "and": true, "or": true, "isnotempty": true,
+}
+
+// Result is a compiled query expression.
+type Result struct {
+	// Query is the KQL of the expression. Its macros are interpolated like those of any query.
+	Query string
+	// Unresolved lists what the query refers to that only the query editor can resolve: template
+	// variables, which the browser replaces, and dynamic columns missing from the columns given to
+	// Compile, which the editor casts to their type.
+	Unresolved []string
+	// Variables lists the template variables of Unresolved, without which the query cannot run.
+	Variables []string
+}
+
+type compiler struct {
+	columns []Column
+	// timeColumn is the time column the query is filtered and ordered by, escaped, or cast to
+	// datetime when it is dynamic.
+	timeColumn string
+	unresolved []string
+	variables  []string
+}
+
+// Compile compiles a query expression to KQL, the way the query editor does. columns are the
+// columns of the table it queries from, which pick the time column the query is filtered and
+// ordered by. Names and values are quoted, so they cannot change the meaning of the query, and
+// operators, functions and intervals must be ones the query editor offers.
+func Compile(e QueryExpression, columns []Column) (Result, error) {
+	if e.From == nil || e.From.Property == nil || e.From.Property.Name == "" {
+		return Result{}, nil
+	}
+
+	var projected []string
+	if e.Columns != nil {
+		projected = e.Columns.Columns
+	}
+	c := &compiler{columns: columns}
+	c.timeColumn = c.defaultTimeColumn(filterColumns(columns, projected), e.GroupBy)
+
+	parts := []string{c.formatTable(e.From.Property.Name)}
+	if len(projected) > 0 {
+		escaped := make([]string, 0, len(projected))
+		for _, column := range projected {
+			escaped = append(escaped, escapeColumn(column))
+		}
+		parts = append(parts, "project "+strings.Join(escaped, ", "))
+	}
+	timeshift := c.timeshift(e.Timeshift)
+	c.appendTimeFilter(&parts, timeshift)
+	if err := c.appendWhere(&e.Where, &parts, "where", &[]string{}); err != nil {
+		return Result{}, err
+	}
+	if timeshift != "" {
+		parts = append(parts, fmt.Sprintf("extend %s = %s + %s", c.timeColumn, c.timeColumn, timeshift))
+	}
+	if err := c.appendSummarize(e.Reduce, e.GroupBy, &parts); err != nil {
+		return Result{}, err
+	}
+	c.appendOrderBy(e.Reduce, e.GroupBy, &parts)
+
+	return Result{Query: strings.Join(parts, "\n| "), Unresolved: c.unresolved, Variables: c.variables}, nil
+}
+
+func (c *compiler) timeshift(e *Expression) string {
+	if e == nil || e.Property == nil || c.timeColumn == "" || !timeshiftRE.MatchString(e.Property.Name) {
+		return ""
+	}
+	return e.Property.Name
+}
+
+func (c *compiler) appendTimeFilter(parts *[]string, timeshift string) {
+	if c.timeColumn == "" {
+		return
+	}
+	column := c.timeColumn
+	switch {
+	case timeshift != "":
+		*parts = append(*parts, fmt.Sprintf("where %s between (($__timeFrom - %s) .. ($__timeTo - %s))", column, timeshift, timeshift))
+	case strings.Contains(c.timeColumn, "todatetime"):
+		*parts = append(*parts, fmt.Sprintf("where %s between ($__timeFrom .. $__timeTo)", column))
+	default:
+		*parts = append(*parts, fmt.Sprintf("where $__timeFilter(%s)", column))
+	}
+}
+
+// appendWhere appends the filters of e. The arrays of the dynamic columns they filter on are
+// expanded by the "or" filters that contain them.
+func (c *compiler) appendWhere(e *Expression, parts *[]string, prefix string, expand *[]string) error {
+	switch e.Type {
+	case TypeAnd:
+		for i := range e.Expressions {
+			if err := c.appendWhere(&e.Expressions[i], parts, prefix, expand); err != nil {
+				return err
+			}
+		}
+	case TypeOr:
+		var or []string
+		for i := range e.Expressions {
+			if err := c.appendWhere(&e.Expressions[i], &or, "", expand); err != nil {
+				return err
+			}
+		}
+		if len(or) == 0 {
+			return nil
+		}
+		appendMvExpand(*expand, parts)
+		*parts = append(*parts, "where "+strings.Join(or, " or "))
+		if len(*expand) > 0 {
+			// mv-expand adds columns that are not part of the result
+			columns := make([]string, 0, len(*expand))
+			for i := range *expand {
+				columns = append(columns, fmt.Sprintf("array_%d", i+1))
+			}
+			*parts = append(*parts, "project-away "+strings.Join(columns, ", "))
+		}
+	case TypeOperator:
+		return c.appendOperator(e, parts, prefix, expand)
+	}
+	return nil
+}
+
+func (c *compiler) appendOperator(e *Expression, parts *[]string, prefix string, expand *[]string) error {
+	if e.Property == nil || e.Operator == nil || e.Property.Name == "" || e.Operator.Name == "" {
+		return nil
+	}
+	if !operators[e.Operator.Name] {
+		return fmt.Errorf("unsupported operator %q", e.Operator.Name)
+	}
+	column := escapeColumn(e.Property.Name)
+	if e.Operator.Name == "isnotempty" {
+		*parts = append(*parts, withPrefix(fmt.Sprintf("isnotempty(%s)", column), prefix))
+		return nil
+	}
+	value, err := c.formatValue(e.Operator.Value, e.Property.Type)
+	if err != nil {
+		return fmt.Errorf("invalid value of the filter on %s: %w", e.Property.Name, err)
+	}
+	*parts = append(*parts, withPrefix(fmt.Sprintf("%s %s %s", expandArrays(column, expand), e.Operator.Name, value), prefix))
+	return nil
+}
+
+func (c *compiler) appendSummarize(reduce Expression, groupBy Expression, parts *[]string) error {
+	var reduceParts, groupByParts, columns, expand []string
+	countAdded := false
+
+	for _, r := range reduce.Expressions {
+		if r.Type != TypeReduce || r.Property == nil || r.Reduce == nil {
+			continue
+		}
+		function := r.Reduce.Name
+		if !identifierRE.MatchString(function) {
+			return fmt.Errorf("unsupported aggregation function %q", function)
+		}
+		column := c.castIfDynamic(expandArrays(r.Property.Name, &expand), r.Property.Name)
+		columns = append(columns, column)
+
+		switch {
+		case r.Parameters != nil:
+			params := make([]string, 0, len(r.Parameters))
+			for _, p := range r.Parameters {
+				value, err := c.formatValue(p.Value, p.FieldType)
+				if err != nil {
+					return fmt.Errorf("invalid parameter of %s: %w", function, err)
+				}
+				params = append(params, value)
+			}
+			reduceParts = append(reduceParts, fmt.Sprintf("%s(%s, %s)", function, column, strings.Join(params, ", ")))
+		case function == "count":
+			if !countAdded {
+				countAdded = true
+				reduceParts = append(reduceParts, "count()")
+			}
+		case function != "none":
+			reduceParts = append(reduceParts, fmt.Sprintf("%s(%s)", function, column))
+		}
+	}
+
+	for _, g := range groupBy.Expressions {
+		if g.Type != TypeGroupBy || g.Property == nil {
+			continue
+		}
+		column := c.castIfDynamic(expandArrays(g.Property.Name, &expand), g.Property.Name)
+		if g.Interval == nil {
+			groupByParts = append(groupByParts, column)
+			continue
+		}
+		interval, err := c.formatInterval(g.Interval.Name)
+		if err != nil {
+			return err
+		}
+		groupByParts = append([]string{fmt.Sprintf("bin(%s, %s)", column, interval)}, groupByParts...)
+	}
+
+	appendMvExpand(expand, parts)
+	switch {
+	case len(reduceParts) > 0 && len(groupByParts) > 0:
+		*parts = append(*parts, fmt.Sprintf("summarize %s by %s", strings.Join(reduceParts, ", "), strings.Join(groupByParts, ", ")))
+	case len(reduceParts) > 0:
+		*parts = append(*parts, "summarize "+strings.Join(reduceParts, ", "))
+	case len(groupByParts) > 0:
+		*parts = append(*parts, "summarize by "+strings.Join(groupByParts, ", "))
+	case len(columns) > 0:
+		*parts = append(*parts, "project "+strings.Join(columns, ", "))
+	}
+	return nil
+}
+
+// appendOrderBy orders the rows by time, unless they are aggregated otherwise than in time bins.
+func (c *compiler) appendOrderBy(reduce Expression, groupBy Expression, parts *[]string) {
+	if c.timeColumn == "" {
+		return
+	}
+	ordered := len(reduce.Expressions) == 0 && len(groupBy.Expressions) == 0
+	for _, g := range groupBy.Expressions {
+		if g.Type == TypeGroupBy && g.Interval != nil {
+			ordered = true
+		}
+	}
+	if ordered {
+		*parts = append(*parts, fmt.Sprintf("order by %s asc", c.timeColumn))
+	}
+}
+
+// defaultTimeColumn returns the column binned by a time group by, or else the first datetime column,
+// preferring the columns that are not dynamic.
+func (c *compiler) defaultTimeColumn(columns []Column, groupBy Expression) string {
+	for _, g := range groupBy.Expressions {
+		if g.Type == TypeGroupBy && g.Property != nil && g.Property.Type == PropertyTypeDateTime && g.Interval != nil {
+			return c.castIfDynamicIn(columns, g.Property.Name, "")
+		}
+	}
+	var dynamic *Column
+	for i, column := range columns {
+		if column.CslType != "datetime" {
+			continue
+		}
+		if !strings.Contains(column.Name, "[") {
+			return escapeColumn(column.Name)
+		}
+		if dynamic == nil {
+			dynamic = &columns[i]
+		}
+	}
+	if dynamic == nil {
+		return ""
+	}
+	return toType(dynamic.CslType, dynamic.Name)
+}
+
+// castIfDynamic escapes a column, and casts it to its type if it is a dynamic column. name is the
+// name the column has in the schema, if it differs because its arrays are expanded.
+func (c *compiler) castIfDynamic(column string, name string) string {
+	return c.castIfDynamicIn(c.columns, column, name)
+}
+
+func (c *compiler) castIfDynamicIn(columns []Column, column string, name string) string {
+	if name == "" {
+		name = column
+	}
+	for _, s := range columns {
+		if s.Name != name {
+			continue
+		}
+		if s.IsDynamic {
+			return toType(s.CslType, column)
+		}
+		return escapeColumn(column)
+	}
+	if strings.Contains(name, "[") {
+		c.unresolved = append(c.unresolved, name)
+	}
+	return escapeColumn(column)
+}
+
+// formatValue writes a value compared with, or passed to a function with, a property of type t.
+func (c *compiler) formatValue(value any, t PropertyType) (string, error) {
+	switch v := value.(type) {
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			formatted, err := c.formatValue(item, t)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, formatted)
+		}
+		return "(" + strings.Join(values, ", ") + ")", nil
+	case map[string]any:
+		value = v["value"]
+	}
+
+	if s, ok := value.(string); ok && isTemplateVariable(s) {
+		c.addVariable(s)
+		return s, nil
+	}
+	s := formatScalar(value)
+	switch t {
+	case PropertyTypeNumber:
+		if !numberRE.MatchString(s) {
+			return "", fmt.Errorf("%q is not a number", s)
+		}
+		return s, nil
+	case PropertyTypeBoolean:
+		if s != "true" && s != "false" {
+			return "", fmt.Errorf("%q is not a boolean", s)
+		}
+		return s, nil
+	case PropertyTypeDateTime:
+		return fmt.Sprintf("datetime(%s)", quoteString(s)), nil
+	case PropertyTypeTimeSpan:
+		return fmt.Sprintf("timespan(%s)", quoteString(s)), nil
+	default:
+		return quoteString(s), nil
+	}
+}
+
+// formatInterval checks the interval of a time group by, which is a timespan, a macro such as
+// $__timeInterval, or a template variable.
+func (c *compiler) formatInterval(interval string) (string, error) {
+	switch {
+	case strings.HasPrefix(interval, "$__") && identifierRE.MatchString(interval[1:]):
+		return interval, nil
+	case isTemplateVariable(interval):
+		c.addVariable(interval)
+		return interval, nil
+	case timespanRE.MatchString(interval):
+		return interval, nil
+	}
+	return "", fmt.Errorf("unsupported interval %q", interval)
+}
+
+func formatScalar(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// addVariable adds a value or name that refers to template variables, which the browser replaces.
+func (c *compiler) addVariable(value string) {
+	c.unresolved = append(c.unresolved, value)
+	c.variables = append(c.variables, value)
+}
+
+// isTemplateVariable reports whether a value is a template variable rather than a global variable
+// such as $__timeFrom, which the query editor leaves unquoted.
+func isTemplateVariable(value string) bool {
+	m := templateVariableRE.FindStringSubmatch(value)
+	if m == nil {
+		return false
+	}
+	name := m[1] + m[2] + m[3]
+	return !strings.HasPrefix(name, "__")
+}
+
+// expandArrays replaces the arrays of a dynamic column by the columns their elements are expanded
+// to, array_1 for the first array expanded by the query and so on, and adds the arrays to expand.
+func expandArrays(column string, expand *[]string) string {
+	for strings.Contains(column, dynamicArrayDelimiter) {
+		array, _, _ := strings.Cut(column, dynamicArrayDelimiter)
+		*expand = append(*expand, array)
+		column = strings.Replace(column, array+dynamicArrayDelimiter, fmt.Sprintf("array_%d", len(*expand)), 1)
+	}
+	return column
+}
+
+func appendMvExpand(expand []string, parts *[]string) {
+	for i, array := range expand {
+		*parts = append(*parts, fmt.Sprintf("mv-expand array_%d = %s", i+1, escapeColumn(array)))
+	}
+}
+
+// filterColumns returns the columns projected by a query, with the dynamic columns under them. No
+// projected columns means all columns.
+func filterColumns(columns []Column, projected []string) []Column {
+	if len(projected) == 0 {
+		return columns
+	}
+	var filtered []Column
+	for _, c := range columns {
+		name, _, _ := strings.Cut(c.Name, "[")
+		for _, p := range projected {
+			if p == name {
+				filtered = append(filtered, c)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// formatTable quotes the name of a table unless it is an identifier, a template variable or a schema
+// mapping that calls a function. Template variables are left for the browser to replace.
+func (c *compiler) formatTable(name string) string {
+	switch {
+	case identifierRE.MatchString(name):
+		return name
+	case tableVariableRE.MatchString(name) || tableFunctionRE.MatchString(name):
+		for _, m := range variableReferenceRE.FindAllStringSubmatch(name, -1) {
+			if !strings.HasPrefix(m[1], "__") {
+				c.addVariable(name)
+				break
+			}
+		}
+		return name
+	}
+	return "['" + stringEscaper.Replace(name) + "']"
+}
+
+// escapeColumn quotes a column, unless it is already quoted or selects a dynamic property.
+func escapeColumn(column string) string {
+	if dynamicSelectorRE.MatchString(column) {
+		return column
+	}
+	return `["` + columnEscaper.Replace(column) + `"]`
+}
+
+func toType(cslType string, column string) string {
+	return fmt.Sprintf("to%s(%s)", cslType, escapeColumn(column))
+}
+
+func quoteString(s string) string {
+	return "'" + stringEscaper.Replace(s) + "'"
+}
+
+func withPrefix(value string, prefix string) string {
+	if prefix == "" {
+		return value
+	}
+	return prefix + " " + value
+}
@@ -0,0 +1,123 @@
+package expression
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The golden queries of testdata/golden.json are the ones the query editor compiles the same
+// expressions to, as tested by src/KustoExpressionParser.test.ts.
+func TestCompile(t *testing.T) {
+	raw, err := os.ReadFile("testdata/golden.json")
+	require.NoError(t, err)
+	var cases []struct {
+		Name       string          `json:"name"`
+		Expression QueryExpression `json:"expression"`
+		Columns    []Column        `json:"columns"`
+		Query      string          `json:"query"`
+		Unresolved []string        `json:"unresolved"`
+	}
+	require.NoError(t, json.Unmarshal(raw, &cases))
+	require.NotEmpty(t, cases)
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			result, err := Compile(tt.Expression, tt.Columns)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Query, result.Query)
+			assert.Equal(t, tt.Unresolved, result.Unresolved)
+		})
+	}
+}
+
+func TestCompileWithoutTable(t *testing.T) {
+	result, err := Compile(QueryExpression{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Result{}, result)
+}
+
+func TestCompileUnresolvedDynamicColumns(t *testing.T) {
+	e := QueryExpression{
+		From:    &Expression{Type: TypeProperty, Property: &Property{Name: "T"}},
+		GroupBy: Expression{Type: TypeAnd, Expressions: []Expression{{Type: TypeGroupBy, Property: &Property{Name: `Props["kind"]`}}}},
+	}
+	result, err := Compile(e, []Column{{Name: "Props", CslType: "dynamic"}})
+	require.NoError(t, err)
+	assert.Equal(t, "T\n| summarize by Props[\"kind\"]", result.Query)
+	assert.Equal(t, []string{`Props["kind"]`}, result.Unresolved)
+	assert.Empty(t, result.Variables)
+}
+
+func TestCompileVariables(t *testing.T) {
+	e := QueryExpression{
+		From: &Expression{Type: TypeProperty, Property: &Property{Name: "MyFunction($__timeFrom, $table)"}},
+		Where: Expression{Type: TypeAnd, Expressions: []Expression{{
+			Type:     TypeOperator,
+			Property: &Property{Name: `Props["kind"]`, Type: PropertyTypeString},
+			Operator: &Operator{Name: "in", Value: "${kinds:singlequote}"},
+		}}},
+	}
+	result, err := Compile(e, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"MyFunction($__timeFrom, $table)", "${kinds:singlequote}"}, result.Variables)
+}
+
+func TestCompileErrors(t *testing.T) {
+	from := &Expression{Type: TypeProperty, Property: &Property{Name: "T"}}
+	filter := func(name string, t PropertyType, operator string, value any) Expression {
+		return Expression{Type: TypeAnd, Expressions: []Expression{{
+			Type:     TypeOperator,
+			Property: &Property{Name: name, Type: t},
+			Operator: &Operator{Name: operator, Value: value},
+		}}}
+	}
+	tests := []struct {
+		name       string
+		expression QueryExpression
+		err        string
+	}{
+		{
+			name:       "unsupported operator",
+			expression: QueryExpression{From: from, Where: filter("a", PropertyTypeString, "== 'x' or 1 ==", "x")},
+			err:        `unsupported operator "== 'x' or 1 =="`,
+		},
+		{
+			name:       "number that is not a number",
+			expression: QueryExpression{From: from, Where: filter("a", PropertyTypeNumber, "==", "1 or true")},
+			err:        `invalid value of the filter on a: "1 or true" is not a number`,
+		},
+		{
+			name:       "boolean that is not a boolean",
+			expression: QueryExpression{From: from, Where: filter("a", PropertyTypeBoolean, "==", "yes")},
+			err:        `invalid value of the filter on a: "yes" is not a boolean`,
+		},
+		{
+			name: "unsupported aggregation function",
+			expression: QueryExpression{From: from, Reduce: Expression{Type: TypeAnd, Expressions: []Expression{{
+				Type:     TypeReduce,
+				Property: &Property{Name: "a"},
+				Reduce:   &Property{Name: "sum(a) by b | take"},
+			}}}},
+			err: `unsupported aggregation function "sum(a) by b | take"`,
+		},
+		{
+			name: "unsupported interval",
+			expression: QueryExpression{From: from, GroupBy: Expression{Type: TypeAnd, Expressions: []Expression{{
+				Type:     TypeGroupBy,
+				Property: &Property{Name: "t", Type: PropertyTypeDateTime},
+				Interval: &Property{Name: "1h) | take 1 //"},
+			}}}},
+			err: `unsupported interval "1h) | take 1 //"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.expression, nil)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
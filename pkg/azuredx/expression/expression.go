@@ -0,0 +1,86 @@
+// Package expression compiles the queries of the visual query editor, which the editor saves as
+// an expression tree next to the KQL it compiled them to, so queries run the same whether or not
+// their KQL is up to date.
+package expression
+
+// Type is the kind of a node of an expression tree.
+type Type string
+
+const (
+	TypeProperty          Type = "property"
+	TypeOperator          Type = "operator"
+	TypeReduce            Type = "reduce"
+	TypeFunctionParameter Type = "functionParameter"
+	TypeGroupBy           Type = "groupBy"
+	TypeOr                Type = "or"
+	TypeAnd               Type = "and"
+)
+
+// PropertyType is the type of a property, which picks how the values compared with it are written.
+type PropertyType string
+
+const (
+	PropertyTypeNumber   PropertyType = "number"
+	PropertyTypeString   PropertyType = "string"
+	PropertyTypeBoolean  PropertyType = "boolean"
+	PropertyTypeDateTime PropertyType = "dateTime"
+	PropertyTypeTimeSpan PropertyType = "timeSpan"
+	PropertyTypeFunction PropertyType = "function"
+	PropertyTypeInterval PropertyType = "interval"
+)
+
+// QueryExpression is the query of the visual query editor: the table it queries from, the columns
+// it projects, its filters and its aggregations.
+type QueryExpression struct {
+	From      *Expression `json:"from,omitempty"`
+	Columns   *Expression `json:"columns,omitempty"`
+	Where     Expression  `json:"where"`
+	Reduce    Expression  `json:"reduce"`
+	GroupBy   Expression  `json:"groupBy"`
+	Timeshift *Expression `json:"timeshift,omitempty"`
+}
+
+// Expression is a node of an expression tree. Which fields are set depends on its type: "and" and
+// "or" nodes hold Expressions, "operator" nodes compare Property with Operator, "reduce" nodes
+// aggregate Property with the function Reduce, and "groupBy" nodes group by Property, in bins of
+// Interval when set.
+type Expression struct {
+	Type        Type                `json:"type"`
+	Property    *Property           `json:"property,omitempty"`
+	Operator    *Operator           `json:"operator,omitempty"`
+	Reduce      *Property           `json:"reduce,omitempty"`
+	Parameters  []FunctionParameter `json:"parameters,omitempty"`
+	Interval    *Property           `json:"interval,omitempty"`
+	Columns     []string            `json:"columns,omitempty"`
+	Expressions []Expression        `json:"expressions,omitempty"`
+}
+
+// Property is a column, function or interval, by name.
+type Property struct {
+	Name string       `json:"name"`
+	Type PropertyType `json:"type"`
+}
+
+// Operator is a comparison operator and the value it compares with. The value is a string, number
+// or boolean, an option of the editor holding one in its "value" key, or a list of them.
+type Operator struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+}
+
+// FunctionParameter is an extra parameter of an aggregation function, such as the percentile of
+// percentile().
+type FunctionParameter struct {
+	Name      string       `json:"name"`
+	Value     any          `json:"value"`
+	FieldType PropertyType `json:"fieldType"`
+}
+
+// Column is a column of the table a query expression queries from, as the query editor describes
+// it. Dynamic columns are the properties of columns of type dynamic, such as Col["a"]["b"], which
+// are cast to their type when aggregated.
+type Column struct {
+	Name      string `json:"Name"`
+	CslType   string `json:"CslType"`
+	IsDynamic bool   `json:"isDynamic,omitempty"`
+}
@@ -44,3 +44,49 @@ func HandleResponseBodyClose(resp *http.Response) {
 		backend.Logger.Warn("Error closing response body: %s", err.Error())
 	}
 }
+
+// ClusterHost returns the host of a cluster URI, so it can label metrics without leaking paths or
+// credentials the URI may contain.
+func ClusterHost(clusterUri string) string {
+	parsedUrl, err := url.Parse(clusterUri)
+	if err != nil || parsedUrl.Host == "" {
+		return "unknown"
+	}
+	return strings.ToLower(parsedUrl.Hostname())
+}
+
+// MetricsCluster returns the cluster label of the metrics of a request to clusterUri: the host of the
+// cluster configured in the datasource, or "other" for the clusters picked in queries, so that
+// queries cannot add series without bound.
+func MetricsCluster(clusterUri string, configured string) string {
+	host := ClusterHost(clusterUri)
+	if host == "unknown" || host != ClusterHost(configured) {
+		return "other"
+	}
+	return host
+}
+
+// metricsSources are the query sources that label metrics. Other sources are labelled "other", as
+// the source of a query is set by its client.
+var metricsSources = map[string]bool{
+	"raw": true, "visual": true, "schema": true, "autocomplete": true, "openai": true, "arg": true, "unspecified": true,
+}
+
+// MetricsSource returns the source label of the metrics of a query sent from source.
+func MetricsSource(source string) string {
+	if source == "" {
+		return "unspecified"
+	}
+	if !metricsSources[source] {
+		return "other"
+	}
+	return source
+}
+
+// ErrorSource returns the source of err, which is the plugin unless err says otherwise.
+func ErrorSource(err error) backend.ErrorSource {
+	if backend.IsDownstreamError(err) {
+		return backend.ErrorSourceDownstream
+	}
+	return backend.ErrorSourcePlugin
+}
@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"context"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes of the spans around the lifecycle of a query.
+const (
+	AttributeCluster         = attribute.Key("adx.cluster")
+	AttributeDatabase        = attribute.Key("adx.database")
+	AttributeClientRequestID = attribute.Key("adx.client_request_id")
+	AttributeQuerySource     = attribute.Key("adx.query_source")
+	AttributeEndpoint        = attribute.Key("adx.endpoint")
+	AttributeFormat          = attribute.Key("adx.format")
+	AttributeStatusCode      = attribute.Key("http.response.status_code")
+	AttributeRows            = attribute.Key("adx.rows")
+	AttributeFrames          = attribute.Key("adx.frames")
+)
+
+// StartSpan starts a span with the tracer of the plugin, as a child of the span in ctx.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.DefaultTracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records err, if any, on span and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		_ = tracing.Error(span, err)
+	}
+	span.End()
+}
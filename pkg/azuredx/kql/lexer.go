@@ -0,0 +1,194 @@
+// Package kql holds a lightweight tokenizer and validator of Kusto Query Language queries, used to
+// report mistakes in a query without sending it to the cluster.
+package kql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind is the kind of a token.
+type Kind int
+
+const (
+	// KindIdentifier is a name, such as a table, a column, a function or a keyword.
+	KindIdentifier Kind = iota
+	// KindQuotedIdentifier is a name quoted as ['name'] or ["name"]. Its Value is the unquoted name.
+	KindQuotedIdentifier
+	// KindString is a string literal, including verbatim, obfuscated and multi-line strings.
+	KindString
+	// KindNumber is a numeric literal, including timespans such as 5m and hexadecimal numbers.
+	KindNumber
+	// KindMacro is a Grafana macro such as $__timeFilter.
+	KindMacro
+	// KindPunctuation is an operator or a bracket.
+	KindPunctuation
+)
+
+// Token is a token of a query. Offset and End are byte offsets in the query.
+type Token struct {
+	Kind   Kind
+	Text   string
+	Value  string
+	Offset int
+	End    int
+}
+
+// Is reports whether the token is the given punctuation or unquoted identifier.
+func (t Token) Is(text string) bool {
+	return (t.Kind == KindPunctuation || t.Kind == KindIdentifier) && t.Text == text
+}
+
+// SyntaxError is an error of the tokenizer at an offset of the query.
+type SyntaxError struct {
+	Offset  int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Message, e.Offset)
+}
+
+// punctuations are the multi-character operators of KQL, longest first.
+var punctuations = []string{"!~", "!=", "==", "=~", "<>", "<=", ">=", "=>", "..", "<|"}
+
+// Tokenize splits a query into tokens, skipping white space and comments. It stops at the first
+// unterminated string or quoted identifier.
+func Tokenize(query string) ([]Token, error) {
+	var tokens []Token
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case strings.HasPrefix(query[i:], "//"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+			continue
+		}
+
+		start := i
+		if end, value, ok, err := lexString(query, i); err != nil {
+			return tokens, err
+		} else if ok {
+			tokens = append(tokens, Token{Kind: KindString, Text: query[start:end], Value: value, Offset: start, End: end})
+			i = end
+			continue
+		}
+
+		switch {
+		case r == '[' && i+1 < len(query) && (query[i+1] == '\'' || query[i+1] == '"'):
+			end, value, _, err := lexString(query, i+1)
+			if err != nil || end >= len(query) || query[end] != ']' {
+				return tokens, &SyntaxError{Offset: start, Message: "unterminated quoted identifier"}
+			}
+			tokens = append(tokens, Token{Kind: KindQuotedIdentifier, Text: query[start : end+1], Value: value, Offset: start, End: end + 1})
+			i = end + 1
+		case strings.HasPrefix(query[i:], "$__"):
+			end := i + 3
+			for end < len(query) && isIdentifierByte(query[end]) {
+				end++
+			}
+			tokens = append(tokens, Token{Kind: KindMacro, Text: query[start:end], Value: query[start:end], Offset: start, End: end})
+			i = end
+		case r == '_' || r == '$' || unicode.IsLetter(r):
+			end := i + size
+			for end < len(query) {
+				r, size := utf8.DecodeRuneInString(query[end:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				end += size
+			}
+			tokens = append(tokens, Token{Kind: KindIdentifier, Text: query[start:end], Value: query[start:end], Offset: start, End: end})
+			i = end
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(query) && isDigit(query[i+1])):
+			end := i + 1
+			for end < len(query) && (isIdentifierByte(query[end]) || query[end] == '.' && !strings.HasPrefix(query[end:], "..")) {
+				// exponents, such as 1e-5, carry a sign
+				if (query[end] == 'e' || query[end] == 'E') && end+1 < len(query) && (query[end+1] == '-' || query[end+1] == '+') {
+					end++
+				}
+				end++
+			}
+			tokens = append(tokens, Token{Kind: KindNumber, Text: query[start:end], Value: query[start:end], Offset: start, End: end})
+			i = end
+		default:
+			end := i + size
+			for _, p := range punctuations {
+				if strings.HasPrefix(query[i:], p) {
+					end = i + len(p)
+					break
+				}
+			}
+			tokens = append(tokens, Token{Kind: KindPunctuation, Text: query[start:end], Value: query[start:end], Offset: start, End: end})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// lexString reads the string literal starting at offset i, if there is one, and returns the offset
+// after it and its value.
+// https://learn.microsoft.com/en-us/kusto/query/scalar-data-types/string
+func lexString(query string, i int) (end int, value string, ok bool, err error) {
+	start := i
+	for _, fence := range []string{"```", "~~~"} {
+		if strings.HasPrefix(query[i:], fence) {
+			closing := strings.Index(query[i+3:], fence)
+			if closing < 0 {
+				return 0, "", false, &SyntaxError{Offset: start, Message: "unterminated multi-line string"}
+			}
+			return i + 3 + closing + 3, query[i+3 : i+3+closing], true, nil
+		}
+	}
+
+	// obfuscated strings are prefixed with h, verbatim strings with @
+	if i < len(query) && (query[i] == 'h' || query[i] == 'H') && i+1 < len(query) && (query[i+1] == '\'' || query[i+1] == '"' || query[i+1] == '@') {
+		i++
+	}
+	verbatim := false
+	if i < len(query) && query[i] == '@' && i+1 < len(query) && (query[i+1] == '\'' || query[i+1] == '"') {
+		verbatim = true
+		i++
+	}
+	if i >= len(query) || (query[i] != '\'' && query[i] != '"') {
+		return 0, "", false, nil
+	}
+
+	quote := query[i]
+	var b strings.Builder
+	for j := i + 1; j < len(query); j++ {
+		c := query[j]
+		switch {
+		case c == quote && verbatim && j+1 < len(query) && query[j+1] == quote:
+			// a doubled quote is a quote in verbatim strings
+			b.WriteByte(quote)
+			j++
+		case c == quote:
+			return j + 1, b.String(), true, nil
+		case c == '\\' && !verbatim && j+1 < len(query):
+			b.WriteByte(query[j+1])
+			j++
+		case c == '\n':
+			return 0, "", false, &SyntaxError{Offset: start, Message: "unterminated string literal"}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return 0, "", false, &SyntaxError{Offset: start, Message: "unterminated string literal"}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
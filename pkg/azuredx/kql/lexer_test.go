@@ -0,0 +1,92 @@
+package kql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		kinds  []Kind
+		values []string
+	}{
+		{
+			name:   "pipeline",
+			query:  "StormEvents | where State == 'TEXAS'",
+			kinds:  []Kind{KindIdentifier, KindPunctuation, KindIdentifier, KindIdentifier, KindPunctuation, KindString},
+			values: []string{"StormEvents", "|", "where", "State", "==", "TEXAS"},
+		},
+		{
+			name:   "comments are skipped",
+			query:  "T // a comment with a ' quote\n| take 10",
+			kinds:  []Kind{KindIdentifier, KindPunctuation, KindIdentifier, KindNumber},
+			values: []string{"T", "|", "take", "10"},
+		},
+		{
+			name:   "quoted identifiers",
+			query:  `['my table'] | project ["a b"]`,
+			kinds:  []Kind{KindQuotedIdentifier, KindPunctuation, KindIdentifier, KindQuotedIdentifier},
+			values: []string{"my table", "|", "project", "a b"},
+		},
+		{
+			name:   "macros",
+			query:  "T | where $__timeFilter(Timestamp) | summarize by bin(Timestamp, $__timeInterval)",
+			kinds:  []Kind{KindIdentifier, KindPunctuation, KindIdentifier, KindMacro, KindPunctuation, KindIdentifier, KindPunctuation, KindPunctuation, KindIdentifier, KindIdentifier, KindIdentifier, KindPunctuation, KindIdentifier, KindPunctuation, KindMacro, KindPunctuation},
+			values: []string{"T", "|", "where", "$__timeFilter", "(", "Timestamp", ")", "|", "summarize", "by", "bin", "(", "Timestamp", ",", "$__timeInterval", ")"},
+		},
+		{
+			name:   "strings",
+			query:  `'it\'s' @'C:\dir' h"secret" @"say ""hi""" ` + "```multi\nline```",
+			kinds:  []Kind{KindString, KindString, KindString, KindString, KindString},
+			values: []string{"it's", `C:\dir`, "secret", `say "hi"`, "multi\nline"},
+		},
+		{
+			name:   "numbers and operators",
+			query:  "x >= 1.5e-3 and y !~ 'a' and z in (5m, 0x1F) and t between (1 .. 2)",
+			kinds:  []Kind{KindIdentifier, KindPunctuation, KindNumber, KindIdentifier, KindIdentifier, KindPunctuation, KindString, KindIdentifier, KindIdentifier, KindIdentifier, KindPunctuation, KindNumber, KindPunctuation, KindNumber, KindPunctuation, KindIdentifier, KindIdentifier, KindIdentifier, KindPunctuation, KindNumber, KindPunctuation, KindNumber, KindPunctuation},
+			values: []string{"x", ">=", "1.5e-3", "and", "y", "!~", "a", "and", "z", "in", "(", "5m", ",", "0x1F", ")", "and", "t", "between", "(", "1", "..", "2", ")"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := Tokenize(tt.query)
+			require.NoError(t, err)
+			var kinds []Kind
+			var values []string
+			for _, token := range tokens {
+				kinds = append(kinds, token.Kind)
+				values = append(values, token.Value)
+				assert.Equal(t, token.Text, tt.query[token.Offset:token.End])
+			}
+			assert.Equal(t, tt.values, values)
+			assert.Equal(t, tt.kinds, kinds)
+		})
+	}
+}
+
+func TestTokenizeErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		offset  int
+		message string
+	}{
+		{query: "T | where a == 'b", offset: 15, message: "unterminated string literal"},
+		{query: "T | where a == \"b\n\"", offset: 15, message: "unterminated string literal"},
+		{query: "T | project ['a", offset: 12, message: "unterminated quoted identifier"},
+		{query: "T | project ['a'", offset: 12, message: "unterminated quoted identifier"},
+		{query: "print ```a", offset: 6, message: "unterminated multi-line string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Tokenize(tt.query)
+			var syntaxErr *SyntaxError
+			require.ErrorAs(t, err, &syntaxErr)
+			assert.Equal(t, tt.offset, syntaxErr.Offset)
+			assert.Equal(t, tt.message, syntaxErr.Message)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package kql
+
+import (
+	"errors"
+	"strings"
+)
+
+// MacroCall is a macro called by a query, such as $__timeFilter(Timestamp).
+type MacroCall struct {
+	Name string
+	// Offset and End delimit the call in the query, parentheses included.
+	Offset int
+	End    int
+	// Args are the arguments between the parentheses right after the macro. They are nil when the
+	// macro has no parentheses or empty ones.
+	Args []MacroArg
+}
+
+// MacroArg is an argument of a macro call, as written in the query without surrounding spaces.
+type MacroArg struct {
+	Text   string
+	Offset int
+}
+
+// Macros returns the calls of the macros accepted by isMacro, in the order of the query. Macros in
+// string literals and comments are ignored. Arguments are split on the commas that are not nested in
+// brackets or string literals, and may call macros themselves, which are not returned. Only the
+// macros are checked: the rest of the query is left for the cluster to report errors in.
+func Macros(query string, isMacro func(string) bool) ([]MacroCall, error) {
+	tokens := tokenizeAll(query)
+	var calls []MacroCall
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.Kind != KindMacro || !isMacro(t.Value) {
+			continue
+		}
+		call := MacroCall{Name: t.Value, Offset: t.Offset, End: t.End}
+		if i+1 < len(tokens) && tokens[i+1].Is("(") && tokens[i+1].Offset == t.End {
+			open := tokens[i+1]
+			closing := closingParenthesis(tokens, i+1)
+			if closing < 0 {
+				return nil, &SyntaxError{Offset: open.Offset, Message: "'(' is not closed"}
+			}
+			call.Args = macroArgs(query, open, tokens[i+2:closing])
+			call.End = tokens[closing].End
+			i = closing
+		}
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+// tokenizeAll tokenizes the whole query. The quote of an unterminated string or quoted identifier is
+// read as punctuation, so the macros after it are still found.
+func tokenizeAll(query string) []Token {
+	var tokens []Token
+	offset := 0
+	for {
+		lexed, err := Tokenize(query[offset:])
+		for _, t := range lexed {
+			t.Offset, t.End = t.Offset+offset, t.End+offset
+			tokens = append(tokens, t)
+		}
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			return tokens
+		}
+		start := offset + syntaxErr.Offset
+		tokens = append(tokens, Token{Kind: KindPunctuation, Text: query[start : start+1], Value: query[start : start+1], Offset: start, End: start + 1})
+		offset = start + 1
+	}
+}
+
+// closingParenthesis returns the index of the parenthesis closing the one at open, or -1.
+func closingParenthesis(tokens []Token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch {
+		case tokens[i].Is("("):
+			depth++
+		case tokens[i].Is(")"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// macroArgs reads the arguments of a macro from the tokens between its parentheses.
+func macroArgs(query string, open Token, tokens []Token) []MacroArg {
+	if len(tokens) == 0 {
+		return nil
+	}
+	var args []MacroArg
+	// start is where the next argument begins, right after the previous separator
+	start := open.End
+	for _, arg := range splitTopLevel(tokens, ",") {
+		end := start
+		if len(arg) == 0 {
+			args = append(args, MacroArg{Offset: start})
+		} else {
+			args = append(args, MacroArg{Text: query[arg[0].Offset:arg[len(arg)-1].End], Offset: arg[0].Offset})
+			end = arg[len(arg)-1].End
+		}
+		if comma := strings.IndexByte(query[end:], ','); comma >= 0 {
+			start = end + comma + 1
+		}
+	}
+	return args
+}
+
+// Position returns the 1-based line and column of an offset of the query.
+func Position(query string, offset int) (int, int) {
+	line, column := 1, 1
+	for _, r := range query[:offset] {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
@@ -0,0 +1,123 @@
+package kql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []MacroCall
+	}{
+		{
+			name:  "macros without arguments",
+			query: "T | where t > $__timeFrom and t < $__timeTo()",
+			expected: []MacroCall{
+				{Name: "$__timeFrom", Offset: 14, End: 25},
+				{Name: "$__timeTo", Offset: 34, End: 45},
+			},
+		},
+		{
+			name:  "nested calls and several arguments",
+			query: "T | where $__timeFilter(todatetime(ts / 1000)) | summarize by $__timeBin(t, 1h)",
+			expected: []MacroCall{
+				{Name: "$__timeFilter", Offset: 10, End: 46, Args: []MacroArg{{Text: "todatetime(ts / 1000)", Offset: 24}}},
+				{Name: "$__timeBin", Offset: 62, End: 79, Args: []MacroArg{{Text: "t", Offset: 73}, {Text: "1h", Offset: 76}}},
+			},
+		},
+		{
+			name:  "commas in string literals and brackets",
+			query: "$__timeGroup(['a, b'], 1h, 'x,y')",
+			expected: []MacroCall{
+				{Name: "$__timeGroup", Offset: 0, End: 33, Args: []MacroArg{{Text: "['a, b']", Offset: 13}, {Text: "1h", Offset: 23}, {Text: "'x,y'", Offset: 27}}},
+			},
+		},
+		{
+			name:  "empty arguments",
+			query: "$__timeGroup(t, , 0)",
+			expected: []MacroCall{
+				{Name: "$__timeGroup", Offset: 0, End: 20, Args: []MacroArg{{Text: "t", Offset: 13}, {Text: "", Offset: 15}, {Text: "0", Offset: 18}}},
+			},
+		},
+		{
+			name:  "macros in arguments are part of them",
+			query: "$__timeBin(t, $__timeInterval)",
+			expected: []MacroCall{
+				{Name: "$__timeBin", Offset: 0, End: 30, Args: []MacroArg{{Text: "t", Offset: 11}, {Text: "$__timeInterval", Offset: 14}}},
+			},
+		},
+		{
+			name:  "macros in string literals and comments are ignored",
+			query: "T // $__timeFilter(\n| where msg == '$__timeFrom' and t > $__timeFrom",
+			expected: []MacroCall{
+				{Name: "$__timeFrom", Offset: 57, End: 68},
+			},
+		},
+		{
+			name:  "parentheses after a space are not arguments",
+			query: "$__timeFrom (1)",
+			expected: []MacroCall{
+				{Name: "$__timeFrom", Offset: 0, End: 11},
+			},
+		},
+		{
+			name:  "macros after an unterminated string",
+			query: "T | where s == 'x | where $__timeFilter(t)",
+			expected: []MacroCall{
+				{Name: "$__timeFilter", Offset: 26, End: 42, Args: []MacroArg{{Text: "t", Offset: 40}}},
+			},
+		},
+		{
+			name:  "macros before an unterminated quoted identifier",
+			query: "T | where $__timeFilter(t) | project ['x",
+			expected: []MacroCall{
+				{Name: "$__timeFilter", Offset: 10, End: 26, Args: []MacroArg{{Text: "t", Offset: 24}}},
+			},
+		},
+		{
+			name:  "unknown macros are ignored",
+			query: "$__unknown(x)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, err := Macros(tt.query, isMacro)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, calls)
+		})
+	}
+}
+
+func TestMacrosErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		offset  int
+		message string
+	}{
+		{query: "T | where $__timeFilter(todatetime(ts)", offset: 23, message: "'(' is not closed"},
+		{query: "T | where $__timeFilter(", offset: 23, message: "'(' is not closed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Macros(tt.query, isMacro)
+			var syntaxErr *SyntaxError
+			require.ErrorAs(t, err, &syntaxErr)
+			assert.Equal(t, tt.offset, syntaxErr.Offset)
+			assert.Equal(t, tt.message, syntaxErr.Message)
+		})
+	}
+}
+
+func TestPosition(t *testing.T) {
+	query := "T\n| where x\n| take 1"
+	line, column := Position(query, 0)
+	assert.Equal(t, []int{1, 1}, []int{line, column})
+	line, column = Position(query, 10)
+	assert.Equal(t, []int{2, 9}, []int{line, column})
+	line, column = Position(query, len(query))
+	assert.Equal(t, []int{3, 9}, []int{line, column})
+}
@@ -0,0 +1,462 @@
+package kql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severities of a diagnostic.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a problem found in a query. Line and Column are 1-based, Offset and Length are in
+// bytes of the query.
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+}
+
+// Schema resolves the tables a query may read, which include the functions, materialized views and
+// external tables of the database.
+type Schema interface {
+	// Columns returns the names of the columns of a table, and whether the table exists. A table
+	// whose columns are unknown, such as a function without output columns, returns nil columns.
+	Columns(table string) ([]string, bool)
+}
+
+// Options configures the checks of Validate.
+type Options struct {
+	// Schema is the schema of the database the query runs in. References to tables and columns
+	// are not checked without a schema.
+	Schema Schema
+	// IsMacro reports whether a $__ name is a macro of the datasource. Macros are not checked
+	// when it is nil.
+	IsMacro func(name string) bool
+}
+
+// Validate reports unterminated literals, unbalanced brackets, unknown macros and, when a schema is
+// given, references to tables and columns the schema does not have. Macros are checked in place
+// rather than interpolated, so that positions match the query as it was written.
+func Validate(query string, opts Options) []Diagnostic {
+	v := &validator{query: query, opts: opts, locals: map[string]bool{}}
+
+	tokens, err := Tokenize(query)
+	if err != nil {
+		offset := len(query)
+		message := err.Error()
+		if syntaxErr, ok := err.(*SyntaxError); ok {
+			offset, message = syntaxErr.Offset, syntaxErr.Message
+		}
+		v.report(SeverityError, offset, len(query)-offset, "%s", message)
+		// the rest of the query cannot be split into tokens, but what precedes the error can be
+		// checked
+	}
+	v.tokens = tokens
+
+	balanced := v.checkBrackets()
+	v.checkMacros()
+	if balanced && err == nil && opts.Schema != nil {
+		v.checkReferences()
+	}
+	return v.diagnostics
+}
+
+type validator struct {
+	query       string
+	opts        Options
+	tokens      []Token
+	diagnostics []Diagnostic
+	// locals are the names declared by let statements and query parameters.
+	locals map[string]bool
+}
+
+func (v *validator) report(severity string, offset int, length int, format string, args ...interface{}) {
+	line, column := Position(v.query, offset)
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		Line:     line,
+		Column:   column,
+		Offset:   offset,
+		Length:   length,
+	})
+}
+
+var closingBrackets = map[string]string{")": "(", "]": "[", "}": "{"}
+
+// checkBrackets reports closing brackets without an opening one and brackets left open.
+func (v *validator) checkBrackets() bool {
+	var open []Token
+	balanced := true
+	for _, t := range v.tokens {
+		if t.Kind != KindPunctuation {
+			continue
+		}
+		switch t.Text {
+		case "(", "[", "{":
+			open = append(open, t)
+		case ")", "]", "}":
+			if len(open) == 0 || open[len(open)-1].Text != closingBrackets[t.Text] {
+				v.report(SeverityError, t.Offset, 1, "unexpected '%s'", t.Text)
+				return false
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	for _, t := range open {
+		v.report(SeverityError, t.Offset, 1, "'%s' is not closed", t.Text)
+		balanced = false
+	}
+	return balanced
+}
+
+func (v *validator) checkMacros() {
+	if v.opts.IsMacro == nil {
+		return
+	}
+	for _, t := range v.tokens {
+		if t.Kind == KindMacro && !v.opts.IsMacro(t.Text) {
+			v.report(SeverityError, t.Offset, t.End-t.Offset, "unknown macro %s", t.Text)
+		}
+	}
+}
+
+// checkReferences checks the tables read by every statement of the query and, as long as they
+// can be followed, the columns used by the operators that follow.
+func (v *validator) checkReferences() {
+	for _, statement := range splitTopLevel(v.tokens, ";") {
+		if len(statement) == 0 {
+			continue
+		}
+		first := statement[0]
+		switch {
+		case first.Is("let") && len(statement) > 1:
+			v.locals[statement[1].Value] = true
+			if len(statement) > 3 && statement[2].Is("=") {
+				body := statement[3:]
+				// only tabular bodies are checked, let statements also declare scalars and functions
+				if len(body) > 1 && body[1].Is("|") {
+					v.checkPipeline(body)
+				}
+			}
+		case first.Is("declare"):
+			// declare query_parameters(name:type, ...)
+			for i := 1; i+1 < len(statement); i++ {
+				if statement[i].Kind == KindIdentifier && statement[i+1].Is(":") && (statement[i-1].Is("(") || statement[i-1].Is(",")) {
+					v.locals[statement[i].Value] = true
+				}
+			}
+		case first.Is("set") || first.Is("."):
+		default:
+			v.checkPipeline(statement)
+		}
+	}
+}
+
+// tabularSources are the identifiers that start a tabular expression without naming a table.
+var tabularSources = map[string]bool{
+	"datatable": true, "print": true, "range": true, "union": true, "search": true, "find": true,
+	"evaluate": true, "externaldata": true, "materialize": true, "cluster": true, "database": true,
+	"table": true, "view": true, "external_table": true, "materialized_view": true, "toscalar": true,
+}
+
+// checkPipeline checks a tabular expression: the table it starts with and the operators that
+// follow it, as long as the columns they produce are known.
+func (v *validator) checkPipeline(tokens []Token) {
+	segments := splitTopLevel(tokens, "|")
+	source := segments[0]
+	if len(source) != 1 || (source[0].Kind != KindIdentifier && source[0].Kind != KindQuotedIdentifier) {
+		return
+	}
+	table := source[0]
+	if v.locals[table.Value] || (table.Kind == KindIdentifier && tabularSources[table.Value]) {
+		return
+	}
+	// template variables, such as $table, are only replaced when the query runs
+	if table.Kind == KindIdentifier && strings.HasPrefix(table.Value, "$") {
+		return
+	}
+	columns, ok := v.opts.Schema.Columns(table.Value)
+	if !ok {
+		v.report(SeverityError, table.Offset, table.End-table.Offset, "table '%s' does not exist", table.Value)
+		return
+	}
+
+	known := map[string]bool{}
+	for _, c := range columns {
+		known[c] = true
+	}
+	for _, segment := range segments[1:] {
+		v.checkJoins(segment)
+		if columns == nil {
+			continue
+		}
+		if !v.checkOperator(table.Value, known, segment) {
+			columns = nil
+		}
+	}
+}
+
+// checkJoins checks the tables of the sub-queries of join and lookup operators.
+func (v *validator) checkJoins(segment []Token) {
+	if len(segment) == 0 || !(segment[0].Is("join") || segment[0].Is("lookup")) {
+		return
+	}
+	for i := 1; i < len(segment); i++ {
+		if segment[i].Is("on") {
+			return
+		}
+		if segment[i].Is("(") {
+			end := matchingBracket(segment, i)
+			v.checkPipeline(segment[i+1 : end])
+			return
+		}
+		if i+1 < len(segment) && segment[i+1].Is("=") {
+			// hints such as kind=inner
+			i += 2
+			continue
+		}
+		if segment[i].Kind == KindIdentifier || segment[i].Kind == KindQuotedIdentifier {
+			v.checkPipeline(segment[i : i+1])
+			return
+		}
+	}
+}
+
+// checkOperator checks the columns used by an operator and updates the known columns with the ones
+// it produces. It returns false when the columns after the operator cannot be known.
+func (v *validator) checkOperator(table string, known map[string]bool, segment []Token) bool {
+	if len(segment) == 0 {
+		return false
+	}
+	name, args := operatorName(segment)
+	switch name {
+	case "where", "filter":
+		v.checkExpression(table, known, args)
+	case "take", "limit", "sample", "count", "getschema":
+		return name == "take" || name == "limit" || name == "sample"
+	case "sort", "order", "top":
+		// sort by a asc, top 10 by a desc
+		for i, t := range args {
+			if t.Is("by") {
+				v.checkExpression(table, known, args[i+1:])
+				break
+			}
+		}
+	case "extend":
+		for _, item := range splitTopLevel(args, ",") {
+			if target, expr, ok := assignment(item); ok {
+				v.checkExpression(table, known, expr)
+				known[target] = true
+				continue
+			}
+			v.checkExpression(table, known, item)
+			return false
+		}
+	case "project":
+		projected := map[string]bool{}
+		for _, item := range splitTopLevel(args, ",") {
+			if target, expr, ok := assignment(item); ok {
+				v.checkExpression(table, known, expr)
+				projected[target] = true
+				continue
+			}
+			if len(item) != 1 || !isName(item[0]) {
+				v.checkExpression(table, known, item)
+				return false
+			}
+			v.checkExpression(table, known, item)
+			projected[item[0].Value] = true
+		}
+		replace(known, projected)
+	case "project-away":
+		for _, item := range splitTopLevel(args, ",") {
+			if len(item) != 1 || !isName(item[0]) {
+				// wildcards
+				return false
+			}
+			v.checkExpression(table, known, item)
+			delete(known, item[0].Value)
+		}
+	case "project-rename":
+		for _, item := range splitTopLevel(args, ",") {
+			target, expr, ok := assignment(item)
+			if !ok || len(expr) != 1 || !isName(expr[0]) {
+				return false
+			}
+			v.checkExpression(table, known, expr)
+			delete(known, expr[0].Value)
+			known[target] = true
+		}
+	case "distinct":
+		distinct := map[string]bool{}
+		for _, item := range splitTopLevel(args, ",") {
+			if len(item) != 1 || !isName(item[0]) {
+				return false
+			}
+			v.checkExpression(table, known, item)
+			distinct[item[0].Value] = true
+		}
+		replace(known, distinct)
+	case "summarize":
+		// the columns used by the aggregations and the grouping are checked, but the names of the
+		// aggregations are not followed
+		for _, item := range splitTopLevel(args, ",") {
+			if _, expr, ok := assignment(item); ok {
+				item = expr
+			}
+			for i, t := range item {
+				if t.Is("by") {
+					if _, expr, ok := assignment(item[i+1:]); ok {
+						v.checkExpression(table, known, expr)
+					} else {
+						v.checkExpression(table, known, item[i+1:])
+					}
+					item = item[:i]
+					break
+				}
+			}
+			v.checkExpression(table, known, item)
+		}
+		return false
+	default:
+		return false
+	}
+	return true
+}
+
+// operatorName returns the name of the operator of a pipeline segment, joining the parts of
+// hyphenated names such as project-away, and its arguments.
+func operatorName(segment []Token) (string, []Token) {
+	name := segment[0].Text
+	i := 1
+	for i+1 < len(segment) && segment[i].Is("-") && segment[i].Offset == segment[i-1].End &&
+		segment[i+1].Kind == KindIdentifier && segment[i+1].Offset == segment[i].End {
+		name += "-" + segment[i+1].Text
+		i += 2
+	}
+	return name, segment[i:]
+}
+
+// expressionKeywords are the identifiers of scalar expressions that are not columns.
+var expressionKeywords = map[string]bool{
+	"and": true, "or": true, "not": true, "in": true, "between": true, "by": true, "asc": true,
+	"desc": true, "nulls": true, "first": true, "last": true, "true": true, "false": true,
+	"null": true, "has": true, "has_cs": true, "hasprefix": true, "hasprefix_cs": true,
+	"hassuffix": true, "hassuffix_cs": true, "contains": true, "contains_cs": true,
+	"startswith": true, "startswith_cs": true, "endswith": true, "endswith_cs": true,
+	"matches": true, "regex": true, "has_any": true, "has_all": true, "like": true,
+	"with": true, "on": true, "kind": true, "typeof": true,
+}
+
+// literalFunctions build literals whose arguments are not expressions, such as datetime(2024-01-01).
+var literalFunctions = map[string]bool{
+	"datetime": true, "timespan": true, "time": true, "dynamic": true, "guid": true, "bool": true,
+	"boolean": true, "int": true, "long": true, "real": true, "double": true, "decimal": true,
+	"string": true, "typeof": true,
+}
+
+// checkExpression reports the names used as columns in a scalar expression that are not known.
+func (v *validator) checkExpression(table string, known map[string]bool, tokens []Token) {
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		next := func(text string) bool { return i+1 < len(tokens) && tokens[i+1].Is(text) }
+		switch {
+		case t.Kind == KindMacro:
+			// the argument of a macro is a column, the default column of $__timeFilter() is TimeGenerated
+			if !next("(") {
+				continue
+			}
+			end := matchingBracket(tokens, i+1)
+			if t.Text == "$__timeFilter" && end == i+2 {
+				if !known["TimeGenerated"] {
+					v.report(SeverityWarning, t.Offset, tokens[end].End-t.Offset, "column 'TimeGenerated' used by %s() does not exist in '%s'", t.Text, table)
+				}
+			} else {
+				v.checkExpression(table, known, tokens[i+2:end])
+			}
+			i = end
+		case t.Kind == KindIdentifier && next("("):
+			if literalFunctions[t.Text] {
+				i = matchingBracket(tokens, i+1)
+			}
+		case !isName(t) || (t.Kind == KindIdentifier && (expressionKeywords[t.Text] || strings.HasPrefix(t.Text, "$"))):
+		case i > 0 && (tokens[i-1].Is(".") || tokens[i-1].Is("!")):
+			// properties of dynamic values, and negated operators such as !contains
+		case v.locals[t.Value] || known[t.Value]:
+		default:
+			v.report(SeverityWarning, t.Offset, t.End-t.Offset, "column '%s' does not exist in '%s'", t.Value, table)
+		}
+	}
+}
+
+// splitTopLevel splits tokens on a separator outside of brackets.
+func splitTopLevel(tokens []Token, separator string) [][]Token {
+	var parts [][]Token
+	depth, start := 0, 0
+	for i, t := range tokens {
+		if t.Kind != KindPunctuation {
+			continue
+		}
+		switch t.Text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case separator:
+			if depth == 0 {
+				parts = append(parts, tokens[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, tokens[start:])
+}
+
+// matchingBracket returns the index of the bracket closing the one at open, or the last index
+// when it is not closed.
+func matchingBracket(tokens []Token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		if tokens[i].Kind != KindPunctuation {
+			continue
+		}
+		switch tokens[i].Text {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+// assignment splits `name = expression`.
+func assignment(tokens []Token) (string, []Token, bool) {
+	if len(tokens) > 2 && isName(tokens[0]) && tokens[1].Is("=") {
+		return tokens[0].Value, tokens[2:], true
+	}
+	return "", nil, false
+}
+
+func isName(t Token) bool {
+	return t.Kind == KindIdentifier || t.Kind == KindQuotedIdentifier
+}
+
+func replace(known map[string]bool, columns map[string]bool) {
+	for c := range known {
+		delete(known, c)
+	}
+	for c := range columns {
+		known[c] = true
+	}
+}
@@ -0,0 +1,170 @@
+package kql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSchema map[string][]string
+
+func (s testSchema) Columns(table string) ([]string, bool) {
+	columns, ok := s[table]
+	return columns, ok
+}
+
+var schema = testSchema{
+	"StormEvents": {"StartTime", "State", "EventType", "DamageProperty"},
+	"Logs":        {"TimeGenerated", "Level", "Message"},
+	// a function whose output columns are unknown
+	"MyFunction": nil,
+}
+
+func isMacro(name string) bool {
+	return name == "$__timeFilter" || name == "$__timeFrom" || name == "$__timeTo" || name == "$__timeInterval" || name == "$__timeBin" || name == "$__timeGroup"
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []Diagnostic
+	}{
+		{
+			name:  "valid query",
+			query: "StormEvents\n| where $__timeFilter(StartTime) and State == 'TEXAS'\n| summarize count() by bin(StartTime, $__timeInterval), EventType",
+		},
+		{
+			name:  "unclosed bracket",
+			query: "StormEvents | where State in ('TEXAS'",
+			expected: []Diagnostic{
+				{Severity: SeverityError, Message: "'(' is not closed", Line: 1, Column: 30, Offset: 29, Length: 1},
+			},
+		},
+		{
+			name:  "unexpected bracket",
+			query: "StormEvents\n| where (State == 'TEXAS'))",
+			expected: []Diagnostic{
+				{Severity: SeverityError, Message: "unexpected ')'", Line: 2, Column: 27, Offset: 38, Length: 1},
+			},
+		},
+		{
+			name:  "mismatched brackets",
+			query: "print dynamic([1, 2)]",
+			expected: []Diagnostic{
+				{Severity: SeverityError, Message: "unexpected ')'", Line: 1, Column: 20, Offset: 19, Length: 1},
+			},
+		},
+		{
+			name:  "unterminated string",
+			query: "StormEvents | where State == 'TEXAS",
+			expected: []Diagnostic{
+				{Severity: SeverityError, Message: "unterminated string literal", Line: 1, Column: 30, Offset: 29, Length: 6},
+			},
+		},
+		{
+			name:  "unknown macro",
+			query: "StormEvents | where StartTime > $__timeFom",
+			expected: []Diagnostic{
+				{Severity: SeverityError, Message: "unknown macro $__timeFom", Line: 1, Column: 33, Offset: 32, Length: 10},
+			},
+		},
+		{
+			name:  "unknown table",
+			query: "StormEvent | take 10",
+			expected: []Diagnostic{
+				{Severity: SeverityError, Message: "table 'StormEvent' does not exist", Line: 1, Column: 1, Offset: 0, Length: 10},
+			},
+		},
+		{
+			name:  "unknown column",
+			query: "StormEvents | where Sate == 'TEXAS'",
+			expected: []Diagnostic{
+				{Severity: SeverityWarning, Message: "column 'Sate' does not exist in 'StormEvents'", Line: 1, Column: 21, Offset: 20, Length: 4},
+			},
+		},
+		{
+			name:  "default column of $__timeFilter",
+			query: "StormEvents | where $__timeFilter()",
+			expected: []Diagnostic{
+				{Severity: SeverityWarning, Message: "column 'TimeGenerated' used by $__timeFilter() does not exist in 'StormEvents'", Line: 1, Column: 21, Offset: 20, Length: 15},
+			},
+		},
+		{
+			name:  "columns follow extend, project and project-rename",
+			query: "StormEvents | extend Damage = DamageProperty * 2 | project-rename Where = State | project Damage, Where | where Damage > 0 and State != ''",
+			expected: []Diagnostic{
+				{Severity: SeverityWarning, Message: "column 'State' does not exist in 'StormEvents'", Line: 1, Column: 128, Offset: 127, Length: 5},
+			},
+		},
+		{
+			name:  "project-away removes columns",
+			query: "StormEvents | project-away State | where State == ''",
+			expected: []Diagnostic{
+				{Severity: SeverityWarning, Message: "column 'State' does not exist in 'StormEvents'", Line: 1, Column: 42, Offset: 41, Length: 5},
+			},
+		},
+		{
+			name:  "columns are not followed after summarize",
+			query: "StormEvents | summarize Total = count() by State | where Total > 10",
+		},
+		{
+			name:  "columns of summarize are checked",
+			query: "StormEvents | summarize count() by Stat",
+			expected: []Diagnostic{
+				{Severity: SeverityWarning, Message: "column 'Stat' does not exist in 'StormEvents'", Line: 1, Column: 36, Offset: 35, Length: 4},
+			},
+		},
+		{
+			name:  "literals, functions, dynamic properties and string operators",
+			query: "Logs | where TimeGenerated > datetime(2024-01-01) and Message !contains 'x' and todynamic(Message).a.b == 1 and Level in~ ('a') and TimeGenerated > ago(1h)",
+		},
+		{
+			name:  "let statements and parameters",
+			query: "declare query_parameters(state:string);\nlet window = 1h;\nlet events = StormEvents | where State == state;\nevents | where StartTime > ago(window)",
+		},
+		{
+			name:  "let body with unknown table",
+			query: "let events = Storm | where State == 'x';\nevents",
+			expected: []Diagnostic{
+				{Severity: SeverityError, Message: "table 'Storm' does not exist", Line: 1, Column: 14, Offset: 13, Length: 5},
+			},
+		},
+		{
+			name:  "join sub-queries",
+			query: "StormEvents | join kind=inner (Log | where Level == 'error') on $left.StartTime == $right.TimeGenerated",
+			expected: []Diagnostic{
+				{Severity: SeverityError, Message: "table 'Log' does not exist", Line: 1, Column: 32, Offset: 31, Length: 3},
+			},
+		},
+		{
+			name:  "tabular sources and functions are not checked",
+			query: "union StormEvents, Logs | take 1;\nprint x = 1;\nrange x from 1 to 10 step 1;\nMyFunction | where Anything == 1;\nMyOtherFunction(1) | take 1",
+		},
+		{
+			name:  "quoted table names",
+			query: "['StormEvents'] | where ['State'] == 'TEXAS' | where ['Bad Column'] == 1",
+			expected: []Diagnostic{
+				{Severity: SeverityWarning, Message: "column 'Bad Column' does not exist in 'StormEvents'", Line: 1, Column: 54, Offset: 53, Length: 14},
+			},
+		},
+		{
+			name:  "template variables are not checked",
+			query: "$table | where $column == '$value' and State in (${states:singlequote})",
+		},
+		{
+			name:  "comments are ignored",
+			query: "// StormEvent | where (\nStormEvents | take 10",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Validate(tt.query, Options{Schema: schema, IsMacro: isMacro}))
+		})
+	}
+}
+
+func TestValidateWithoutSchema(t *testing.T) {
+	assert.Nil(t, Validate("UnknownTable | where UnknownColumn == $__timeFrom", Options{IsMacro: isMacro}))
+	assert.Nil(t, Validate("T | where $__anything", Options{}))
+}
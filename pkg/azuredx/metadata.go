@@ -0,0 +1,156 @@
+package azuredx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+// isMetadataQuery reports whether a query lists clusters, databases, tables or columns rather than
+// running KQL.
+func isMetadataQuery(queryType string) bool {
+	switch queryType {
+	case models.QueryTypeClusters, models.QueryTypeDatabases, models.QueryTypeTables, models.QueryTypeColumns:
+		return true
+	}
+	return false
+}
+
+// metadataQuery lists the clusters, databases, tables or columns the datasource can query, as a
+// frame with a single column of names, or URIs for clusters. Template variables use them, which
+// then work wherever queries run in the backend, such as provisioned and public dashboards.
+func (adx *AzureDataExplorer) metadataQuery(ctx context.Context, qm models.QueryModel) backend.DataResponse {
+	var field *data.Field
+	var err error
+	switch qm.QueryType {
+	case models.QueryTypeClusters:
+		var clusters []models.ClusterOption
+		if clusters, err = adx.clusters(ctx); err == nil {
+			uris := make([]string, 0, len(clusters))
+			for _, c := range clusters {
+				uris = append(uris, c.Uri)
+			}
+			field = data.NewField("ClusterUri", nil, uris)
+		}
+	case models.QueryTypeDatabases:
+		var databases []models.DatabaseInfo
+		if databases, err = adx.listDatabases(ctx, qm); err == nil {
+			names := make([]string, 0, len(databases))
+			for _, db := range databases {
+				names = append(names, db.Name)
+			}
+			field = data.NewField("DatabaseName", nil, names)
+		}
+	case models.QueryTypeTables:
+		var names []string
+		if names, err = adx.listTables(ctx, qm); err == nil {
+			field = data.NewField("TableName", nil, names)
+		}
+	case models.QueryTypeColumns:
+		var names []string
+		if names, err = adx.listColumns(ctx, qm); err == nil {
+			field = data.NewField("ColumnName", nil, names)
+		}
+	default:
+		return backend.ErrorResponseWithErrorSource(backend.DownstreamError(fmt.Errorf("unsupported query type %q", qm.QueryType)))
+	}
+	if err != nil {
+		return backend.ErrorResponseWithErrorSource(err)
+	}
+	return backend.DataResponse{Frames: data.Frames{data.NewFrame("", field)}}
+}
+
+// managementCommand runs a management command against the cluster and database of a query, which
+// default to the ones of the settings.
+func (adx *AzureDataExplorer) managementCommand(ctx context.Context, qm models.QueryModel, command string) (*models.TableResponse, error) {
+	clusterURL := qm.ClusterUri
+	if clusterURL == "" {
+		clusterURL = adx.settings.ClusterURL
+	}
+	sanitized, err := helpers.SanitizeClusterUri(clusterURL)
+	if err != nil {
+		return nil, err
+	}
+	payload := models.RequestPayload{
+		CSL:         command,
+		DB:          qm.Database,
+		QuerySource: qm.QuerySource,
+	}
+	// Default to not sending the user request headers for schema requests
+	response, err := adx.client.KustoRequest(ctx, sanitized, ManagementApiPath, payload, false, adx.settings.Application)
+	if err == nil {
+		err = response.ExceptionsError()
+	}
+	return response, err
+}
+
+func (adx *AzureDataExplorer) listDatabases(ctx context.Context, qm models.QueryModel) ([]models.DatabaseInfo, error) {
+	qm.Database = ""
+	response, err := adx.managementCommand(ctx, qm, ".show databases")
+	if err != nil {
+		return nil, err
+	}
+	return models.DatabasesFromTableResponse(response)
+}
+
+func (adx *AzureDataExplorer) listTables(ctx context.Context, qm models.QueryModel) ([]string, error) {
+	if err := adx.defaultDatabase(&qm); err != nil {
+		return nil, err
+	}
+	response, err := adx.managementCommand(ctx, qm, ".show tables")
+	if err != nil {
+		return nil, err
+	}
+	names, err := models.TableNamesFromTableResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (adx *AzureDataExplorer) listColumns(ctx context.Context, qm models.QueryModel) ([]string, error) {
+	if qm.Table == "" {
+		return nil, backend.DownstreamError(fmt.Errorf("query submitted without table specified"))
+	}
+	if err := adx.defaultDatabase(&qm); err != nil {
+		return nil, err
+	}
+	response, err := adx.managementCommand(ctx, qm, fmt.Sprintf(".show table %s schema as json", quoteName(qm.Table)))
+	if err != nil {
+		return nil, err
+	}
+	schema, err := models.TableSchemaFromTableResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(schema.OrderedColumns))
+	for _, c := range schema.OrderedColumns {
+		names = append(names, c.Name)
+	}
+	return names, nil
+}
+
+// defaultDatabase sets the database of a query to the default database when it has none.
+func (adx *AzureDataExplorer) defaultDatabase(qm *models.QueryModel) error {
+	if qm.Database != "" {
+		return nil
+	}
+	if adx.settings.DefaultDatabase == "" {
+		return backend.DownstreamError(fmt.Errorf("query submitted without database specified and data source does not have a default database"))
+	}
+	qm.Database = adx.settings.DefaultDatabase
+	return nil
+}
+
+// quoteName quotes the name of an entity, such as a table, so that any name can be used in a command.
+func quoteName(name string) string {
+	return "['" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name) + "']"
+}
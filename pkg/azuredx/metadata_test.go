@@ -0,0 +1,99 @@
+package azuredx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+func TestMetadataQuery(t *testing.T) {
+	const clusterURL = "https://cluster.kusto.windows.net"
+	adx := &AzureDataExplorer{
+		client:   &fakeClient{},
+		settings: &models.DatasourceSettings{ClusterURL: clusterURL, DefaultDatabase: "db"},
+	}
+	kustoRequestMock = func(url string, cluster string, payload models.RequestPayload, enableUserTracking bool, _ string) (*models.TableResponse, error) {
+		require.Equal(t, ManagementApiPath, url)
+		require.False(t, enableUserTracking)
+		switch payload.CSL {
+		case ".show databases":
+			require.Equal(t, clusterURL, cluster)
+			require.Empty(t, payload.DB)
+			return &models.TableResponse{Tables: []models.Table{{
+				Columns: []models.Column{{ColumnName: "DatabaseName"}, {ColumnName: "PrettyName"}},
+				Rows:    []models.Row{[]interface{}{"db", "Database"}, []interface{}{"other", nil}},
+			}}}, nil
+		case ".show tables":
+			require.Equal(t, "https://other.kusto.windows.net", cluster)
+			require.Equal(t, "db", payload.DB)
+			return &models.TableResponse{Tables: []models.Table{{
+				Columns: []models.Column{{ColumnName: "TableName"}, {ColumnName: "DatabaseName"}},
+				Rows:    []models.Row{[]interface{}{"StormEvents", "db"}, []interface{}{"Logs", "db"}},
+			}}}, nil
+		case ".show table ['Storm\\'s Events'] schema as json":
+			require.Equal(t, "other", payload.DB)
+			return &models.TableResponse{Tables: []models.Table{{
+				Columns: []models.Column{{ColumnName: "TableName"}, {ColumnName: "Schema"}},
+				Rows: []models.Row{[]interface{}{"Storm's Events", `{"Name":"Storm's Events","OrderedColumns":[` +
+					`{"Name":"StartTime","Type":"System.DateTime","CslType":"datetime"},{"Name":"State","Type":"System.String","CslType":"string"}]}`}},
+			}}}, nil
+		}
+		t.Fatalf("unexpected command %q", payload.CSL)
+		return nil, nil
+	}
+	ARGClusterRequestMock = func(_ models.ARGRequestPayload, _ map[string]string) ([]models.ClusterOption, error) {
+		return []models.ClusterOption{{Name: "other", Uri: "https://other.kusto.windows.net"}}, nil
+	}
+
+	tests := []struct {
+		name     string
+		json     string
+		expected *data.Field
+	}{
+		{
+			name:     "clusters",
+			json:     `{"queryType": "Clusters"}`,
+			expected: data.NewField("ClusterUri", nil, []string{clusterURL, "https://other.kusto.windows.net"}),
+		},
+		{
+			name:     "databases",
+			json:     `{"queryType": "Databases"}`,
+			expected: data.NewField("DatabaseName", nil, []string{"db", "other"}),
+		},
+		{
+			name:     "tables of the default database",
+			json:     `{"queryType": "Tables", "clusterUri": "https://other.kusto.windows.net"}`,
+			expected: data.NewField("TableName", nil, []string{"Logs", "StormEvents"}),
+		},
+		{
+			name:     "columns",
+			json:     `{"queryType": "Columns", "database": "other", "table": "Storm's Events"}`,
+			expected: data.NewField("ColumnName", nil, []string{"StartTime", "State"}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := adx.handleQuery(context.Background(), backend.DataQuery{RefID: "A", JSON: []byte(tt.json)}, nil)
+			require.NoError(t, res.Error)
+			require.Equal(t, data.Frames{data.NewFrame("", tt.expected)}, res.Frames)
+		})
+	}
+
+	t.Run("columns without a table", func(t *testing.T) {
+		res := adx.handleQuery(context.Background(), backend.DataQuery{RefID: "A", JSON: []byte(`{"queryType": "Columns"}`)}, nil)
+		require.EqualError(t, res.Error, "query submitted without table specified")
+		require.Equal(t, backend.ErrorSourceDownstream, res.ErrorSource)
+	})
+
+	t.Run("tables without a database", func(t *testing.T) {
+		adx := &AzureDataExplorer{client: &fakeClient{}, settings: &models.DatasourceSettings{ClusterURL: clusterURL}}
+		res := adx.handleQuery(context.Background(), backend.DataQuery{RefID: "A", JSON: []byte(`{"queryType": "Tables"}`)}, nil)
+		require.Error(t, res.Error)
+		require.Equal(t, backend.ErrorSourceDownstream, res.ErrorSource)
+	})
+}
@@ -0,0 +1,78 @@
+package azuredx
+
+import (
+	"context"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+const metricsNamespace = "grafana_plugin_adx"
+
+var (
+	queryCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_cache_hits_total",
+		Help:      "Number of queries answered from the query result cache.",
+	})
+	queryCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_cache_misses_total",
+		Help:      "Number of cacheable queries that were not found in the query result cache.",
+	})
+	inflightDeduplicated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "inflight_requests_deduplicated_total",
+		Help:      "Number of queries that waited for an identical query already in flight instead of calling the cluster.",
+	})
+)
+
+var (
+	queryResultRows = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_result_rows",
+		Help:      "Number of rows decoded into the data frames of a query.",
+		Buckets:   prometheus.ExponentialBuckets(1, 10, 8),
+	}, []string{"cluster", "source", "format"})
+	queryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_errors_total",
+		Help:      "Number of failed queries by the source of the error.",
+	}, []string{"cluster", "source", "format", "error_source"})
+)
+
+// metricsFormats are the result formats that label metrics. Other formats are labelled "other".
+var metricsFormats = map[string]bool{
+	"table": true, "time_series": true, "time_series_adx_series": true, "trace": true, "logs": true,
+}
+
+// observeQuery records the result of a query, labelled by the cluster it ran on, where it was sent
+// from and the format of its result. configured is the cluster URL of the datasource.
+func observeQuery(ctx context.Context, clusterURL string, configured string, q models.QueryModel, resp backend.DataResponse, err error) {
+	cluster := helpers.MetricsCluster(clusterURL, configured)
+	source := helpers.MetricsSource(q.QuerySource)
+	format := q.Format
+	if !metricsFormats[format] {
+		format = "other"
+	}
+	if err == nil {
+		err = resp.Error
+	}
+	if err != nil {
+		// aborted queries are not failures of the cluster or the plugin
+		if ctx.Err() == nil {
+			queryErrors.WithLabelValues(cluster, source, format, string(helpers.ErrorSource(err))).Inc()
+		}
+		return
+	}
+
+	rows := 0
+	for _, f := range resp.Frames {
+		rows += f.Rows()
+	}
+	queryResultRows.WithLabelValues(cluster, source, format).Observe(float64(rows))
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"regexp"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// aliasRE matches the placeholders of an alias, such as {{State}} or {{ __field }}.
+var aliasRE = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// ApplyAlias names the value fields of a time series frame after an alias, in which {{__field}} is
+// replaced by the name of the field and any other {{label}} by the value of that label of the
+// field, or nothing if the field has no such label. The fields that are named are replaced by
+// copies, so fields and configs shared with other frames are not modified.
+func ApplyAlias(frame *data.Frame, alias string) {
+	if alias == "" {
+		return
+	}
+	for i, field := range frame.Fields {
+		if !field.Type().Numeric() {
+			continue
+		}
+		config := data.FieldConfig{}
+		if field.Config != nil {
+			config = *field.Config
+		}
+		config.DisplayNameFromDS = aliasRE.ReplaceAllStringFunc(alias, func(placeholder string) string {
+			name := aliasRE.FindStringSubmatch(placeholder)[1]
+			if name == "__field" {
+				return field.Name
+			}
+			return field.Labels[name]
+		})
+		named := *field
+		named.Config = &config
+		frame.Fields[i] = &named
+	}
+}
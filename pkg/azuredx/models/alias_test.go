@@ -0,0 +1,57 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyAlias(t *testing.T) {
+	newFrame := func() *data.Frame {
+		return data.NewFrame("",
+			data.NewField("Timestamp", nil, []time.Time{time.Unix(0, 0)}),
+			data.NewField("avg_Damage", data.Labels{"State": "TEXAS"}, []float64{1}).SetConfig(&data.FieldConfig{Unit: "currencyUSD"}),
+			data.NewField("count_", data.Labels{"State": "OHIO", "Type": "Hail"}, []*int64{nil}),
+		)
+	}
+
+	tests := []struct {
+		name     string
+		alias    string
+		expected []string
+	}{
+		{name: "labels and field name", alias: "{{State}} - {{__field}}", expected: []string{"TEXAS - avg_Damage", "OHIO - count_"}},
+		{name: "spaces in placeholders", alias: "{{ Type }}: {{ __field }}", expected: []string{": avg_Damage", "Hail: count_"}},
+		{name: "text without placeholders", alias: "Damage {{", expected: []string{"Damage {{", "Damage {{"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := newFrame()
+			ApplyAlias(frame, tt.alias)
+			assert.Nil(t, frame.Fields[0].Config)
+			assert.Equal(t, tt.expected[0], frame.Fields[1].Config.DisplayNameFromDS)
+			assert.Equal(t, "currencyUSD", frame.Fields[1].Config.Unit)
+			assert.Equal(t, tt.expected[1], frame.Fields[2].Config.DisplayNameFromDS)
+		})
+	}
+
+	t.Run("shared fields and configs are not modified", func(t *testing.T) {
+		frame := newFrame()
+		field, config := frame.Fields[1], frame.Fields[1].Config
+		shared := data.NewFrame("", append([]*data.Field{}, frame.Fields...)...)
+		ApplyAlias(frame, "{{State}}")
+		require.Equal(t, "TEXAS", frame.Fields[1].Config.DisplayNameFromDS)
+		assert.Same(t, field, shared.Fields[1])
+		assert.Same(t, config, shared.Fields[1].Config)
+		assert.Empty(t, config.DisplayNameFromDS)
+	})
+
+	t.Run("no alias leaves the frame as is", func(t *testing.T) {
+		frame := newFrame()
+		ApplyAlias(frame, "")
+		assert.Equal(t, newFrame(), frame)
+	})
+}
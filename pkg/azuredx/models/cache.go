@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -23,6 +24,35 @@ func NewCacheSettings(s *DatasourceSettings, q *backend.DataQuery, qm *QueryMode
 	return newCacheSettings(s, q, qm, time.Since)
 }
 
+// MaxAge returns how long the results of the query can be cached, which is zero when caching is
+// disabled or the cache max age cannot be parsed.
+func (cs *CacheSettings) MaxAge() time.Duration {
+	if cs == nil || cs.CacheMaxAge == "" {
+		return 0
+	}
+	d, err := parseCacheMaxAge(cs.CacheMaxAge)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// parseCacheMaxAge accepts the Kusto timespans produced by formatDuration as well as the
+// durations of the datasource settings, such as 5m or 1d.
+func parseCacheMaxAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n * float64(day)), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	return parseTimespan(s)
+}
+
 type timeSince = func(t time.Time) time.Duration
 
 func newCacheSettings(s *DatasourceSettings, q *backend.DataQuery, qm *QueryModel, ts timeSince) *CacheSettings {
@@ -100,7 +130,7 @@ func detectResolution(query string, interval time.Duration) time.Duration {
 		return intervalOrDefault(interval)
 	}
 
-	if macroRE.MatchString(match[1]) {
+	if IsMacro(match[1]) {
 		return intervalOrDefault(interval)
 	}
 
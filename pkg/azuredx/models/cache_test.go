@@ -212,3 +212,27 @@ func TestNewCacheSettings(t *testing.T) {
 		})
 	}
 }
+
+func TestCacheSettingsMaxAge(t *testing.T) {
+	tests := []struct {
+		cacheMaxAge string
+		expected    time.Duration
+	}{
+		{cacheMaxAge: "", expected: 0},
+		{cacheMaxAge: "0m", expected: 0},
+		{cacheMaxAge: "5m", expected: 5 * time.Minute},
+		{cacheMaxAge: "1d", expected: day},
+		{cacheMaxAge: "00:00:30", expected: 30 * time.Second},
+		{cacheMaxAge: "1.02:00:00", expected: day + 2*time.Hour},
+		{cacheMaxAge: "invalid", expected: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cacheMaxAge, func(t *testing.T) {
+			cs := &CacheSettings{CacheMaxAge: tt.cacheMaxAge}
+			assert.Equal(t, tt.expected, cs.MaxAge())
+		})
+	}
+
+	var cs *CacheSettings
+	assert.Equal(t, time.Duration(0), cs.MaxAge())
+}
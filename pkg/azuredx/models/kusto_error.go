@@ -0,0 +1,148 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrorDetails is an error of Azure Data Explorer's JSON error body, which may wrap the error that
+// caused it.
+// https://learn.microsoft.com/en-us/kusto/api/rest/response#json-error-response
+type ErrorDetails struct {
+	Code         string        `json:"code"`
+	Message      string        `json:"message"`
+	Type         string        `json:"@type"`
+	Description  string        `json:"@message"`
+	Context      *ErrorContext `json:"@context,omitempty"`
+	Permanent    *bool         `json:"@permanent,omitempty"`
+	Text         string        `json:"@text,omitempty"`
+	Database     string        `json:"@database,omitempty"`
+	ErrorCode    string        `json:"@errorCode,omitempty"`
+	ErrorMessage string        `json:"@errorMessage,omitempty"`
+	Line         ErrorPosition `json:"@line,omitempty"`
+	Pos          ErrorPosition `json:"@pos,omitempty"`
+	Token        string        `json:"@token,omitempty"`
+	InnerError   *ErrorDetails `json:"innererror,omitempty"`
+}
+
+// ErrorContext describes where and when the cluster handled a failed request.
+type ErrorContext struct {
+	Timestamp       string `json:"timestamp,omitempty"`
+	ServiceAlias    string `json:"serviceAlias,omitempty"`
+	ClientRequestID string `json:"clientRequestId,omitempty"`
+	ActivityID      string `json:"activityId,omitempty"`
+	ActivityType    string `json:"activityType,omitempty"`
+}
+
+// ErrorPosition is a line or a position of an error, which the cluster sends either as a number or
+// as a string. A position that is not a number is read as 0, as if the error had none, so that the
+// rest of the error is kept.
+type ErrorPosition int
+
+func (p *ErrorPosition) UnmarshalJSON(b []byte) error {
+	n, _ := strconv.Atoi(strings.Trim(string(b), `"`))
+	*p = ErrorPosition(n)
+	return nil
+}
+
+// KustoErrorCause is an error of the chain that caused a KustoError, outermost first.
+type KustoErrorCause struct {
+	Code    string `json:"code,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Message string `json:"message"`
+}
+
+// KustoError is an error response of the cluster. Line and Position locate syntax and semantic
+// errors in the query that was sent, and are 0 when the error has no position.
+type KustoError struct {
+	StatusCode      int               `json:"statusCode"`
+	Status          string            `json:"status"`
+	Code            string            `json:"code,omitempty"`
+	ErrorCode       string            `json:"errorCode,omitempty"`
+	Type            string            `json:"type,omitempty"`
+	Message         string            `json:"message"`
+	Permanent       bool              `json:"permanent"`
+	Line            int               `json:"line,omitempty"`
+	Position        int               `json:"position,omitempty"`
+	Token           string            `json:"token,omitempty"`
+	ClientRequestID string            `json:"clientRequestId,omitempty"`
+	ActivityID      string            `json:"activityId,omitempty"`
+	Causes          []KustoErrorCause `json:"causes,omitempty"`
+}
+
+// lineAndPositionRE matches the position the cluster adds to the messages of syntax errors.
+var lineAndPositionRE = regexp.MustCompile(`\[line:position=(\d+):(\d+)\]`)
+
+// NewKustoError builds the error of a failed request from the status of the response and its body.
+// Errors that do not say whether they are permanent are transient when the status is, such as
+// throttling and server errors.
+func NewKustoError(statusCode int, status string, r ErrorResponse) *KustoError {
+	e := &KustoError{
+		StatusCode: statusCode,
+		Status:     status,
+		Code:       r.Error.Code,
+		Type:       r.Error.Type,
+		Message:    r.Error.Message,
+		Permanent:  statusCode != http.StatusTooManyRequests && statusCode/100 != 5,
+	}
+	if e.Message == "" {
+		e.Message = r.Error.text()
+	}
+
+	permanentSet := false
+	for d := &r.Error; d != nil; d = d.InnerError {
+		e.Causes = append(e.Causes, KustoErrorCause{Code: d.Code, Type: d.Type, Message: d.text()})
+		if d.Type != "" {
+			e.Type = d.Type
+		}
+		if d.ErrorCode != "" {
+			e.ErrorCode = d.ErrorCode
+		}
+		if d.Permanent != nil && !permanentSet {
+			e.Permanent = *d.Permanent
+			permanentSet = true
+		}
+		if e.Line == 0 && d.Line > 0 {
+			e.Line, e.Position, e.Token = int(d.Line), int(d.Pos), d.Token
+		}
+		if d.Context != nil && e.ActivityID == "" {
+			e.ClientRequestID, e.ActivityID = d.Context.ClientRequestID, d.Context.ActivityID
+		}
+	}
+	if e.Line == 0 {
+		for _, c := range e.Causes {
+			if m := lineAndPositionRE.FindStringSubmatch(c.Message); m != nil {
+				e.Line, _ = strconv.Atoi(m[1])
+				e.Position, _ = strconv.Atoi(m[2])
+				break
+			}
+		}
+	}
+	return e
+}
+
+func (e *KustoError) Error() string {
+	return fmt.Sprintf("azure HTTP %q: %s", e.Status, e.Message)
+}
+
+// Transient reports whether the request may succeed when sent again later.
+func (e *KustoError) Transient() bool {
+	return !e.Permanent
+}
+
+// IsPermanentError reports whether err is an error of the cluster that will fail again if the
+// request is sent again unchanged.
+func IsPermanentError(err error) bool {
+	var kustoErr *KustoError
+	return errors.As(err, &kustoErr) && kustoErr.Permanent
+}
+
+// ErrorFrameMD populates the Custom metadata of the frame of a failed query, so the query editor can
+// mark the position of the error.
+type ErrorFrameMD struct {
+	KustoError *KustoError `json:"kustoError"`
+}
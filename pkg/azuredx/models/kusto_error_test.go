@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKustoError(t *testing.T) {
+	t.Run("parses a syntax error with its position", func(t *testing.T) {
+		b, err := os.ReadFile(filepath.Join("testdata", "error-response.json"))
+		require.NoError(t, err)
+		var r ErrorResponse
+		require.NoError(t, json.Unmarshal(b, &r))
+
+		e := NewKustoError(http.StatusBadRequest, "400 Bad Request", r)
+		assert.Equal(t, "General_BadRequest", e.Code)
+		assert.Equal(t, "SYN0002", e.ErrorCode)
+		assert.Equal(t, "Kusto.Data.Exceptions.SyntaxException", e.Type)
+		assert.True(t, e.Permanent)
+		assert.False(t, e.Transient())
+		assert.Equal(t, 1, e.Line)
+		assert.Equal(t, 9, e.Position)
+		assert.Equal(t, "take", e.Token)
+		assert.Equal(t, "unspecified;d6ad5874-e639-4bff-b416-0cbc01366931", e.ClientRequestID)
+		assert.Equal(t, "3e4d89dc-38af-40a3-af81-a7e7d9b04055", e.ActivityID)
+		require.Len(t, e.Causes, 2)
+		assert.Equal(t, "Kusto.Data.Exceptions.KustoBadRequestException", e.Causes[0].Type)
+		assert.Equal(t, "Syntax error: SYN0002: A recognition error occurred. [line:position=1:9]. Query: 'PerfTest take 5'", e.Causes[1].Message)
+		assert.Equal(t, `azure HTTP "400 Bad Request": Request is invalid and cannot be processed: Syntax error: SYN0002: A recognition error occurred. [line:position=1:9]. Query: 'PerfTest take 5'`, e.Error())
+	})
+
+	t.Run("reads the position from the message when it is not given", func(t *testing.T) {
+		var r ErrorResponse
+		require.NoError(t, json.Unmarshal([]byte(`{"error": {"code": "General_BadRequest", "message": "Semantic error: SEM0100: 'where' operator: Failed to resolve column named 'Sate' [line:position=2:8]", "@line": 0}}`), &r))
+
+		e := NewKustoError(http.StatusBadRequest, "400 Bad Request", r)
+		assert.Equal(t, 2, e.Line)
+		assert.Equal(t, 8, e.Position)
+		assert.True(t, e.Permanent)
+	})
+
+	t.Run("keeps the error when its position is not a number", func(t *testing.T) {
+		var r ErrorResponse
+		require.NoError(t, json.Unmarshal([]byte(`{"error": {"code": "General_BadRequest", "message": "Syntax error", "@line": "n/a", "@pos": {}, "@errorCode": "SYN0002"}}`), &r))
+
+		e := NewKustoError(http.StatusBadRequest, "400 Bad Request", r)
+		assert.Equal(t, "Syntax error", e.Message)
+		assert.Equal(t, "SYN0002", e.ErrorCode)
+		assert.Equal(t, 0, e.Line)
+		assert.Equal(t, 0, e.Position)
+	})
+
+	t.Run("separates transient errors from permanent ones", func(t *testing.T) {
+		tests := []struct {
+			statusCode int
+			body       string
+			permanent  bool
+		}{
+			{statusCode: http.StatusTooManyRequests, body: `{"error": {"code": "LimitsExceeded", "message": "Request is throttled"}}`, permanent: false},
+			{statusCode: http.StatusInternalServerError, body: `{"error": {"code": "Internal", "message": "Something failed"}}`, permanent: false},
+			{statusCode: http.StatusInternalServerError, body: `{"error": {"code": "Internal", "message": "Something failed", "@permanent": true}}`, permanent: true},
+			{statusCode: http.StatusBadRequest, body: `{"error": {"code": "BadRequest", "message": "Overloaded", "innererror": {"message": "Overloaded", "@permanent": false}}}`, permanent: false},
+			{statusCode: http.StatusForbidden, body: `{"error": {"code": "Forbidden", "message": "Principal is not authorized"}}`, permanent: true},
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%d %s", tt.statusCode, tt.body), func(t *testing.T) {
+				var r ErrorResponse
+				require.NoError(t, json.Unmarshal([]byte(tt.body), &r))
+				e := NewKustoError(tt.statusCode, http.StatusText(tt.statusCode), r)
+				assert.Equal(t, tt.permanent, e.Permanent)
+				assert.Equal(t, tt.permanent, IsPermanentError(fmt.Errorf("wrapped: %w", e)))
+			})
+		}
+	})
+
+	t.Run("is not a permanent error when it is another error", func(t *testing.T) {
+		assert.False(t, IsPermanentError(fmt.Errorf("network error")))
+	})
+}
@@ -1,26 +1,40 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/kql"
 )
 
 //  Macros:
 //   - $__timeFilter() -> TimeGenerated ≥ datetime(2018-06-05T18:09:58.907Z) and TimeGenerated ≤ datetime(2018-06-05T20:09:58.907Z)
 //   - $__timeFilter(datetimeColumn) ->  datetimeColumn  ≥ datetime(2018-06-05T18:09:58.907Z) and datetimeColumn ≤ datetime(2018-06-05T20:09:58.907Z)
-//   - $__from ->  datetime(2018-06-05T18:09:58.907Z)
-//   - $__to -> datetime(2018-06-05T20:09:58.907Z)
-//   - $__interval -> 5m
+//   - $__timeFilterUnix(epochColumn) -> epochColumn ≥ 1528222198 and epochColumn ≤ 1528229398
+//   - $__timeFilterUnix(epochColumn, ms) -> epochColumn ≥ 1528222198907 and epochColumn ≤ 1528229398907
+//   - $__timeFrom ->  datetime(2018-06-05T18:09:58.907Z)
+//   - $__timeTo -> datetime(2018-06-05T20:09:58.907Z)
+//   - $__timeInterval -> 5000ms
+//   - $__interval_ms -> 5000
+//   - $__timeBin(datetimeColumn) -> bin(datetimeColumn, 5000ms)
+//   - $__timeBin(datetimeColumn, 1h) -> bin(datetimeColumn, 1h)
+//   - $__timeBinTz(datetimeColumn) -> datetime_local_to_utc(bin(datetime_utc_to_local(datetimeColumn, 'Europe/Paris'), 5000ms), 'Europe/Paris')
+//   - $__timeGroup(datetimeColumn, 1h, 0) -> default=0 on datetimeColumn from bin(datetime(2018-06-05T18:09:58.907Z), 1h) to datetime(2018-06-05T20:09:58.907Z) step 1h
+//
+// The interval of $__timeBin, $__timeBinTz and $__timeGroup defaults to the interval of the query,
+// and $__timeBinTz bins in the timezone of the dashboard.
 
 // MacroData contains the information needed for macro expansion.
 type MacroData struct {
 	*backend.TimeRange
 	intervalMS int64
-	// pointer to map with intervalFuncs
+	// timezone is the IANA timezone of the dashboard, empty for UTC.
+	timezone string
 }
 
 // NewMacroData creates a MacroData object from the arguments that
@@ -32,76 +46,236 @@ func NewMacroData(tr *backend.TimeRange, intervalMS int64) MacroData {
 	}
 }
 
-// macroRE is a regular expression to match available macros
-var macroRE = regexp.MustCompile(`\$__` + // Prefix: $__
-	`(timeFilter|timeFrom|timeTo|timeInterval)` + // one of macro root names
-	`(\([a-zA-Z0-9_\s\[\]\"\'.-]*?\))?`) // optional () or optional (someArg)
+// WithTimezone returns a copy of md that bins $__timeBinTz in the given IANA timezone, such as
+// Europe/Paris. UTC is used when tz is empty or utc.
+func (md MacroData) WithTimezone(tz string) MacroData {
+	if strings.EqualFold(tz, "utc") {
+		tz = ""
+	}
+	md.timezone = tz
+	return md
+}
+
+// timezoneRE matches the IANA timezone names, such as America/Argentina/Buenos_Aires or Etc/GMT+3.
+var timezoneRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_+-]*(/[A-Za-z0-9_+-]+)*$`)
 
-// Interpolate replaces macros with their values for the given query.
+// MacroError is an error of a macro of a query. Line and Column locate the macro in the query,
+// and are 1-based.
+type MacroError struct {
+	Macro  string
+	Offset int
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *MacroError) Error() string {
+	if e.Macro == "" {
+		return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("%v at line %d, column %d: %v", e.Macro, e.Line, e.Column, e.Err)
+}
+
+func (e *MacroError) Unwrap() error {
+	return e.Err
+}
+
+// Interpolate replaces macros with their values for the given query. Macros in string literals and
+// comments are left as they are.
 func (md MacroData) Interpolate(query string) (string, error) {
-	errorStrings := []string{}
-	replaceAll := func(varMatch string) string {
-		varSplit := strings.FieldsFunc(varMatch, func(r rune) bool {
-			if r == '(' || r == ')' {
-				return true
-			}
-			return false
-		})
-		funcName := varSplit[0]
-		funcToCall, ok := interpolationFuncs[funcName]
-		if !ok {
-			errorStrings = append(errorStrings, fmt.Sprintf("failed to interpolate, could not find function '%v'", funcName))
-			return ""
+	if !strings.Contains(query, "$__") {
+		return query, nil
+	}
+	interpolated, errs := md.interpolate(query, 0)
+	if len(errs) > 0 {
+		joined := make([]error, 0, len(errs))
+		for _, e := range errs {
+			e.Line, e.Column = kql.Position(query, e.Offset)
+			joined = append(joined, e)
+		}
+		return "", fmt.Errorf("failed to interpolate query, errors: %w", errors.Join(joined...))
+	}
+	return interpolated, nil
+}
+
+// interpolate replaces the macros of a part of a query found at offset. The arguments of macros are
+// interpolated first, so that macros may be passed to macros.
+func (md MacroData) interpolate(query string, offset int) (string, []*MacroError) {
+	calls, err := kql.Macros(query, IsMacro)
+	if err != nil {
+		var syntaxErr *kql.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return "", []*MacroError{{Offset: offset + syntaxErr.Offset, Err: errors.New(syntaxErr.Message)}}
+		}
+		return "", []*MacroError{{Offset: offset, Err: err}}
+	}
+
+	var b strings.Builder
+	var errs []*MacroError
+	last := 0
+	for _, call := range calls {
+		args := make([]string, 0, len(call.Args))
+		for _, arg := range call.Args {
+			value, argErrs := md.interpolate(arg.Text, offset+arg.Offset)
+			errs = append(errs, argErrs...)
+			args = append(args, value)
 		}
-		arg := ""
-		if len(varSplit) > 1 {
-			arg = quoteForSpacesDotsDashes(varSplit[1])
+		value, err := interpolationFuncs[call.Name](args, md)
+		if err != nil {
+			errs = append(errs, &MacroError{Macro: call.Name, Offset: offset + call.Offset, Err: err})
 		}
-		return funcToCall(arg, md)
+		b.WriteString(query[last:call.Offset])
+		b.WriteString(value)
+		last = call.End
 	}
-	interpolated := macroRE.ReplaceAllStringFunc(query, replaceAll)
-	if len(errorStrings) > 0 {
-		return "", fmt.Errorf("failed to interpolate query, errors: %v", strings.Join(errorStrings, "\n"))
+	b.WriteString(query[last:])
+	return b.String(), errs
+}
+
+// macroArgs checks the number of arguments of a macro, and returns them padded with empty strings
+// up to max.
+func macroArgs(args []string, max int) ([]string, error) {
+	if len(args) > max {
+		return nil, fmt.Errorf("expected at most %d arguments, got %d", max, len(args))
 	}
-	return interpolated, nil
+	padded := make([]string, max)
+	copy(padded, args)
+	return padded, nil
+}
+
+// IsMacro reports whether name, such as $__timeFilter, is a macro the datasource interpolates.
+func IsMacro(name string) bool {
+	_, ok := interpolationFuncs[name]
+	return ok
 }
 
 func quoteForSpacesDotsDashes(s string) string {
 	// https://docs.microsoft.com/en-us/azure/data-explorer/kusto/query/schema-entities/entity-names#identifier-quoting
-	if strings.ContainsAny(s, " .-") && !strings.ContainsAny(s, "['\"]") {
+	if strings.ContainsAny(s, " .-") && !strings.ContainsAny(s, "['\"]()") {
 		return fmt.Sprintf("['%s']", s)
 	}
 	return s
 }
 
-var interpolationFuncs = map[string]func(string, MacroData) string{
-	"$__timeFrom":     timeFromMacro,
-	"$__timeTo":       timeToMacro,
-	"$__timeFilter":   timeFilterMacro,
-	"$__timeInterval": timeIntervalMacro,
+var interpolationFuncs = map[string]func([]string, MacroData) (string, error){
+	"$__timeFrom":       timeFromMacro,
+	"$__timeTo":         timeToMacro,
+	"$__timeFilter":     timeFilterMacro,
+	"$__timeFilterUnix": timeFilterUnixMacro,
+	"$__timeInterval":   timeIntervalMacro,
+	"$__interval_ms":    intervalMSMacro,
+	"$__timeBin":        timeBinMacro,
+	"$__timeBinTz":      timeBinTzMacro,
+	"$__timeGroup":      timeGroupMacro,
 }
 
-func timeFromMacro(s string, md MacroData) string {
-	return fmt.Sprintf("datetime(%v)", md.From.UTC().Format(time.RFC3339Nano))
+// column returns the column argument of a macro, quoted when needed, or TimeGenerated.
+func column(arg string) string {
+	if arg == "" {
+		return "TimeGenerated"
+	}
+	return quoteForSpacesDotsDashes(arg)
 }
 
-func timeToMacro(s string, md MacroData) string {
-	return fmt.Sprintf("datetime(%v)", md.To.UTC().Format(time.RFC3339Nano))
+// interval returns the interval argument of a macro, or the interval of the query.
+func (md MacroData) interval(arg string) string {
+	if arg == "" || arg == "auto" {
+		if md.intervalMS == 0 {
+			md.intervalMS = 1000 // Default of 1000 (millisecond)
+		}
+		return fmt.Sprintf("%vms", md.intervalMS)
+	}
+	return arg
 }
 
-func timeIntervalMacro(s string, md MacroData) string {
-	if md.intervalMS == 0 {
-		md.intervalMS = 1000 // Default of 1000 (millisecond)
-	}
-	return fmt.Sprintf("%vms", md.intervalMS)
+func timeFromMacro(args []string, md MacroData) (string, error) {
+	return fmt.Sprintf("datetime(%v)", md.From.UTC().Format(time.RFC3339Nano)), nil
+}
+
+func timeToMacro(args []string, md MacroData) (string, error) {
+	return fmt.Sprintf("datetime(%v)", md.To.UTC().Format(time.RFC3339Nano)), nil
+}
+
+func timeIntervalMacro(args []string, md MacroData) (string, error) {
+	return md.interval(""), nil
 }
 
-func timeFilterMacro(s string, md MacroData) string {
-	if s == "" {
-		s = "TimeGenerated"
+func intervalMSMacro(args []string, md MacroData) (string, error) {
+	return strings.TrimSuffix(md.interval(""), "ms"), nil
+}
+
+func timeFilterMacro(args []string, md MacroData) (string, error) {
+	args, err := macroArgs(args, 1)
+	if err != nil {
+		return "", err
 	}
+	s := column(args[0])
 	fmtString := "%v >= datetime(%v) and %v <= datetime(%v)"
 	timeString := fmt.Sprintf(fmtString, s, md.From.UTC().Format(time.RFC3339Nano), s, md.To.UTC().Format(time.RFC3339Nano))
 	backend.Logger.Debug("Time String", "value", timeString)
-	return timeString
+	return timeString, nil
+}
+
+// timeFilterUnixMacro filters a column of epoch seconds, or milliseconds when its unit is ms.
+func timeFilterUnixMacro(args []string, md MacroData) (string, error) {
+	args, err := macroArgs(args, 2)
+	if err != nil {
+		return "", err
+	}
+	s := column(args[0])
+	from, to := md.From.Unix(), md.To.Unix()
+	switch args[1] {
+	case "", "s":
+	case "ms":
+		from, to = md.From.UnixMilli(), md.To.UnixMilli()
+	default:
+		return "", fmt.Errorf("unit must be s or ms, got %q", args[1])
+	}
+	return fmt.Sprintf("%v >= %d and %v <= %d", s, from, s, to), nil
+}
+
+func timeBinMacro(args []string, md MacroData) (string, error) {
+	args, err := macroArgs(args, 2)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("bin(%v, %v)", column(args[0]), md.interval(args[1])), nil
+}
+
+// timeBinTzMacro bins in the timezone of the dashboard, so that bins of a day or more start at its
+// midnight, and converts the bins back to UTC.
+func timeBinTzMacro(args []string, md MacroData) (string, error) {
+	if md.timezone == "" {
+		return timeBinMacro(args, md)
+	}
+	if !timezoneRE.MatchString(md.timezone) {
+		return "", fmt.Errorf("invalid timezone %q", md.timezone)
+	}
+	args, err := macroArgs(args, 2)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("datetime_local_to_utc(bin(datetime_utc_to_local(%v, '%v'), %v), '%v')", column(args[0]), md.timezone, md.interval(args[1]), md.timezone), nil
+}
+
+// timeGroupMacro builds the axis of a make-series over the time range, which fills the bins without
+// rows with the fill value, or with the default of the aggregation when there is none. It goes right
+// after the aggregation of the make-series:
+//
+//	T | make-series count() $__timeGroup(Timestamp, 1h, 0) by State
+func timeGroupMacro(args []string, md MacroData) (string, error) {
+	args, err := macroArgs(args, 3)
+	if err != nil {
+		return "", err
+	}
+	interval := md.interval(args[1])
+	axis := fmt.Sprintf("on %v from bin(datetime(%v), %v) to datetime(%v) step %v", column(args[0]), md.From.UTC().Format(time.RFC3339Nano), interval, md.To.UTC().Format(time.RFC3339Nano), interval)
+	switch args[2] {
+	case "":
+		return axis, nil
+	case "null":
+		return "default=real(null) " + axis, nil
+	default:
+		return fmt.Sprintf("default=%v %v", args[2], axis), nil
+	}
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMacroData_Interpolate(t *testing.T) {
@@ -33,6 +34,16 @@ func TestMacroData_Interpolate(t *testing.T) {
 			returnIs:  assert.Equal,
 			returnVal: fromString,
 		},
+		{
+			name: "should parse macros after an unterminated string",
+			macroData: NewMacroData(&backend.TimeRange{
+				From: fromTime,
+			}, 0),
+			errorIs:   assert.NoError,
+			query:     "T | where s == 'x | where t > $__timeFrom",
+			returnIs:  assert.Equal,
+			returnVal: "T | where s == 'x | where t > " + fromString,
+		},
 		{
 			name: "should parse $__timeFrom with spaces",
 			macroData: NewMacroData(&backend.TimeRange{
@@ -127,6 +138,174 @@ func TestMacroData_Interpolate(t *testing.T) {
 			returnIs:  assert.Equal,
 			returnVal: fmt.Sprintf("['identifier-with-dashes'] >= %v and ['identifier-with-dashes'] <= %v", fromString, toString),
 		},
+		{
+			name:      "should parse $__interval_ms",
+			macroData: NewMacroData(nil, 5000),
+			errorIs:   assert.NoError,
+			query:     "$__interval_ms",
+			returnIs:  assert.Equal,
+			returnVal: "5000",
+		},
+		{
+			name: "should parse $__timeFilterUnix(epoch)",
+			macroData: NewMacroData(&backend.TimeRange{
+				From: fromTime,
+				To:   toTime,
+			}, 0),
+			errorIs:   assert.NoError,
+			query:     "$__timeFilterUnix(epoch)",
+			returnIs:  assert.Equal,
+			returnVal: "epoch >= 1564516953 and epoch <= 1564517253",
+		},
+		{
+			name: "should parse $__timeFilterUnix(epoch, ms)",
+			macroData: NewMacroData(&backend.TimeRange{
+				From: fromTime,
+				To:   toTime,
+			}, 0),
+			errorIs:   assert.NoError,
+			query:     "$__timeFilterUnix(epoch, ms)",
+			returnIs:  assert.Equal,
+			returnVal: "epoch >= 1564516953000 and epoch <= 1564517253000",
+		},
+		{
+			name: "should fail $__timeFilterUnix with an unknown unit",
+			macroData: NewMacroData(&backend.TimeRange{
+				From: fromTime,
+				To:   toTime,
+			}, 0),
+			errorIs:   assert.Error,
+			query:     "$__timeFilterUnix(epoch, us)",
+			returnIs:  assert.Equal,
+			returnVal: "",
+		},
+		{
+			name:      "should parse $__timeBin(Timestamp)",
+			macroData: NewMacroData(nil, 30000),
+			errorIs:   assert.NoError,
+			query:     "summarize count() by $__timeBin(Timestamp)",
+			returnIs:  assert.Equal,
+			returnVal: "summarize count() by bin(Timestamp, 30000ms)",
+		},
+		{
+			name:      "should parse $__timeBin with an interval",
+			macroData: NewMacroData(nil, 30000),
+			errorIs:   assert.NoError,
+			query:     "$__timeBin(['Time Stamp'], 1h)",
+			returnIs:  assert.Equal,
+			returnVal: "bin(['Time Stamp'], 1h)",
+		},
+		{
+			name:      "should parse $__timeBin() on TimeGenerated",
+			macroData: NewMacroData(nil, 0),
+			errorIs:   assert.NoError,
+			query:     "$__timeBin()",
+			returnIs:  assert.Equal,
+			returnVal: "bin(TimeGenerated, 1000ms)",
+		},
+		{
+			name:      "should fail $__timeBin with too many arguments",
+			macroData: NewMacroData(nil, 0),
+			errorIs:   assert.Error,
+			query:     "$__timeBin(Timestamp, 1h, 2h)",
+			returnIs:  assert.Equal,
+			returnVal: "",
+		},
+		{
+			name:      "should parse $__timeBinTz in the timezone of the dashboard",
+			macroData: NewMacroData(nil, 0).WithTimezone("Europe/Paris"),
+			errorIs:   assert.NoError,
+			query:     "$__timeBinTz(Timestamp, 1d)",
+			returnIs:  assert.Equal,
+			returnVal: "datetime_local_to_utc(bin(datetime_utc_to_local(Timestamp, 'Europe/Paris'), 1d), 'Europe/Paris')",
+		},
+		{
+			name:      "should parse $__timeBinTz in UTC",
+			macroData: NewMacroData(nil, 0).WithTimezone("utc"),
+			errorIs:   assert.NoError,
+			query:     "$__timeBinTz(Timestamp, 1d)",
+			returnIs:  assert.Equal,
+			returnVal: "bin(Timestamp, 1d)",
+		},
+		{
+			name:      "should fail $__timeBinTz with an invalid timezone",
+			macroData: NewMacroData(nil, 0).WithTimezone("Europe/Paris') | take 1"),
+			errorIs:   assert.Error,
+			query:     "$__timeBinTz(Timestamp)",
+			returnIs:  assert.Equal,
+			returnVal: "",
+		},
+		{
+			name: "should parse $__timeGroup",
+			macroData: NewMacroData(&backend.TimeRange{
+				From: fromTime,
+				To:   toTime,
+			}, 60000),
+			errorIs:   assert.NoError,
+			query:     "T | make-series count() $__timeGroup(Timestamp)",
+			returnIs:  assert.Equal,
+			returnVal: fmt.Sprintf("T | make-series count() on Timestamp from bin(%v, 60000ms) to %v step 60000ms", fromString, toString),
+		},
+		{
+			name: "should parse $__timeGroup with a fill value",
+			macroData: NewMacroData(&backend.TimeRange{
+				From: fromTime,
+				To:   toTime,
+			}, 60000),
+			errorIs:   assert.NoError,
+			query:     "T | make-series avg(Value) $__timeGroup(Timestamp, 1m, null) by Host",
+			returnIs:  assert.Equal,
+			returnVal: fmt.Sprintf("T | make-series avg(Value) default=real(null) on Timestamp from bin(%v, 1m) to %v step 1m by Host", fromString, toString),
+		},
+		{
+			name: "should parse $__timeGroup with an automatic interval",
+			macroData: NewMacroData(&backend.TimeRange{
+				From: fromTime,
+				To:   toTime,
+			}, 60000),
+			errorIs:   assert.NoError,
+			query:     "$__timeGroup(Timestamp, auto, 0)",
+			returnIs:  assert.Equal,
+			returnVal: fmt.Sprintf("default=0 on Timestamp from bin(%v, 60000ms) to %v step 60000ms", fromString, toString),
+		},
+
+		{
+			name: "should parse $__timeFilter with a nested call",
+			macroData: NewMacroData(&backend.TimeRange{
+				From: fromTime,
+				To:   toTime,
+			}, 0),
+			errorIs:   assert.NoError,
+			query:     "$__timeFilter(unixtime_seconds_todatetime(ts / 1000))",
+			returnIs:  assert.Equal,
+			returnVal: fmt.Sprintf("unixtime_seconds_todatetime(ts / 1000) >= %v and unixtime_seconds_todatetime(ts / 1000) <= %v", fromString, toString),
+		},
+		{
+			name:      "should parse macros passed to macros",
+			macroData: NewMacroData(nil, 30000),
+			errorIs:   assert.NoError,
+			query:     "$__timeBin(Timestamp, $__timeInterval * 2)",
+			returnIs:  assert.Equal,
+			returnVal: "bin(Timestamp, 30000ms * 2)",
+		},
+		{
+			name: "should ignore macros in string literals and comments",
+			macroData: NewMacroData(&backend.TimeRange{
+				From: fromTime,
+			}, 0),
+			errorIs:   assert.NoError,
+			query:     "T // since $__timeFrom\n| where Message != 'after $__timeFrom' and t > $__timeFrom",
+			returnIs:  assert.Equal,
+			returnVal: fmt.Sprintf("T // since $__timeFrom\n| where Message != 'after $__timeFrom' and t > %v", fromString),
+		},
+		{
+			name:      "should leave unknown macros",
+			macroData: NewMacroData(nil, 0),
+			errorIs:   assert.NoError,
+			query:     "$__timeFromX and $__other(1)",
+			returnIs:  assert.Equal,
+			returnVal: "$__timeFromX and $__other(1)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -137,3 +316,50 @@ func TestMacroData_Interpolate(t *testing.T) {
 		})
 	}
 }
+
+func TestMacroData_InterpolateErrors(t *testing.T) {
+	md := NewMacroData(&backend.TimeRange{}, 0)
+	tests := []struct {
+		name    string
+		query   string
+		macro   string
+		line    int
+		column  int
+		message string
+	}{
+		{
+			name:    "unclosed parenthesis",
+			query:   "T\n| where $__timeFilter(todatetime(ts)",
+			line:    2,
+			column:  22,
+			message: "line 2, column 22: '(' is not closed",
+		},
+		{
+			name:    "invalid arguments",
+			query:   "T\n| summarize count() by $__timeBin(t, 1h, 2h)",
+			macro:   "$__timeBin",
+			line:    2,
+			column:  24,
+			message: "$__timeBin at line 2, column 24: expected at most 2 arguments, got 3",
+		},
+		{
+			name:    "invalid arguments of a nested macro",
+			query:   "$__timeBin(t, $__timeFilterUnix(t, us))",
+			macro:   "$__timeFilterUnix",
+			line:    1,
+			column:  15,
+			message: `$__timeFilterUnix at line 1, column 15: unit must be s or ms, got "us"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := md.Interpolate(tt.query)
+			var macroErr *MacroError
+			require.ErrorAs(t, err, &macroErr)
+			assert.Equal(t, tt.macro, macroErr.Macro)
+			assert.Equal(t, tt.line, macroErr.Line)
+			assert.Equal(t, tt.column, macroErr.Column)
+			assert.Equal(t, tt.message, macroErr.Error())
+		})
+	}
+}
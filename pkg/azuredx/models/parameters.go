@@ -0,0 +1,240 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/kql"
+)
+
+// Kusto types a query parameter can be declared with.
+const (
+	ParameterTypeString   = "string"
+	ParameterTypeDatetime = "datetime"
+	ParameterTypeLong     = "long"
+	ParameterTypeReal     = "real"
+	ParameterTypeDynamic  = "dynamic"
+	ParameterTypeTimespan = "timespan"
+)
+
+var parameterNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// QueryParameter is a typed value sent to the cluster separately from the query text.
+type QueryParameter struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// DeclareParameters declares the parameters of the query with a `declare query_parameters`
+// statement, inserted after the `set` statements the query starts with, and returns their values
+// formatted as Kusto literals, to be sent in the parameters of the request properties.
+// https://learn.microsoft.com/en-us/kusto/query/query-parameters-statement
+func (qm *QueryModel) DeclareParameters() (map[string]string, error) {
+	if len(qm.Parameters) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(qm.Parameters))
+	for name := range qm.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	declarations := make([]string, 0, len(names))
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		if !parameterNameRegex.MatchString(name) {
+			return nil, backend.DownstreamError(fmt.Errorf("invalid query parameter name %q", name))
+		}
+		p := qm.Parameters[name]
+		literal, err := p.literal()
+		if err != nil {
+			return nil, backend.DownstreamError(fmt.Errorf("invalid value of query parameter %q: %w", name, err))
+		}
+		declarations = append(declarations, name+":"+p.Type)
+		values[name] = literal
+	}
+
+	declaration := "declare query_parameters(" + strings.Join(declarations, ", ") + ");"
+	if end := setStatementsEnd(qm.Query); end > 0 {
+		qm.Query = qm.Query[:end] + "\n" + declaration + qm.Query[end:]
+	} else {
+		qm.Query = declaration + "\n" + qm.Query
+	}
+	return values, nil
+}
+
+// setStatementsEnd returns the offset after the `set` statements the query starts with, which
+// Kusto requires to come before any other statement.
+// https://learn.microsoft.com/en-us/kusto/query/set-statement
+func setStatementsEnd(query string) int {
+	// the statements before an error of the tokenizer are still complete
+	tokens, _ := kql.Tokenize(query)
+	end := 0
+	for i := 0; i+1 < len(tokens) && tokens[i].Is("set") && tokens[i+1].Kind == kql.KindIdentifier; {
+		semicolon := i + 2
+		for semicolon < len(tokens) && !tokens[semicolon].Is(";") {
+			semicolon++
+		}
+		if semicolon == len(tokens) {
+			break
+		}
+		end = tokens[semicolon].End
+		i = semicolon + 1
+	}
+	return end
+}
+
+// literal formats the value of the parameter as a literal of its Kusto type.
+func (p QueryParameter) literal() (string, error) {
+	switch p.Type {
+	case ParameterTypeString:
+		s, ok := p.Value.(string)
+		if !ok {
+			return "", fmt.Errorf("expected a string")
+		}
+		return quoteString(s), nil
+	case ParameterTypeLong:
+		n, err := parameterLong(p.Value)
+		if err != nil {
+			return "", err
+		}
+		return "long(" + strconv.FormatInt(n, 10) + ")", nil
+	case ParameterTypeReal:
+		f, err := parameterReal(p.Value)
+		if err != nil {
+			return "", err
+		}
+		return "real(" + formatReal(f) + ")", nil
+	case ParameterTypeDatetime:
+		t, err := parameterDatetime(p.Value)
+		if err != nil {
+			return "", err
+		}
+		return "datetime(" + t.UTC().Format("2006-01-02T15:04:05.0000000Z") + ")", nil
+	case ParameterTypeTimespan:
+		d, err := parameterTimespan(p.Value)
+		if err != nil {
+			return "", err
+		}
+		return "timespan(" + formatTimespan(d) + ")", nil
+	case ParameterTypeDynamic:
+		b, err := json.Marshal(p.Value)
+		if err != nil {
+			return "", err
+		}
+		return "dynamic(" + string(b) + ")", nil
+	}
+	return "", fmt.Errorf("unsupported type %q", p.Type)
+}
+
+func parameterLong(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case float64:
+		if v != math.Trunc(v) || v >= math.MaxInt64 || v < math.MinInt64 {
+			return 0, fmt.Errorf("expected an integer")
+		}
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("expected an integer")
+}
+
+func parameterReal(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("expected a number")
+}
+
+// parameterDatetime accepts RFC 3339 timestamps and milliseconds since the Unix epoch.
+func parameterDatetime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case float64:
+		return time.UnixMilli(int64(v)), nil
+	case string:
+		return time.Parse(time.RFC3339Nano, v)
+	}
+	return time.Time{}, fmt.Errorf("expected an RFC 3339 timestamp or milliseconds since the epoch")
+}
+
+// parameterTimespan accepts Kusto timespans such as 1.02:03:04, Go durations such as 90s and
+// numbers of milliseconds.
+func parameterTimespan(v interface{}) (time.Duration, error) {
+	switch v := v.(type) {
+	case float64:
+		return time.Duration(v * float64(time.Millisecond)), nil
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d, nil
+		}
+		return parseTimespan(v)
+	}
+	return 0, fmt.Errorf("expected a timespan, a duration or milliseconds")
+}
+
+// quoteString returns s as a double quoted Kusto string literal.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func formatReal(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "+inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatTimespan formats d as [-]d.hh:mm:ss.fffffff, keeping the 100ns precision of Kusto timespans.
+func formatTimespan(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	days := d / day
+	d -= days * day
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+	d -= seconds * time.Second
+	return fmt.Sprintf("%s%d.%02d:%02d:%02d.%07d", sign, days, hours, minutes, seconds, d/100)
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeclareParameters(t *testing.T) {
+	t.Run("query without parameters is left unchanged", func(t *testing.T) {
+		qm := QueryModel{Query: "T | take 10"}
+		values, err := qm.DeclareParameters()
+		require.NoError(t, err)
+		assert.Nil(t, values)
+		assert.Equal(t, "T | take 10", qm.Query)
+	})
+
+	t.Run("parameters are declared and formatted as literals", func(t *testing.T) {
+		qm := QueryModel{Query: "T | where Name == name and Count > minCount"}
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"name": {"type": "string", "value": "say \"hi\"\\n"},
+			"minCount": {"type": "long", "value": 10},
+			"ratio": {"type": "real", "value": 0.25},
+			"from": {"type": "datetime", "value": "2024-01-02T03:04:05.5Z"},
+			"window": {"type": "timespan", "value": "1h30m"},
+			"tags": {"type": "dynamic", "value": ["a", "b"]}
+		}`), &qm.Parameters))
+
+		values, err := qm.DeclareParameters()
+		require.NoError(t, err)
+		assert.Equal(t, "declare query_parameters(from:datetime, minCount:long, name:string, ratio:real, tags:dynamic, window:timespan);\nT | where Name == name and Count > minCount", qm.Query)
+		assert.Equal(t, map[string]string{
+			"name":     `"say \"hi\"\\n"`,
+			"minCount": "long(10)",
+			"ratio":    "real(0.25)",
+			"from":     "datetime(2024-01-02T03:04:05.5000000Z)",
+			"window":   "timespan(0.01:30:00.0000000)",
+			"tags":     `dynamic(["a","b"])`,
+		}, values)
+	})
+
+	t.Run("parameters are declared after set statements", func(t *testing.T) {
+		qm := QueryModel{
+			Query:      "set truncationmaxrecords = 10;\nset query_now = datetime(2024-01-02);\nT | where Count > minCount",
+			Parameters: map[string]QueryParameter{"minCount": {Type: ParameterTypeLong, Value: float64(1)}},
+		}
+		_, err := qm.DeclareParameters()
+		require.NoError(t, err)
+		assert.Equal(t, "set truncationmaxrecords = 10;\nset query_now = datetime(2024-01-02);\ndeclare query_parameters(minCount:long);\nT | where Count > minCount", qm.Query)
+	})
+
+	t.Run("a set statement without a semicolon is not skipped", func(t *testing.T) {
+		qm := QueryModel{
+			Query:      "set notruncation\nT",
+			Parameters: map[string]QueryParameter{"a": {Type: ParameterTypeLong, Value: float64(1)}},
+		}
+		_, err := qm.DeclareParameters()
+		require.NoError(t, err)
+		assert.Equal(t, "declare query_parameters(a:long);\nset notruncation\nT", qm.Query)
+	})
+
+	t.Run("invalid parameter name", func(t *testing.T) {
+		qm := QueryModel{Parameters: map[string]QueryParameter{"a); T | take 1; declare query_parameters(b": {Type: ParameterTypeLong, Value: float64(1)}}}
+		_, err := qm.DeclareParameters()
+		assert.ErrorContains(t, err, "invalid query parameter name")
+	})
+
+	t.Run("unsupported parameter type", func(t *testing.T) {
+		qm := QueryModel{Parameters: map[string]QueryParameter{"a": {Type: "guid", Value: "x"}}}
+		_, err := qm.DeclareParameters()
+		assert.ErrorContains(t, err, `invalid value of query parameter "a": unsupported type "guid"`)
+	})
+
+	t.Run("value of the wrong type", func(t *testing.T) {
+		qm := QueryModel{Parameters: map[string]QueryParameter{"a": {Type: ParameterTypeLong, Value: float64(1.5)}}}
+		_, err := qm.DeclareParameters()
+		assert.ErrorContains(t, err, `invalid value of query parameter "a": expected an integer`)
+	})
+}
+
+func TestQueryParameterLiteral(t *testing.T) {
+	tests := []struct {
+		name     string
+		param    QueryParameter
+		expected string
+	}{
+		{name: "long from string", param: QueryParameter{Type: ParameterTypeLong, Value: "-42"}, expected: "long(-42)"},
+		{name: "real from string", param: QueryParameter{Type: ParameterTypeReal, Value: "1e3"}, expected: "real(1000)"},
+		{name: "datetime from epoch milliseconds", param: QueryParameter{Type: ParameterTypeDatetime, Value: float64(1704164645000)}, expected: "datetime(2024-01-02T03:04:05.0000000Z)"},
+		{name: "timespan from kusto timespan", param: QueryParameter{Type: ParameterTypeTimespan, Value: "1.02:03:04.5"}, expected: "timespan(1.02:03:04.5000000)"},
+		{name: "timespan from milliseconds", param: QueryParameter{Type: ParameterTypeTimespan, Value: float64(1500)}, expected: "timespan(0.00:00:01.5000000)"},
+		{name: "negative timespan", param: QueryParameter{Type: ParameterTypeTimespan, Value: "-5m"}, expected: "timespan(-0.00:05:00.0000000)"},
+		{name: "dynamic object", param: QueryParameter{Type: ParameterTypeDynamic, Value: map[string]interface{}{"a": float64(1)}}, expected: `dynamic({"a":1})`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			literal, err := tt.param.literal()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, literal)
+		})
+	}
+}
+
+func TestFormatTimespan(t *testing.T) {
+	assert.Equal(t, "0.00:00:00.0000000", formatTimespan(0))
+	assert.Equal(t, "2.03:04:05.0000001", formatTimespan(2*day+3*time.Hour+4*time.Minute+5*time.Second+100*time.Nanosecond))
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+type propertyKind int
+
+const (
+	propertyKindBool propertyKind = iota
+	propertyKindInt
+	propertyKindString
+)
+
+// clientRequestProperty describes the values accepted for a client request property.
+type clientRequestProperty struct {
+	kind propertyKind
+	// min is the lowest value of integer properties, max the highest when it is not zero.
+	min, max int64
+	// values lists the accepted values of string properties, any value is accepted when empty.
+	values []string
+}
+
+// clientRequestProperties are the client request properties a query is allowed to set.
+// Properties managed by the datasource settings, such as the server timeout, are left out.
+// https://learn.microsoft.com/en-us/kusto/api/rest/request-properties
+var clientRequestProperties = map[string]clientRequestProperty{
+	"deferpartialqueryfailures":                 {kind: propertyKindBool},
+	"max_memory_consumption_per_query_per_node": {kind: propertyKindInt, min: 1},
+	"maxmemoryconsumptionperiterator":           {kind: propertyKindInt, min: 1},
+	"maxoutputcolumns":                          {kind: propertyKindInt, min: 1},
+	"notruncation":                              {kind: propertyKindBool},
+	"push_selection_through_aggregation":        {kind: propertyKindBool},
+	"query_bin_auto_at":                         {kind: propertyKindString},
+	"query_bin_auto_size":                       {kind: propertyKindString},
+	"query_datascope":                           {kind: propertyKindString, values: []string{"default", "all", "hotcache"}},
+	"query_fanout_nodes_percent":                {kind: propertyKindInt, min: 1, max: 100},
+	"query_fanout_threads_percent":              {kind: propertyKindInt, min: 1, max: 100},
+	"query_force_row_level_security":            {kind: propertyKindBool},
+	"query_now":                                 {kind: propertyKindString},
+	"query_take_max_records":                    {kind: propertyKindInt, min: 1},
+	"request_callout_disabled":                  {kind: propertyKindBool},
+	"request_readonly":                          {kind: propertyKindBool},
+	"request_remote_entities_disabled":          {kind: propertyKindBool},
+	"request_sandboxed_execution_disabled":      {kind: propertyKindBool},
+}
+
+// ValidateClientRequestProperties checks the client request properties of the query against the
+// allow list and normalizes numbers decoded from JSON to integers.
+func (qm *QueryModel) ValidateClientRequestProperties() error {
+	names := make([]string, 0, len(qm.ClientRequestProperties))
+	for name := range qm.ClientRequestProperties {
+		names = append(names, name)
+	}
+	// sorted so the same invalid query always reports the same error
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := validateClientRequestProperty(name, qm.ClientRequestProperties[name])
+		if err != nil {
+			return backend.DownstreamError(err)
+		}
+		qm.ClientRequestProperties[name] = value
+	}
+	return nil
+}
+
+func validateClientRequestProperty(name string, value interface{}) (interface{}, error) {
+	p, ok := clientRequestProperties[name]
+	if !ok {
+		return nil, fmt.Errorf("client request property %q is not supported", name)
+	}
+
+	switch p.kind {
+	case propertyKindBool:
+		if _, ok := value.(bool); !ok {
+			return nil, fmt.Errorf("client request property %q must be a boolean", name)
+		}
+	case propertyKindInt:
+		f, ok := value.(float64)
+		if !ok || f != math.Trunc(f) || f >= math.MaxInt64 || f < math.MinInt64 {
+			return nil, fmt.Errorf("client request property %q must be an integer", name)
+		}
+		n := int64(f)
+		if n < p.min || (p.max != 0 && n > p.max) {
+			if p.max != 0 {
+				return nil, fmt.Errorf("client request property %q must be between %d and %d", name, p.min, p.max)
+			}
+			return nil, fmt.Errorf("client request property %q must be at least %d", name, p.min)
+		}
+		return n, nil
+	case propertyKindString:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("client request property %q must be a string", name)
+		}
+		if len(p.values) > 0 && !slices.Contains(p.values, s) {
+			return nil, fmt.Errorf("client request property %q must be one of %v", name, p.values)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateClientRequestProperties(t *testing.T) {
+	tests := []struct {
+		name     string
+		props    string
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "no properties",
+			props:    `{}`,
+			expected: map[string]interface{}{},
+		},
+		{
+			name:  "supported properties",
+			props: `{"query_datascope": "hotcache", "maxmemoryconsumptionperiterator": 68719476736, "query_fanout_nodes_percent": 50, "request_readonly": true, "notruncation": false}`,
+			expected: map[string]interface{}{
+				"query_datascope":                 "hotcache",
+				"maxmemoryconsumptionperiterator": int64(68719476736),
+				"query_fanout_nodes_percent":      int64(50),
+				"request_readonly":                true,
+				"notruncation":                    false,
+			},
+		},
+		{
+			name:  "unsupported property",
+			props: `{"servertimeout": "01:00:00"}`,
+			err:   `client request property "servertimeout" is not supported`,
+		},
+		{
+			name:  "boolean of the wrong type",
+			props: `{"notruncation": "true"}`,
+			err:   `client request property "notruncation" must be a boolean`,
+		},
+		{
+			name:  "integer with a fraction",
+			props: `{"query_take_max_records": 1.5}`,
+			err:   `client request property "query_take_max_records" must be an integer`,
+		},
+		{
+			name:  "integer below the minimum",
+			props: `{"max_memory_consumption_per_query_per_node": 0}`,
+			err:   `client request property "max_memory_consumption_per_query_per_node" must be at least 1`,
+		},
+		{
+			name:  "integer out of range",
+			props: `{"query_fanout_threads_percent": 101}`,
+			err:   `client request property "query_fanout_threads_percent" must be between 1 and 100`,
+		},
+		{
+			name:  "string not in the accepted values",
+			props: `{"query_datascope": "coldcache"}`,
+			err:   `client request property "query_datascope" must be one of [default all hotcache]`,
+		},
+		{
+			name:  "first invalid property is reported",
+			props: `{"b_unsupported": true, "a_unsupported": true}`,
+			err:   `client request property "a_unsupported" is not supported`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qm := QueryModel{}
+			require.NoError(t, json.Unmarshal([]byte(tt.props), &qm.ClientRequestProperties))
+
+			err := qm.ValidateClientRequestProperties()
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, qm.ClientRequestProperties)
+		})
+	}
+}
+
+func TestNewConnectionProperties(t *testing.T) {
+	settings := &DatasourceSettings{
+		DataConsistency:      "weakconsistency",
+		CacheMaxAge:          "5m",
+		ServerTimeoutValue:   "00:00:30",
+		TruncationMaxRecords: 1000,
+	}
+
+	t.Run("uses the datasource settings", func(t *testing.T) {
+		props := NewConnectionProperties(settings, nil, nil)
+		b, err := json.Marshal(props)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"options":{"queryconsistency":"weakconsistency","query_results_cache_max_age":"5m","servertimeout":"00:00:30","truncationmaxrecords":1000}}`, string(b))
+	})
+
+	t.Run("merges the options of the query", func(t *testing.T) {
+		qm := &QueryModel{
+			TruncationMaxRecords: 10,
+			ClientRequestProperties: map[string]interface{}{
+				"query_datascope":  "hotcache",
+				"request_readonly": true,
+			},
+		}
+		props := NewConnectionProperties(settings, &CacheSettings{CacheMaxAge: "1m"}, qm)
+		b, err := json.Marshal(props)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"options":{"queryconsistency":"weakconsistency","query_results_cache_max_age":"1m","servertimeout":"00:00:30","truncationmaxrecords":10,"query_datascope":"hotcache","request_readonly":true}}`, string(b))
+	})
+}
@@ -1,14 +1,46 @@
 package models
 
+import "github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/expression"
+
+// Query types. KQL queries run their query, while the other types list the clusters, databases,
+// tables or columns the datasource can query, for template variables.
+const (
+	QueryTypeKQL       = "KQL"
+	QueryTypeClusters  = "Clusters"
+	QueryTypeDatabases = "Databases"
+	QueryTypeTables    = "Tables"
+	QueryTypeColumns   = "Columns"
+)
+
 // QueryModel contains the query information from the API call that we use to make a query.
 type QueryModel struct {
-	Format      string `json:"resultFormat"`
-	QueryType   string `json:"queryType"`
-	Query       string `json:"query"`
-	Database    string `json:"database"`
-	QuerySource string `json:"querySource"` // used to identify if query came from getSchema, raw mode, etc
-	ClusterUri  string `json:"clusterUri,omitempty"`
-	MacroData   MacroData
+	Format          string `json:"resultFormat"`
+	QueryType       string `json:"queryType"`
+	Query           string `json:"query"`
+	Database        string `json:"database"`
+	QuerySource     string `json:"querySource"` // used to identify if query came from getSchema, raw mode, etc
+	ClusterUri      string `json:"clusterUri,omitempty"`
+	Table           string `json:"table,omitempty"`           // table of the Columns query type
+	AllResultTables bool   `json:"allResultTables,omitempty"` // return every result table as its own frame instead of only the primary one
+	Timezone        string `json:"timezone,omitempty"`        // IANA timezone of the dashboard, used by $__timeBinTz
+	Alias           string `json:"alias,omitempty"`           // display name of the series of time series, see ApplyAlias
+	MacroData       MacroData
+
+	// RawMode is false for queries of the visual query editor, whose Expression the backend compiles
+	// rather than trusting the Query compiled by the browser, which may be stale.
+	RawMode    *bool                       `json:"rawMode,omitempty"`
+	Expression *expression.QueryExpression `json:"expression,omitempty"`
+
+	// TruncationMaxRecords and TruncationMaxSize override the truncation limits of the datasource settings.
+	TruncationMaxRecords int64 `json:"truncationMaxRecords,omitempty"`
+	TruncationMaxSize    int64 `json:"truncationMaxSize,omitempty"`
+
+	// ClientRequestProperties are extra client request properties sent with the query, limited to
+	// the ones allowed by ValidateClientRequestProperties.
+	ClientRequestProperties map[string]interface{} `json:"clientRequestProperties,omitempty"`
+
+	// Parameters are declared by the query and sent to the cluster separately from the query text.
+	Parameters map[string]QueryParameter `json:"parameters,omitempty"`
 }
 
 // Interpolate applies macro expansion on the QueryModel's Payload's Query string
@@ -0,0 +1,292 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Schema is the schema of the databases of a cluster, as returned by `.show databases schema as json`.
+// The schema resource returns it to the browser with every map and list set, even when empty.
+type Schema struct {
+	Databases map[string]*DatabaseSchema
+}
+
+// DatabaseSchema is the schema of a database.
+type DatabaseSchema struct {
+	Name              string
+	Tables            map[string]*TableSchema
+	ExternalTables    map[string]*TableSchema
+	MaterializedViews map[string]*TableSchema
+	Functions         map[string]*FunctionSchema
+}
+
+// TableSchema is the schema of a table, an external table or a materialized view.
+type TableSchema struct {
+	Name           string
+	Folder         string `json:",omitempty"`
+	DocString      string `json:",omitempty"`
+	OrderedColumns []ColumnSchema
+}
+
+// ColumnSchema is a column of a table, or a parameter or output column of a function. CslType is
+// the Kusto type of the column, such as datetime or dynamic, and Type the matching .NET type.
+type ColumnSchema struct {
+	Name            string
+	Type            string `json:",omitempty"`
+	CslType         string
+	CslDefaultValue string `json:",omitempty"`
+	DocString       string `json:",omitempty"`
+}
+
+// FunctionSchema is the schema of a stored function.
+type FunctionSchema struct {
+	Name            string
+	Body            string
+	Folder          string `json:",omitempty"`
+	FunctionKind    string
+	DocString       string `json:",omitempty"`
+	InputParameters []ColumnSchema
+	OutputColumns   []ColumnSchema
+}
+
+// SchemaFromTableResponse reads the schema held by the response to `.show databases schema as json`,
+// whose only cell is the schema as a JSON string.
+func SchemaFromTableResponse(tr *TableResponse) (*Schema, error) {
+	if tr == nil || len(tr.Tables) == 0 || len(tr.Tables[0].Rows) == 0 {
+		return nil, fmt.Errorf("schema response contains no rows")
+	}
+	row, ok := tr.Tables[0].Rows[0].([]interface{})
+	if !ok || len(row) == 0 {
+		return nil, fmt.Errorf("unexpected schema response row: %v", tr.Tables[0].Rows[0])
+	}
+	raw, ok := row[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected schema response value of type %T", row[0])
+	}
+	schema := &Schema{}
+	if err := json.Unmarshal([]byte(raw), schema); err != nil {
+		return nil, fmt.Errorf("malformed schema: %w", err)
+	}
+	schema.normalize()
+	return schema, nil
+}
+
+// normalize sets the maps and lists the cluster leaves out, so consumers need not check for them.
+func (s *Schema) normalize() {
+	if s.Databases == nil {
+		s.Databases = map[string]*DatabaseSchema{}
+	}
+	for name, db := range s.Databases {
+		if db == nil {
+			db = &DatabaseSchema{Name: name}
+			s.Databases[name] = db
+		}
+		for _, tables := range []*map[string]*TableSchema{&db.Tables, &db.ExternalTables, &db.MaterializedViews} {
+			if *tables == nil {
+				*tables = map[string]*TableSchema{}
+			}
+			for _, t := range *tables {
+				if t != nil && t.OrderedColumns == nil {
+					t.OrderedColumns = []ColumnSchema{}
+				}
+			}
+		}
+		if db.Functions == nil {
+			db.Functions = map[string]*FunctionSchema{}
+		}
+		for _, f := range db.Functions {
+			if f == nil {
+				continue
+			}
+			if f.InputParameters == nil {
+				f.InputParameters = []ColumnSchema{}
+			}
+			if f.OutputColumns == nil {
+				f.OutputColumns = []ColumnSchema{}
+			}
+		}
+	}
+}
+
+// SchemaFilter narrows down a schema. Empty fields match everything.
+type SchemaFilter struct {
+	// Database is the name of the only database to keep.
+	Database string
+	// Table is the name of the only table, external table, materialized view or function to keep.
+	Table string
+	// Prefix keeps the tables, external tables, materialized views and functions whose name starts
+	// with it, ignoring case.
+	Prefix string
+}
+
+// Filter returns the part of the schema that matches f. The schema is not modified, and the
+// returned one shares its tables and functions.
+func (s *Schema) Filter(f SchemaFilter) *Schema {
+	if f == (SchemaFilter{}) {
+		return s
+	}
+	filtered := &Schema{Databases: map[string]*DatabaseSchema{}}
+	for name, db := range s.Databases {
+		if f.Database != "" && name != f.Database {
+			continue
+		}
+		filtered.Databases[name] = &DatabaseSchema{
+			Name:              db.Name,
+			Tables:            filterEntities(db.Tables, f),
+			ExternalTables:    filterEntities(db.ExternalTables, f),
+			MaterializedViews: filterEntities(db.MaterializedViews, f),
+			Functions:         filterEntities(db.Functions, f),
+		}
+	}
+	return filtered
+}
+
+func filterEntities[T any](entities map[string]T, f SchemaFilter) map[string]T {
+	filtered := make(map[string]T, len(entities))
+	for name, e := range entities {
+		if f.Table != "" && name != f.Table {
+			continue
+		}
+		if f.Prefix != "" && !strings.HasPrefix(strings.ToLower(name), strings.ToLower(f.Prefix)) {
+			continue
+		}
+		filtered[name] = e
+	}
+	return filtered
+}
+
+// Columns returns the names of the columns of a table, external table, materialized view or
+// function of the database, and whether it exists. Functions without output columns in the schema
+// return nil columns.
+func (db *DatabaseSchema) Columns(table string) ([]string, bool) {
+	columns, ok := db.ColumnSchemas(table)
+	if columns == nil {
+		return nil, ok
+	}
+	return columnNames(columns), true
+}
+
+// ColumnSchemas is like Columns, but returns a copy of the columns with their types.
+func (db *DatabaseSchema) ColumnSchemas(table string) ([]ColumnSchema, bool) {
+	for _, tables := range []map[string]*TableSchema{db.Tables, db.MaterializedViews, db.ExternalTables} {
+		if t, ok := tables[table]; ok {
+			return append([]ColumnSchema{}, t.OrderedColumns...), true
+		}
+	}
+	if f, ok := db.Functions[table]; ok {
+		if len(f.OutputColumns) == 0 {
+			return nil, true
+		}
+		return append([]ColumnSchema{}, f.OutputColumns...), true
+	}
+	return nil, false
+}
+
+func columnNames(columns []ColumnSchema) []string {
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// DatabaseInfo is a database of a cluster, as listed by `.show databases`.
+type DatabaseInfo struct {
+	Name       string `json:"name"`
+	PrettyName string `json:"prettyName,omitempty"`
+}
+
+// DatabasesFromTableResponse reads the databases listed by the response to `.show databases`.
+func DatabasesFromTableResponse(tr *TableResponse) ([]DatabaseInfo, error) {
+	databases := []DatabaseInfo{}
+	err := readColumns(tr, []string{"DatabaseName", "PrettyName"}, func(values []string) {
+		databases = append(databases, DatabaseInfo{Name: values[0], PrettyName: values[1]})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return databases, nil
+}
+
+// DatabaseVersions reads the schema version of every database from the response to `.show databases`.
+// The version changes whenever the schema of the database does.
+func DatabaseVersions(tr *TableResponse) (map[string]string, error) {
+	versions := map[string]string{}
+	err := readColumns(tr, []string{"DatabaseName", "Version"}, func(values []string) {
+		versions[values[0]] = values[1]
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// TableNamesFromTableResponse reads the names of the tables listed by the response to `.show tables`.
+func TableNamesFromTableResponse(tr *TableResponse) ([]string, error) {
+	names := []string{}
+	err := readColumns(tr, []string{"TableName"}, func(values []string) {
+		names = append(names, values[0])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// TableSchemaFromTableResponse reads the schema held by the response to
+// `.show table T schema as json`, whose Schema column holds the schema as a JSON string.
+func TableSchemaFromTableResponse(tr *TableResponse) (*TableSchema, error) {
+	var raw []string
+	err := readColumns(tr, []string{"Schema"}, func(values []string) {
+		raw = append(raw, values[0])
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("table schema response contains no rows")
+	}
+	schema := &TableSchema{}
+	if err := json.Unmarshal([]byte(raw[0]), schema); err != nil {
+		return nil, fmt.Errorf("malformed table schema: %w", err)
+	}
+	return schema, nil
+}
+
+// readColumns calls fn with the values of columns for every row of the response to a management
+// command. Values that are not strings, such as null pretty names, are empty.
+func readColumns(tr *TableResponse, columns []string, fn func(values []string)) error {
+	if tr == nil || len(tr.Tables) == 0 {
+		return fmt.Errorf("response contains no tables")
+	}
+	t := tr.Tables[0]
+	indexes := make([]int, len(columns))
+	for i, name := range columns {
+		indexes[i] = -1
+		for j, c := range t.Columns {
+			if c.ColumnName == name {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return fmt.Errorf("response has no %s column", name)
+		}
+	}
+	values := make([]string, len(columns))
+	for _, r := range t.Rows {
+		row, ok := r.([]interface{})
+		if !ok {
+			return fmt.Errorf("unexpected response row: %v", r)
+		}
+		for i, idx := range indexes {
+			if idx >= len(row) {
+				return fmt.Errorf("unexpected response row: %v", r)
+			}
+			values[i], _ = row[idx].(string)
+		}
+		fn(values)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaFromTableResponse(t *testing.T) {
+	raw := `{"Databases":{"db":{"Name":"db",` +
+		`"Tables":{"StormEvents":{"Name":"StormEvents","OrderedColumns":[{"Name":"StartTime","Type":"System.DateTime","CslType":"datetime"},{"Name":"State","Type":"System.String","CslType":"string"}]}},` +
+		`"ExternalTables":{"Archive":{"Name":"Archive","OrderedColumns":[{"Name":"Payload","CslType":"dynamic"}]}},` +
+		`"MaterializedViews":{"DailyEvents":{"Name":"DailyEvents","OrderedColumns":[{"Name":"Day","CslType":"datetime"}]}},` +
+		`"Functions":{"Recent":{"Name":"Recent","Body":"{ StormEvents }","FunctionKind":"Unknown","InputParameters":[],"OutputColumns":[]}}}}}`
+	tr := &TableResponse{Tables: []Table{{
+		TableName: "Table_0",
+		Columns:   []Column{{ColumnName: "DatabaseSchema", ColumnType: "string"}},
+		Rows:      []Row{[]interface{}{raw}},
+	}}}
+
+	schema, err := SchemaFromTableResponse(tr)
+	require.NoError(t, err)
+	db := schema.Databases["db"]
+	require.NotNil(t, db)
+
+	columns, ok := db.Columns("StormEvents")
+	require.True(t, ok)
+	require.Equal(t, []string{"StartTime", "State"}, columns)
+
+	columns, ok = db.Columns("Archive")
+	require.True(t, ok)
+	require.Equal(t, []string{"Payload"}, columns)
+
+	columns, ok = db.Columns("DailyEvents")
+	require.True(t, ok)
+	require.Equal(t, []string{"Day"}, columns)
+
+	columns, ok = db.Columns("Recent")
+	require.True(t, ok)
+	require.Nil(t, columns)
+
+	_, ok = db.Columns("Missing")
+	require.False(t, ok)
+
+	// the lists the cluster leaves out are set
+	require.Equal(t, []ColumnSchema{}, db.Functions["Recent"].OutputColumns)
+	schema, err = SchemaFromTableResponse(&TableResponse{Tables: []Table{{Rows: []Row{[]interface{}{`{"Databases":{"db":{"Name":"db"}}}`}}}}})
+	require.NoError(t, err)
+	require.Equal(t, &DatabaseSchema{
+		Name:              "db",
+		Tables:            map[string]*TableSchema{},
+		ExternalTables:    map[string]*TableSchema{},
+		MaterializedViews: map[string]*TableSchema{},
+		Functions:         map[string]*FunctionSchema{},
+	}, schema.Databases["db"])
+
+	_, err = SchemaFromTableResponse(&TableResponse{Tables: []Table{{}}})
+	require.Error(t, err)
+}
+
+func TestDatabaseVersions(t *testing.T) {
+	tr := &TableResponse{Tables: []Table{{
+		Columns: []Column{{ColumnName: "DatabaseName"}, {ColumnName: "PersistentStorage"}, {ColumnName: "Version"}},
+		Rows: []Row{
+			[]interface{}{"db1", "", "v1.2"},
+			[]interface{}{"db2", "", "v7.0"},
+		},
+	}}}
+	versions, err := DatabaseVersions(tr)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"db1": "v1.2", "db2": "v7.0"}, versions)
+
+	_, err = DatabaseVersions(&TableResponse{Tables: []Table{{Columns: []Column{{ColumnName: "DatabaseName"}}}}})
+	require.Error(t, err)
+}
+
+func TestSchemaFilter(t *testing.T) {
+	events := &TableSchema{Name: "StormEvents"}
+	archive := &TableSchema{Name: "stormArchive"}
+	daily := &TableSchema{Name: "DailyEvents"}
+	count := &FunctionSchema{Name: "StormCount"}
+	schema := &Schema{Databases: map[string]*DatabaseSchema{
+		"db": {
+			Name:              "db",
+			Tables:            map[string]*TableSchema{"StormEvents": events, "Logs": {Name: "Logs"}},
+			ExternalTables:    map[string]*TableSchema{"stormArchive": archive},
+			MaterializedViews: map[string]*TableSchema{"DailyEvents": daily},
+			Functions:         map[string]*FunctionSchema{"StormCount": count},
+		},
+		"other": {Name: "other", Tables: map[string]*TableSchema{"StormEvents": events}},
+	}}
+
+	require.Same(t, schema, schema.Filter(SchemaFilter{}))
+
+	require.Equal(t, &Schema{Databases: map[string]*DatabaseSchema{"db": {
+		Name:              "db",
+		Tables:            map[string]*TableSchema{"StormEvents": events},
+		ExternalTables:    map[string]*TableSchema{"stormArchive": archive},
+		MaterializedViews: map[string]*TableSchema{},
+		Functions:         map[string]*FunctionSchema{"StormCount": count},
+	}}}, schema.Filter(SchemaFilter{Database: "db", Prefix: "STORM"}))
+
+	filtered := schema.Filter(SchemaFilter{Table: "DailyEvents"})
+	require.Len(t, filtered.Databases, 2)
+	require.Equal(t, map[string]*TableSchema{"DailyEvents": daily}, filtered.Databases["db"].MaterializedViews)
+	require.Empty(t, filtered.Databases["db"].Tables)
+	require.Empty(t, filtered.Databases["other"].Tables)
+
+	// the filtered schema is a copy
+	require.Len(t, schema.Databases["db"].Tables, 2)
+}
+
+func TestDatabasesFromTableResponse(t *testing.T) {
+	tr := &TableResponse{Tables: []Table{{
+		Columns: []Column{{ColumnName: "DatabaseName"}, {ColumnName: "Version"}, {ColumnName: "PrettyName"}},
+		Rows: []Row{
+			[]interface{}{"db1", "v1.2", "Database One"},
+			[]interface{}{"db2", "v7.0", nil},
+		},
+	}}}
+	databases, err := DatabasesFromTableResponse(tr)
+	require.NoError(t, err)
+	require.Equal(t, []DatabaseInfo{{Name: "db1", PrettyName: "Database One"}, {Name: "db2"}}, databases)
+
+	databases, err = DatabasesFromTableResponse(&TableResponse{Tables: []Table{{Columns: tr.Tables[0].Columns}}})
+	require.NoError(t, err)
+	require.Equal(t, []DatabaseInfo{}, databases)
+
+	_, err = DatabasesFromTableResponse(&TableResponse{Tables: []Table{{Columns: []Column{{ColumnName: "DatabaseName"}}}}})
+	require.Error(t, err)
+}
+
+func TestTableNamesFromTableResponse(t *testing.T) {
+	names, err := TableNamesFromTableResponse(&TableResponse{Tables: []Table{{
+		Columns: []Column{{ColumnName: "TableName"}, {ColumnName: "DatabaseName"}},
+		Rows:    []Row{[]interface{}{"StormEvents", "db"}, []interface{}{"Logs", "db"}},
+	}}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"StormEvents", "Logs"}, names)
+
+	_, err = TableNamesFromTableResponse(&TableResponse{})
+	require.Error(t, err)
+}
+
+func TestTableSchemaFromTableResponse(t *testing.T) {
+	schema, err := TableSchemaFromTableResponse(&TableResponse{Tables: []Table{{
+		Columns: []Column{{ColumnName: "TableName"}, {ColumnName: "Schema"}, {ColumnName: "DatabaseName"}},
+		Rows:    []Row{[]interface{}{"StormEvents", `{"Name":"StormEvents","OrderedColumns":[{"Name":"State","Type":"System.String","CslType":"string"}]}`, "db"}},
+	}}})
+	require.NoError(t, err)
+	require.Equal(t, &TableSchema{Name: "StormEvents", OrderedColumns: []ColumnSchema{{Name: "State", Type: "System.String", CslType: "string"}}}, schema)
+
+	_, err = TableSchemaFromTableResponse(&TableResponse{Tables: []Table{{Columns: []Column{{ColumnName: "Schema"}}}}})
+	require.Error(t, err)
+}
@@ -13,6 +13,25 @@ import (
 	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
 )
 
+// DefaultMaxConcurrentQueries is used when the datasource settings do not specify
+// how many queries may run concurrently.
+const DefaultMaxConcurrentQueries = 8
+
+// DefaultQueryCacheSize is the number of query results kept in memory when the datasource
+// settings do not specify it.
+const DefaultQueryCacheSize = 256
+
+// DefaultSchemaCacheTTL is how long a fetched schema is served before it is refreshed when the
+// datasource settings do not specify it.
+const DefaultSchemaCacheTTL = 5 * time.Minute
+
+// DefaultAuditLogMaxSizeMB and DefaultAuditLogMaxBackups bound the size of an audit log file
+// and the number of rotated files kept when the environment does not specify them.
+const (
+	DefaultAuditLogMaxSizeMB  = 100
+	DefaultAuditLogMaxBackups = 5
+)
+
 // DatasourceSettings holds the datasource configuration information for Azure Data Explorer's API
 // that is needed to execute a request against Azure's Data Explorer API.
 type DatasourceSettings struct {
@@ -36,6 +55,36 @@ type DatasourceSettings struct {
 	ServerTimeoutValue string `json:"-"`
 	OpenAIAPIKey       string
 
+	// MaxConcurrentQueries limits how many queries of a single QueryDataRequest
+	// are executed against the cluster at the same time.
+	MaxConcurrentQueries int `json:"maxConcurrentQueries"`
+
+	// PartialResultsAsErrors fails queries for which the cluster returned exceptions
+	// instead of returning the results decoded so far with warning notices.
+	PartialResultsAsErrors bool `json:"partialResultsAsErrors"`
+
+	// QueryCacheSize is the number of query results kept in memory. Results are only cached
+	// when the query has a cache max age.
+	QueryCacheSize int `json:"queryCacheSize"`
+
+	// SchemaCacheTTLRaw is a duration string for how long a fetched schema is served before it is
+	// refreshed, and SchemaCacheTTL its parsed value. Schemas are not cached when it is zero.
+	SchemaCacheTTLRaw string        `json:"schemaCacheTTL"`
+	SchemaCacheTTL    time.Duration `json:"-"`
+
+	// TruncationMaxRecords and TruncationMaxSize set the maximum number of records and the
+	// maximum size in bytes of a query result. The limits of the cluster apply when unset.
+	TruncationMaxRecords int64 `json:"truncationMaxRecords"`
+	TruncationMaxSize    int64 `json:"truncationMaxSize"`
+
+	// AuditLog records every executed query with the user who ran it. Entries are written to
+	// the file at AuditLogPath, which only the Grafana administrator can set through the
+	// environment, or to the plugin logs when no file is configured.
+	AuditLog           bool   `json:"auditLog"`
+	AuditLogPath       string `json:"-"`
+	AuditLogMaxSizeMB  int    `json:"-"`
+	AuditLogMaxBackups int    `json:"-"`
+
 	EnforceTrustedEndpoints   bool     `json:"-"`
 	AllowUserTrustedEndpoints bool     `json:"-"`
 	UserTrustedEndpoints      []string `json:"-"`
@@ -74,6 +123,28 @@ func (d *DatasourceSettings) Load(config backend.DataSourceInstanceSettings) err
 		return err
 	}
 
+	if d.MaxConcurrentQueries <= 0 {
+		d.MaxConcurrentQueries = DefaultMaxConcurrentQueries
+	}
+	if d.QueryCacheSize <= 0 {
+		d.QueryCacheSize = DefaultQueryCacheSize
+	}
+	if d.SchemaCacheTTLRaw == "" {
+		d.SchemaCacheTTL = DefaultSchemaCacheTTL
+	} else if d.SchemaCacheTTL, err = time.ParseDuration(d.SchemaCacheTTLRaw); err != nil || d.SchemaCacheTTL < 0 {
+		return fmt.Errorf("invalid schema cache TTL %q", d.SchemaCacheTTLRaw)
+	}
+
+	if d.AuditLog {
+		d.AuditLogPath = os.Getenv("GF_PLUGIN_AUDIT_LOG_PATH")
+		if d.AuditLogMaxSizeMB, err = envIntOrDefault("GF_PLUGIN_AUDIT_LOG_MAX_SIZE_MB", DefaultAuditLogMaxSizeMB); err != nil {
+			return fmt.Errorf("invalid audit log configuration: %w", err)
+		}
+		if d.AuditLogMaxBackups, err = envIntOrDefault("GF_PLUGIN_AUDIT_LOG_MAX_BACKUPS", DefaultAuditLogMaxBackups); err != nil {
+			return fmt.Errorf("invalid audit log configuration: %w", err)
+		}
+	}
+
 	d.EnforceTrustedEndpoints, err = envBoolOrDefault("GF_PLUGIN_ENFORCE_TRUSTED_ENDPOINTS", false)
 	if err != nil {
 		return fmt.Errorf("invalid datasource endpoint configuration: %w", err)
@@ -116,6 +187,18 @@ func envBoolOrDefault(key string, defaultValue bool) (bool, error) {
 	}
 }
 
+func envIntOrDefault(key string, defaultValue int) (int, error) {
+	strValue := os.Getenv(key)
+	if strValue == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(strValue)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("environment variable '%s' is invalid non-negative integer value '%s'", key, strValue)
+	}
+	return value, nil
+}
+
 func envStringSliceOrDefault(key string, defaultValue []string) ([]string, error) {
 	strValue := os.Getenv(key)
 	if strValue == "" {
@@ -86,18 +86,110 @@ func (s *TestSettingsSuite) TestLoad() {
 				}`),
 			},
 			expectedResult: &DatasourceSettings{
-				ClusterURL:         "https://test.kusto.windows.net",
-				DefaultDatabase:    "testdb",
-				DataConsistency:    "strong",
-				CacheMaxAge:        "5m",
-				DynamicCaching:     true,
-				EnableUserTracking: true,
-				Application:        "grafana",
-				QueryTimeoutRaw:    "30s",
-				QueryTimeout:       30 * time.Second,
-				ServerTimeoutValue: "00:00:30",
+				ClusterURL:           "https://test.kusto.windows.net",
+				DefaultDatabase:      "testdb",
+				DataConsistency:      "strong",
+				CacheMaxAge:          "5m",
+				DynamicCaching:       true,
+				EnableUserTracking:   true,
+				Application:          "grafana",
+				QueryTimeoutRaw:      "30s",
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTL:       DefaultSchemaCacheTTL,
 			},
 		},
+		{
+			name: "max concurrent queries",
+			config: backend.DataSourceInstanceSettings{
+				JSONData: []byte(`{
+					"maxConcurrentQueries": 3
+				}`),
+			},
+			expectedResult: &DatasourceSettings{
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: 3,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTL:       DefaultSchemaCacheTTL,
+			},
+		},
+		{
+			name: "partial results as errors",
+			config: backend.DataSourceInstanceSettings{
+				JSONData: []byte(`{
+					"partialResultsAsErrors": true
+				}`),
+			},
+			expectedResult: &DatasourceSettings{
+				QueryTimeout:           30 * time.Second,
+				ServerTimeoutValue:     "00:00:30",
+				MaxConcurrentQueries:   DefaultMaxConcurrentQueries,
+				QueryCacheSize:         DefaultQueryCacheSize,
+				SchemaCacheTTL:         DefaultSchemaCacheTTL,
+				PartialResultsAsErrors: true,
+			},
+		},
+		{
+			name: "truncation limits",
+			config: backend.DataSourceInstanceSettings{
+				JSONData: []byte(`{
+					"truncationMaxRecords": 1000000,
+					"truncationMaxSize": 134217728
+				}`),
+			},
+			expectedResult: &DatasourceSettings{
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTL:       DefaultSchemaCacheTTL,
+				TruncationMaxRecords: 1000000,
+				TruncationMaxSize:    134217728,
+			},
+		},
+		{
+			name: "schema cache TTL",
+			config: backend.DataSourceInstanceSettings{
+				JSONData: []byte(`{
+					"schemaCacheTTL": "1h"
+				}`),
+			},
+			expectedResult: &DatasourceSettings{
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTLRaw:    "1h",
+				SchemaCacheTTL:       time.Hour,
+			},
+		},
+		{
+			name: "schema cache disabled",
+			config: backend.DataSourceInstanceSettings{
+				JSONData: []byte(`{
+					"schemaCacheTTL": "0s"
+				}`),
+			},
+			expectedResult: &DatasourceSettings{
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTLRaw:    "0s",
+			},
+		},
+		{
+			name: "invalid schema cache TTL",
+			config: backend.DataSourceInstanceSettings{
+				JSONData: []byte(`{
+					"schemaCacheTTL": "-1m"
+				}`),
+			},
+			expectedError: "invalid schema cache TTL",
+		},
 		{
 			name: "minimal valid JSON",
 			config: backend.DataSourceInstanceSettings{
@@ -106,9 +198,12 @@ func (s *TestSettingsSuite) TestLoad() {
 				}`),
 			},
 			expectedResult: &DatasourceSettings{
-				ClusterURL:         "https://minimal.kusto.windows.net",
-				QueryTimeout:       30 * time.Second,
-				ServerTimeoutValue: "00:00:30",
+				ClusterURL:           "https://minimal.kusto.windows.net",
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTL:       DefaultSchemaCacheTTL,
 			},
 		},
 		{
@@ -117,8 +212,11 @@ func (s *TestSettingsSuite) TestLoad() {
 				JSONData: []byte(`{}`),
 			},
 			expectedResult: &DatasourceSettings{
-				QueryTimeout:       30 * time.Second,
-				ServerTimeoutValue: "00:00:30",
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTL:       DefaultSchemaCacheTTL,
 			},
 		},
 		{
@@ -127,8 +225,11 @@ func (s *TestSettingsSuite) TestLoad() {
 				JSONData: []byte(``),
 			},
 			expectedResult: &DatasourceSettings{
-				QueryTimeout:       30 * time.Second,
-				ServerTimeoutValue: "00:00:30",
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTL:       DefaultSchemaCacheTTL,
 			},
 		},
 		{
@@ -146,9 +247,12 @@ func (s *TestSettingsSuite) TestLoad() {
 				}`),
 			},
 			expectedResult: &DatasourceSettings{
-				ClusterURL:         "https://test.kusto.windows.net/",
-				QueryTimeout:       30 * time.Second,
-				ServerTimeoutValue: "00:00:30",
+				ClusterURL:           "https://test.kusto.windows.net/",
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTL:       DefaultSchemaCacheTTL,
 			},
 		},
 		{
@@ -217,6 +321,9 @@ func (s *TestSettingsSuite) TestLoad() {
 				ClusterURL:                "https://test.kusto.windows.net",
 				QueryTimeout:              30 * time.Second,
 				ServerTimeoutValue:        "00:00:30",
+				MaxConcurrentQueries:      DefaultMaxConcurrentQueries,
+				QueryCacheSize:            DefaultQueryCacheSize,
+				SchemaCacheTTL:            DefaultSchemaCacheTTL,
 				EnforceTrustedEndpoints:   true,
 				AllowUserTrustedEndpoints: true,
 				UserTrustedEndpoints:      []string{"https://custom1.com", "https://custom2.com"},
@@ -253,6 +360,9 @@ func (s *TestSettingsSuite) TestLoad() {
 				ClusterURL:                "https://test.kusto.windows.net",
 				QueryTimeout:              30 * time.Second,
 				ServerTimeoutValue:        "00:00:30",
+				MaxConcurrentQueries:      DefaultMaxConcurrentQueries,
+				QueryCacheSize:            DefaultQueryCacheSize,
+				SchemaCacheTTL:            DefaultSchemaCacheTTL,
 				EnforceTrustedEndpoints:   true,
 				AllowUserTrustedEndpoints: false,
 				UserTrustedEndpoints:      nil,
@@ -304,6 +414,76 @@ func (s *TestSettingsSuite) TestLoad() {
 			},
 			expectedError: "invalid value for ALLOW_USER_TRUSTED_ENDPOINTS",
 		},
+		{
+			name: "audit log to the plugin logs",
+			config: backend.DataSourceInstanceSettings{
+				JSONData: []byte(`{
+					"auditLog": true
+				}`),
+			},
+			expectedResult: &DatasourceSettings{
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTL:       DefaultSchemaCacheTTL,
+				AuditLog:             true,
+				AuditLogMaxSizeMB:    DefaultAuditLogMaxSizeMB,
+				AuditLogMaxBackups:   DefaultAuditLogMaxBackups,
+			},
+		},
+		{
+			name: "audit log to a file configured by the environment",
+			config: backend.DataSourceInstanceSettings{
+				JSONData: []byte(`{
+					"auditLog": true
+				}`),
+			},
+			setupEnv: func() {
+				s.T().Setenv("GF_PLUGIN_AUDIT_LOG_PATH", "/var/log/grafana/adx-audit.log")
+				s.T().Setenv("GF_PLUGIN_AUDIT_LOG_MAX_SIZE_MB", "10")
+				s.T().Setenv("GF_PLUGIN_AUDIT_LOG_MAX_BACKUPS", "0")
+			},
+			expectedResult: &DatasourceSettings{
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTL:       DefaultSchemaCacheTTL,
+				AuditLog:             true,
+				AuditLogPath:         "/var/log/grafana/adx-audit.log",
+				AuditLogMaxSizeMB:    10,
+				AuditLogMaxBackups:   0,
+			},
+		},
+		{
+			name: "audit log file environment is ignored when the audit log is disabled",
+			config: backend.DataSourceInstanceSettings{
+				JSONData: []byte(`{}`),
+			},
+			setupEnv: func() {
+				s.T().Setenv("GF_PLUGIN_AUDIT_LOG_PATH", "/var/log/grafana/adx-audit.log")
+			},
+			expectedResult: &DatasourceSettings{
+				QueryTimeout:         30 * time.Second,
+				ServerTimeoutValue:   "00:00:30",
+				MaxConcurrentQueries: DefaultMaxConcurrentQueries,
+				QueryCacheSize:       DefaultQueryCacheSize,
+				SchemaCacheTTL:       DefaultSchemaCacheTTL,
+			},
+		},
+		{
+			name: "invalid environment variable for audit log size",
+			config: backend.DataSourceInstanceSettings{
+				JSONData: []byte(`{
+					"auditLog": true
+				}`),
+			},
+			setupEnv: func() {
+				s.T().Setenv("GF_PLUGIN_AUDIT_LOG_MAX_SIZE_MB", "large")
+			},
+			expectedError: "invalid audit log configuration",
+		},
 	}
 
 	for _, tt := range tests {
@@ -336,6 +516,17 @@ func (s *TestSettingsSuite) TestLoad() {
 				r.Equal(tt.expectedResult.QueryTimeoutRaw, ds.QueryTimeoutRaw)
 				r.Equal(tt.expectedResult.QueryTimeout, ds.QueryTimeout)
 				r.Equal(tt.expectedResult.ServerTimeoutValue, ds.ServerTimeoutValue)
+				r.Equal(tt.expectedResult.MaxConcurrentQueries, ds.MaxConcurrentQueries)
+				r.Equal(tt.expectedResult.QueryCacheSize, ds.QueryCacheSize)
+				r.Equal(tt.expectedResult.SchemaCacheTTLRaw, ds.SchemaCacheTTLRaw)
+				r.Equal(tt.expectedResult.SchemaCacheTTL, ds.SchemaCacheTTL)
+				r.Equal(tt.expectedResult.PartialResultsAsErrors, ds.PartialResultsAsErrors)
+				r.Equal(tt.expectedResult.TruncationMaxRecords, ds.TruncationMaxRecords)
+				r.Equal(tt.expectedResult.TruncationMaxSize, ds.TruncationMaxSize)
+				r.Equal(tt.expectedResult.AuditLog, ds.AuditLog)
+				r.Equal(tt.expectedResult.AuditLogPath, ds.AuditLogPath)
+				r.Equal(tt.expectedResult.AuditLogMaxSizeMB, ds.AuditLogMaxSizeMB)
+				r.Equal(tt.expectedResult.AuditLogMaxBackups, ds.AuditLogMaxBackups)
 				r.Equal(tt.expectedResult.EnforceTrustedEndpoints, ds.EnforceTrustedEndpoints)
 				r.Equal(tt.expectedResult.AllowUserTrustedEndpoints, ds.AllowUserTrustedEndpoints)
 				r.Equal(tt.expectedResult.UserTrustedEndpoints, ds.UserTrustedEndpoints)
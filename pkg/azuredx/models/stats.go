@@ -0,0 +1,164 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// queryResourceConsumptionEvent is the EventTypeName of the QueryCompletionInformation row
+// that holds the execution statistics of a query.
+const queryResourceConsumptionEvent = "QueryResourceConsumption"
+
+type cacheStatistics struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	Total  int64 `json:"total"`
+}
+
+// queryResourceConsumption is the payload of the QueryResourceConsumption event.
+// https://learn.microsoft.com/en-us/kusto/api/rest/response-v2#the-meaning-of-tables-in-the-response
+type queryResourceConsumption struct {
+	ExecutionTime float64 `json:"ExecutionTime"`
+	ResourceUsage struct {
+		Cache struct {
+			Memory cacheStatistics `json:"memory"`
+			Disk   cacheStatistics `json:"disk"`
+		} `json:"cache"`
+		CPU struct {
+			TotalCPU string `json:"total cpu"`
+		} `json:"cpu"`
+		Memory struct {
+			PeakPerNode int64 `json:"peak_per_node"`
+		} `json:"memory"`
+	} `json:"resource_usage"`
+	InputDatasetStatistics struct {
+		Extents struct {
+			Total   int64 `json:"total"`
+			Scanned int64 `json:"scanned"`
+		} `json:"extents"`
+		Rows struct {
+			Total   int64 `json:"total"`
+			Scanned int64 `json:"scanned"`
+		} `json:"rows"`
+	} `json:"input_dataset_statistics"`
+}
+
+// QueryStats returns the execution statistics found in the QueryCompletionInformation table of
+// a v2 response as query stats, so they can be shown in the Query Inspector. It returns nil if
+// the response has no statistics.
+func (tr *TableResponse) QueryStats() []data.QueryStat {
+	for _, t := range tr.Tables {
+		if t.TableKind != TableKindQueryCompletionInformation {
+			continue
+		}
+		eventTypeIdx, payloadIdx := -1, -1
+		for i, col := range t.Columns {
+			switch col.ColumnName {
+			case "EventTypeName":
+				eventTypeIdx = i
+			case "Payload":
+				payloadIdx = i
+			}
+		}
+		if eventTypeIdx == -1 || payloadIdx == -1 {
+			return nil
+		}
+		for _, row := range t.Rows {
+			values, ok := row.([]interface{})
+			if !ok || len(values) <= eventTypeIdx || len(values) <= payloadIdx {
+				continue
+			}
+			if values[eventTypeIdx] != queryResourceConsumptionEvent {
+				continue
+			}
+			payload, ok := values[payloadIdx].(string)
+			if !ok {
+				continue
+			}
+			var consumption queryResourceConsumption
+			if err := v2JSON.UnmarshalFromString(payload, &consumption); err != nil {
+				return nil
+			}
+			return consumption.stats()
+		}
+	}
+	return nil
+}
+
+func (c queryResourceConsumption) stats() []data.QueryStat {
+	stats := []data.QueryStat{
+		newQueryStat("Execution time", "s", c.ExecutionTime),
+	}
+	if cpu, err := parseTimespan(c.ResourceUsage.CPU.TotalCPU); err == nil {
+		stats = append(stats, newQueryStat("CPU time", "s", cpu.Seconds()))
+	}
+	stats = append(stats, newQueryStat("Memory peak per node", "bytes", float64(c.ResourceUsage.Memory.PeakPerNode)))
+
+	cache := c.ResourceUsage.Cache
+	if total := cache.Memory.Total + cache.Disk.Total; total > 0 {
+		ratio := float64(cache.Memory.Hits+cache.Disk.Hits) / float64(total)
+		stats = append(stats, newQueryStat("Cache hit ratio", "percentunit", ratio))
+	}
+
+	input := c.InputDatasetStatistics
+	stats = append(stats,
+		newQueryStat("Extents scanned", "", float64(input.Extents.Scanned)),
+		newQueryStat("Extents total", "", float64(input.Extents.Total)),
+		newQueryStat("Rows scanned", "", float64(input.Rows.Scanned)),
+		newQueryStat("Rows total", "", float64(input.Rows.Total)),
+	)
+	return stats
+}
+
+func newQueryStat(displayName string, unit string, value float64) data.QueryStat {
+	return data.QueryStat{
+		FieldConfig: data.FieldConfig{DisplayName: displayName, Unit: unit},
+		Value:       value,
+	}
+}
+
+// parseTimespan parses a Kusto timespan formatted as [-][d.]hh:mm:ss[.fffffff].
+// https://learn.microsoft.com/en-us/kusto/query/scalar-data-types/timespan
+func parseTimespan(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty timespan")
+	}
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid timespan %q", s)
+	}
+
+	var days, hours int64
+	var err error
+	if dayHours := strings.SplitN(parts[0], ".", 2); len(dayHours) == 2 {
+		if days, err = strconv.ParseInt(dayHours[0], 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid timespan %q: %w", s, err)
+		}
+		parts[0] = dayHours[1]
+	}
+	if hours, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return 0, fmt.Errorf("invalid timespan %q: %w", s, err)
+	}
+	minutes, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timespan %q: %w", s, err)
+	}
+	seconds, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timespan %q: %w", s, err)
+	}
+
+	d := time.Duration(days)*day + time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second))
+	if negative {
+		d = -d
+	}
+	return d, nil
+}
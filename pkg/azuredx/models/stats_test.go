@@ -0,0 +1,88 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryStats(t *testing.T) {
+	t.Run("parses the query resource consumption of a v2 response", func(t *testing.T) {
+		tr, err := tableFromV2JSONFile("v2_supported_types_with_vals.json")
+		require.NoError(t, err)
+
+		stats := tr.QueryStats()
+		expected := map[string]float64{
+			"Execution time":       0.0156253,
+			"CPU time":             0.03125,
+			"Memory peak per node": 1048608,
+			"Cache hit ratio":      14.0 / 17.0,
+			"Extents scanned":      3,
+			"Extents total":        12,
+			"Rows scanned":         14511,
+			"Rows total":           59066,
+		}
+		require.Len(t, stats, len(expected))
+		for _, s := range stats {
+			assert.InDelta(t, expected[s.DisplayName], s.Value, 1e-9, s.DisplayName)
+		}
+	})
+
+	t.Run("attaches the statistics to the result frames", func(t *testing.T) {
+		tr, err := tableFromV2JSONFile("v2_multi_label_multi_value_time_table_progressive.json")
+		require.NoError(t, err)
+
+		frames, err := tr.ToDataFrames("", "time_series")
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Equal(t, tr.QueryStats(), frames[0].Meta.Stats)
+	})
+
+	t.Run("keeps the statistics when converting to ADX time series", func(t *testing.T) {
+		in := data.NewFrame("", data.NewField("Timestamp", nil, []string{`["2020-01-01T00:00:00Z"]`}), data.NewField("Value", nil, []string{`[1]`}))
+		in.Meta = &data.FrameMeta{
+			Custom: AzureFrameMD{ColumnTypes: []string{"dynamic", "dynamic"}},
+			Stats:  []data.QueryStat{newQueryStat("Execution time", "s", 1)},
+		}
+		out, err := ToADXTimeSeries(in)
+		require.NoError(t, err)
+		assert.Equal(t, in.Meta.Stats, out.Meta.Stats)
+	})
+
+	t.Run("v1 responses have no statistics", func(t *testing.T) {
+		tr, err := tableFromJSONFile("supported_types_with_vals.json")
+		require.NoError(t, err)
+		assert.Nil(t, tr.QueryStats())
+	})
+}
+
+func TestParseTimespan(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		err      bool
+	}{
+		{value: "00:00:00", expected: 0},
+		{value: "00:00:00.0312500", expected: 31250 * time.Microsecond},
+		{value: "01:02:03", expected: time.Hour + 2*time.Minute + 3*time.Second},
+		{value: "2.00:00:01", expected: 48*time.Hour + time.Second},
+		{value: "-00:01:00", expected: -time.Minute},
+		{value: "", err: true},
+		{value: "10", err: true},
+		{value: "aa:00:00", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			d, err := parseTimespan(tt.value)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, d)
+		})
+	}
+}
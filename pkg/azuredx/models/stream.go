@@ -0,0 +1,51 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// DefaultStreamInterval is how often a live stream runs its query when it does not specify it.
+const DefaultStreamInterval = 10 * time.Second
+
+// StreamQuery is a query run as a live stream, which re-runs it on an interval and sends the rows
+// it has not sent before.
+type StreamQuery struct {
+	QueryModel
+
+	// IntervalMs is how often the query runs, in milliseconds.
+	IntervalMs int64 `json:"liveIntervalMs,omitempty"`
+	// From is where the stream starts, in milliseconds since the epoch. Defaults to one interval
+	// before the stream starts.
+	From int64 `json:"liveFrom,omitempty"`
+	// TimeColumn is the column the stream follows, usually the ingestion time of the rows. Defaults
+	// to the first time column of the result.
+	TimeColumn string `json:"liveTimeColumn,omitempty"`
+}
+
+// Validate checks that the query can run as a live stream.
+func (sq *StreamQuery) Validate() error {
+	switch sq.Format {
+	case "table", "logs", "time_series":
+	default:
+		return backend.DownstreamError(fmt.Errorf("queries of format %q cannot be streamed", sq.Format))
+	}
+	if sq.IntervalMs < 0 {
+		return backend.DownstreamError(fmt.Errorf("stream interval must not be negative"))
+	}
+	return sq.ValidateClientRequestProperties()
+}
+
+// Interval returns how often the query runs, which is at least min.
+func (sq *StreamQuery) Interval(min time.Duration) time.Duration {
+	if sq.IntervalMs == 0 {
+		return DefaultStreamInterval
+	}
+	d := time.Duration(sq.IntervalMs) * time.Millisecond
+	if d < min {
+		return min
+	}
+	return d
+}
@@ -7,8 +7,10 @@ import (
 	"io"
 	"math"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
@@ -25,8 +27,33 @@ type TableResponse struct {
 // Table is a member of TableResponse
 type Table struct {
 	TableName string
+	TableKind string `json:",omitempty"`
 	Columns   []Column
 	Rows      []Row
+
+	// fields holds the converted column values of a table that was decoded progressively
+	// from a v2 response, in which case Rows is empty.
+	fields []*data.Field
+}
+
+// rowCount returns the number of rows of the table regardless of how it was decoded.
+func (t Table) rowCount() int {
+	if t.fields != nil {
+		if len(t.fields) == 0 {
+			return 0
+		}
+		return t.fields[0].Len()
+	}
+	return len(t.Rows)
+}
+
+// RowCount returns the number of rows of all tables of the response.
+func (tr *TableResponse) RowCount() int {
+	n := 0
+	for _, t := range tr.Tables {
+		n += t.rowCount()
+	}
+	return n
 }
 
 // Row Represents a row within a TableResponse
@@ -39,12 +66,18 @@ type Column struct {
 	ColumnType string
 }
 
-// getPrimaryResultTable returns the first table from the response.
+// getPrimaryResultTable returns the first primary result table of a v2 response, or the first table
+// from the response otherwise.
 // This handles both regular queries and management commands regardless of table naming.
 func (tr *TableResponse) getPrimaryResultTable() (Table, error) {
 	if len(tr.Tables) == 0 {
 		return Table{}, fmt.Errorf("no data as response contains no tables")
 	}
+	for _, t := range tr.Tables {
+		if t.TableKind == TableKindPrimaryResult {
+			return t, nil
+		}
+	}
 	return tr.Tables[0], nil
 }
 
@@ -53,9 +86,131 @@ func (tr *TableResponse) ToDataFrames(executedQueryString string, format string)
 	if err != nil {
 		return nil, err
 	}
-	if len(table.Rows) == 0 {
+	if table.rowCount() == 0 {
 		return data.Frames{}, nil
 	}
+	frame, err := frameForTable(table, executedQueryString, format)
+	if err != nil {
+		return nil, err
+	}
+	frame.Meta.Stats = tr.QueryStats()
+	return data.Frames{frame}, nil
+}
+
+// ToAllDataFrames converts every result table of the response into its own frame, named after
+// the table. Tables that only hold metadata about the query, such as the TableOfContents and
+// QueryStatus tables, are left out, as are result tables without rows.
+func (tr *TableResponse) ToAllDataFrames(executedQueryString string, format string) (data.Frames, error) {
+	tables, err := tr.resultTables()
+	if err != nil {
+		return nil, err
+	}
+	stats := tr.QueryStats()
+	frames := data.Frames{}
+	for _, table := range tables {
+		if table.rowCount() == 0 {
+			continue
+		}
+		frame, err := frameForTable(table, executedQueryString, format)
+		if err != nil {
+			return nil, err
+		}
+		frame.Name = table.TableName
+		frame.Meta.Stats = stats
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// resultTables returns the tables of the response that hold query results. For v2 responses these
+// are the primary result tables. For v1 responses the last table is the TableOfContents, which
+// lists the kind and name of every other table.
+func (tr *TableResponse) resultTables() ([]Table, error) {
+	if len(tr.Tables) == 0 {
+		return nil, fmt.Errorf("no data as response contains no tables")
+	}
+
+	var tables []Table
+	for _, t := range tr.Tables {
+		if t.TableKind == TableKindPrimaryResult {
+			tables = append(tables, t)
+		}
+	}
+	if tables != nil {
+		return tables, nil
+	}
+
+	toc, ok := tr.tableOfContents()
+	if !ok {
+		return tr.Tables, nil
+	}
+	for _, entry := range toc {
+		if entry.kind != tocKindQueryResult || entry.ordinal < 0 || entry.ordinal >= len(tr.Tables)-1 {
+			continue
+		}
+		t := tr.Tables[entry.ordinal]
+		t.TableName = entry.name
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// tocKindQueryResult is the kind of the v1 TableOfContents entries that refer to result tables.
+const tocKindQueryResult = "QueryResult"
+
+type tocEntry struct {
+	ordinal int
+	kind    string
+	name    string
+}
+
+// tableOfContents parses the TableOfContents table of a v1 response, which is the last table
+// of responses with more than one table.
+func (tr *TableResponse) tableOfContents() ([]tocEntry, bool) {
+	if len(tr.Tables) < 2 {
+		return nil, false
+	}
+	toc := tr.Tables[len(tr.Tables)-1]
+	ordinalIdx, kindIdx, nameIdx := -1, -1, -1
+	for i, col := range toc.Columns {
+		switch col.ColumnName {
+		case "Ordinal":
+			ordinalIdx = i
+		case "Kind":
+			kindIdx = i
+		case "Name":
+			nameIdx = i
+		}
+	}
+	if ordinalIdx == -1 || kindIdx == -1 || nameIdx == -1 {
+		return nil, false
+	}
+
+	entries := []tocEntry{}
+	for _, row := range toc.Rows {
+		values, ok := row.([]interface{})
+		if !ok || len(values) != len(toc.Columns) {
+			return nil, false
+		}
+		ordinal, ok := values[ordinalIdx].(json.Number)
+		if !ok {
+			return nil, false
+		}
+		o, err := ordinal.Int64()
+		if err != nil {
+			return nil, false
+		}
+		kind, _ := values[kindIdx].(string)
+		name, _ := values[nameIdx].(string)
+		entries = append(entries, tocEntry{ordinal: int(o), kind: kind, name: name})
+	}
+	return entries, true
+}
+
+func frameForTable(table Table, executedQueryString string, format string) (*data.Frame, error) {
+	if table.fields != nil {
+		return frameForDecodedTable(table, executedQueryString, format)
+	}
 	converterFrame, err := converterFrameForTable(table, executedQueryString, format)
 	if err != nil {
 		return nil, err
@@ -72,7 +227,7 @@ func (tr *TableResponse) ToDataFrames(executedQueryString string, format string)
 			}
 		}
 	}
-	return data.Frames{converterFrame.Frame}, nil
+	return converterFrame.Frame, nil
 }
 
 func converterFrameForTable(t Table, executedQueryString string, format string) (*data.FrameInputConverter, error) {
@@ -108,17 +263,105 @@ func converterFrameForTable(t Table, executedQueryString string, format string)
 		return nil, err
 	}
 
-	fic.Frame.Meta = &data.FrameMeta{
+	setFrameMeta(fic.Frame, colTypes, executedQueryString, format)
+
+	return fic, nil
+}
+
+// frameForDecodedTable creates a frame from a table whose values were already converted while
+// decoding a v2 response. The trace specific converters are applied on top of the decoded values.
+func frameForDecodedTable(t Table, executedQueryString string, format string) (*data.Frame, error) {
+	fields := make([]*data.Field, len(t.fields))
+	colTypes := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		colTypes[i] = col.ColumnType
+		// the table may be cached and shared between queries, so the frame gets its own values
+		fields[i] = copyField(t.fields[i])
+		if format != "trace" {
+			continue
+		}
+		var converter data.FieldConverter
+		switch col.ColumnName {
+		case "serviceTags", "tags":
+			converter = tagsConverter
+		case "logs":
+			converter = logsConverter
+		default:
+			continue
+		}
+		converted, err := reconvertField(t.fields[i], col.ColumnType, converter)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = converted
+	}
+
+	frame := data.NewFrame("", fields...)
+	setFrameMeta(frame, colTypes, executedQueryString, format)
+	return frame, nil
+}
+
+// copyField returns a copy of f that shares none of its values, labels or config.
+func copyField(f *data.Field) *data.Field {
+	out := data.NewFieldFromFieldType(f.Type(), f.Len())
+	out.Name = f.Name
+	if f.Labels != nil {
+		out.Labels = f.Labels.Copy()
+	}
+	if f.Config != nil {
+		config := *f.Config
+		out.Config = &config
+	}
+	for i := 0; i < f.Len(); i++ {
+		out.Set(i, f.CopyAt(i))
+	}
+	return out
+}
+
+// reconvertField applies converter to the raw values of an already decoded field.
+// Dynamic values are stored as JSON text and are decoded again before being converted.
+func reconvertField(f *data.Field, columnType string, converter data.FieldConverter) (*data.Field, error) {
+	out := data.NewFieldFromFieldType(converter.OutputFieldType, f.Len())
+	out.Name = f.Name
+	for i := 0; i < f.Len(); i++ {
+		var raw interface{}
+		switch v := f.At(i).(type) {
+		case string:
+			if columnType != "dynamic" {
+				raw = v
+				break
+			}
+			if err := v2JSON.UnmarshalFromString(v, &raw); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal dynamic value '%v': %w", v, err)
+			}
+		case *string:
+			if v != nil {
+				raw = *v
+			}
+		default:
+			raw = v
+		}
+		converted, err := converter.Converter(raw)
+		if err != nil {
+			return nil, err
+		}
+		out.Set(i, converted)
+	}
+	return out, nil
+}
+
+func setFrameMeta(frame *data.Frame, colTypes []string, executedQueryString string, format string) {
+	frame.Meta = &data.FrameMeta{
 		ExecutedQueryString: executedQueryString,
 		Custom:              AzureFrameMD{ColumnTypes: colTypes},
 	}
 
 	if format == "trace" {
-		fic.Frame.Meta.PreferredVisualization = data.VisTypeTrace
+		frame.Meta.PreferredVisualization = data.VisTypeTrace
 	}
 
 	if format == "logs" {
-		fic.Frame.SetMeta(&data.FrameMeta{
+		frame.SetMeta(&data.FrameMeta{
 			PreferredVisualization: data.VisTypeLogs,
 			Custom: map[string]any{
 				"ColumnTypes": colTypes,
@@ -126,8 +369,6 @@ func converterFrameForTable(t Table, executedQueryString string, format string)
 			},
 		})
 	}
-
-	return fic, nil
 }
 
 // Finds search words in 'where' clauses that are formatted like "| where Level == 'Info' or Level == 'Debug'"
@@ -499,7 +740,7 @@ func ToADXTimeSeries(in *data.Frame) (*data.Frame, error) {
 		return nil, fmt.Errorf("did not find a numeric value column, expected at least one column of type 'dynamic', got %v", len(valueColIdxs))
 	}
 
-	out := data.NewFrame(in.Name).SetMeta(&data.FrameMeta{ExecutedQueryString: in.Meta.ExecutedQueryString})
+	out := data.NewFrame(in.Name).SetMeta(&data.FrameMeta{ExecutedQueryString: in.Meta.ExecutedQueryString, Stats: in.Meta.Stats})
 
 	// Each row is a series
 	expectedRowLen := 0
@@ -560,13 +801,76 @@ func TableFromJSON(rc io.Reader) (*TableResponse, error) {
 		return nil, fmt.Errorf("unable to parse response, parsed response has no tables")
 	}
 
-	if len(tr.Exceptions) > 0 {
-		errMsg := ""
-		for _, e := range tr.Exceptions {
-			errMsg += e + ". "
+	// A query that fails part way through replaces rows with an object listing the exceptions.
+	// The rows decoded before the failure are kept so they can be returned as partial results.
+	for i, t := range tr.Tables {
+		rows := t.Rows[:0]
+		for _, row := range t.Rows {
+			if rowErr, ok := row.(map[string]interface{}); ok {
+				tr.Exceptions = appendRowExceptions(tr.Exceptions, rowErr)
+				continue
+			}
+			rows = append(rows, row)
 		}
-		return nil, backend.DownstreamError(errors.New(errMsg))
+		tr.Tables[i].Rows = rows
 	}
 
 	return tr, nil
 }
+
+// appendRowExceptions appends the exceptions of an error row that are not yet part of exceptions.
+func appendRowExceptions(exceptions []string, rowErr map[string]interface{}) []string {
+	rowExceptions, _ := rowErr["Exceptions"].([]interface{})
+	for _, e := range rowExceptions {
+		text, ok := e.(string)
+		if !ok || slices.Contains(exceptions, text) {
+			continue
+		}
+		exceptions = append(exceptions, text)
+	}
+	return exceptions
+}
+
+// ExceptionsError returns the exceptions reported by the cluster as a single error, or nil when the
+// query completed without exceptions.
+func (tr *TableResponse) ExceptionsError() error {
+	if len(tr.Exceptions) == 0 {
+		return nil
+	}
+	errMsg := ""
+	for _, e := range tr.Exceptions {
+		errMsg += e + ". "
+	}
+	return backend.DownstreamError(errors.New(errMsg))
+}
+
+// truncationMarkers identify the exceptions reported by the cluster when a query result exceeds
+// the truncationmaxrecords or truncationmaxsize limits.
+var truncationMarkers = []string{"E_QUERY_RESULT_SET_TOO_LARGE", "80DA0003"}
+
+func isTruncationException(e string) bool {
+	for _, marker := range truncationMarkers {
+		if strings.Contains(e, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExceptionNotices returns a warning notice for every exception reported by the cluster, so the
+// results decoded before the exceptions occurred can be returned as partial results.
+func (tr *TableResponse) ExceptionNotices() []data.Notice {
+	notices := make([]data.Notice, 0, len(tr.Exceptions))
+	for _, e := range tr.Exceptions {
+		text := "Partial results: " + e
+		if isTruncationException(e) {
+			text = "Results were truncated because the query exceeded the record count or size limit, so data is missing. " +
+				"Narrow the query or raise truncationmaxrecords or truncationmaxsize in the data source settings or query options: " + e
+		}
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     text,
+		})
+	}
+	return notices
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/grafana/grafana-plugin-sdk-go/data"
@@ -98,9 +99,30 @@ func TestResponseToFrames(t *testing.T) {
 	}
 
 	t.Run("query with exceptions", func(t *testing.T) {
-		_, err := tableFromJSONFile("query_with_exceptions.json")
+		respTable, err := tableFromJSONFile("query_with_exceptions.json")
+		require.NoError(t, err)
+		require.Len(t, respTable.Exceptions, 1)
+		err = respTable.ExceptionsError()
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "Query execution lacks memory resources")
+		frames, err := respTable.ToDataFrames("", "")
+		assert.NoError(t, err)
+		assert.Empty(t, frames)
+	})
+
+	t.Run("query with partial results", func(t *testing.T) {
+		respTable, err := tableFromJSONFile("partial_results.json")
+		require.NoError(t, err)
+		require.Len(t, respTable.Exceptions, 1)
+		frames, err := respTable.ToDataFrames("", "")
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Equal(t, 2, frames[0].Rows())
+		notices := respTable.ExceptionNotices()
+		require.Len(t, notices, 1)
+		assert.Equal(t, data.NoticeSeverityWarning, notices[0].Severity)
+		assert.Contains(t, notices[0].Text, "E_QUERY_RESULT_SET_TOO_LARGE")
+		assert.Contains(t, notices[0].Text, "Results were truncated")
 	})
 
 	t.Run("query with no rows", func(t *testing.T) {
@@ -206,3 +228,87 @@ func TestTableResponse_ToADXTimeSeries(t *testing.T) {
 		})
 	}
 }
+
+func TestToAllDataFrames(t *testing.T) {
+	assertFrames := func(t *testing.T, frames data.Frames) {
+		t.Helper()
+		require.Len(t, frames, 2)
+		assert.Equal(t, "Requests", frames[0].Name)
+		assert.Equal(t, 2, frames[0].Rows())
+		assert.Equal(t, "Failures", frames[1].Name)
+		assert.Equal(t, 1, frames[1].Rows())
+	}
+
+	t.Run("v1 response uses the table of contents", func(t *testing.T) {
+		tr, err := tableFromJSONFile("fork_tables.json")
+		require.NoError(t, err)
+		frames, err := tr.ToAllDataFrames("", data.VisTypeTable)
+		require.NoError(t, err)
+		assertFrames(t, frames)
+	})
+
+	t.Run("v2 response uses the primary result tables", func(t *testing.T) {
+		tr, err := tableFromV2JSONFile("v2_fork_tables.json")
+		require.NoError(t, err)
+		frames, err := tr.ToAllDataFrames("", data.VisTypeTable)
+		require.NoError(t, err)
+		assertFrames(t, frames)
+		for _, f := range frames {
+			assert.NotEmpty(t, f.Meta.Stats)
+		}
+	})
+
+	t.Run("query properties and query status tables are filtered out", func(t *testing.T) {
+		tr, err := tableFromJSONFile("supported_types_with_vals.json")
+		require.NoError(t, err)
+		frames, err := tr.ToAllDataFrames("", data.VisTypeTable)
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Equal(t, "PrimaryResult", frames[0].Name)
+	})
+
+	t.Run("response without table of contents returns every table", func(t *testing.T) {
+		tr := &TableResponse{Tables: []Table{
+			{TableName: "First", Columns: []Column{{ColumnName: "col1", ColumnType: "string"}}, Rows: []Row{[]interface{}{"value1"}}},
+		}}
+		frames, err := tr.ToAllDataFrames("", data.VisTypeTable)
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Equal(t, "First", frames[0].Name)
+	})
+
+	t.Run("tables without rows are skipped", func(t *testing.T) {
+		tr := &TableResponse{Tables: []Table{
+			{TableName: "First", TableKind: TableKindPrimaryResult, Columns: []Column{{ColumnName: "col1", ColumnType: "string"}}, Rows: []Row{}},
+			{TableName: "Second", TableKind: TableKindPrimaryResult, Columns: []Column{{ColumnName: "col1", ColumnType: "string"}}, Rows: []Row{[]interface{}{"value1"}}},
+		}}
+		frames, err := tr.ToAllDataFrames("", data.VisTypeTable)
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Equal(t, "Second", frames[0].Name)
+	})
+
+	t.Run("returns error for empty response", func(t *testing.T) {
+		tr := &TableResponse{}
+		_, err := tr.ToAllDataFrames("", data.VisTypeTable)
+		require.Error(t, err)
+	})
+}
+
+func TestExceptionNotices(t *testing.T) {
+	tr := &TableResponse{Exceptions: []string{
+		"Query execution lacks memory resources to complete (80DA0007): Partial query failure: Low memory condition (E_LOW_MEMORY_CONDITION)",
+		"Query result set has exceeded the internal data size limit 67108864 (E_QUERY_RESULT_SET_TOO_LARGE; see https://aka.ms/kustoquerylimits)",
+		"Partial query failure: 80DA0003",
+	}}
+	notices := tr.ExceptionNotices()
+	require.Len(t, notices, 3)
+	assert.True(t, strings.HasPrefix(notices[0].Text, "Partial results: "))
+	assert.True(t, strings.HasPrefix(notices[1].Text, "Results were truncated"))
+	assert.True(t, strings.HasPrefix(notices[2].Text, "Results were truncated"))
+	for _, n := range notices {
+		assert.Equal(t, data.NoticeSeverityWarning, n.Severity)
+	}
+
+	assert.Empty(t, (&TableResponse{}).ExceptionNotices())
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Frame types of a response from Azure's Data Explorer v2 REST API.
+// https://learn.microsoft.com/en-us/kusto/api/rest/response-v2
+const (
+	frameTypeDataSetHeader     = "DataSetHeader"
+	frameTypeDataTable         = "DataTable"
+	frameTypeTableHeader       = "TableHeader"
+	frameTypeTableFragment     = "TableFragment"
+	frameTypeTableCompletion   = "TableCompletion"
+	frameTypeDataSetCompletion = "DataSetCompletion"
+
+	fragmentTypeDataReplace = "DataReplace"
+)
+
+// Table kinds of a response from Azure's Data Explorer v2 REST API.
+const (
+	TableKindPrimaryResult              = "PrimaryResult"
+	TableKindQueryProperties            = "QueryProperties"
+	TableKindQueryCompletionInformation = "QueryCompletionInformation"
+)
+
+// v2BufferSize is the size of the read buffer used while decoding a v2 response.
+const v2BufferSize = 64 * 1024
+
+// v2JSON keeps numbers as json.Number so the column types of the response can be honoured.
+var v2JSON = jsoniter.Config{UseNumber: true}.Froze()
+
+// v2Frame holds the scalar properties of a single frame of a v2 response.
+type v2Frame struct {
+	FrameType    string
+	TableID      int
+	TableKind    string
+	TableName    string
+	FragmentType string
+	Columns      []Column
+	HasRows      bool
+	HasErrors    bool
+	Cancelled    bool
+	OneApiErrors []ErrorResponse
+}
+
+// v2RowError is the object that replaces a row when the query failed while streaming results.
+type v2RowError struct {
+	OneApiErrors []ErrorResponse
+	Exceptions   []string
+}
+
+type v2Table struct {
+	Table
+	converters []data.FieldConverter
+}
+
+type v2Decoder struct {
+	tables     []*v2Table
+	tablesByID map[int]*v2Table
+	exceptions []string
+	completed  bool
+	err        error
+}
+
+// TableFromV2JSON decodes a response from Azure's Data Explorer v2 REST API. The frames of the
+// response are read one by one while the body is streamed, and the rows of primary result tables
+// are converted to data.Field values as they are read rather than being kept as generic rows.
+// The remaining tables, such as QueryProperties and QueryCompletionInformation, are kept as rows.
+// Errors reported while the query ran are collected in Exceptions alongside the decoded tables.
+func TableFromV2JSON(rc io.Reader) (*TableResponse, error) {
+	d := &v2Decoder{tablesByID: map[int]*v2Table{}}
+	iter := jsoniter.Parse(v2JSON, rc, v2BufferSize)
+	if iter.WhatIsNext() != jsoniter.ArrayValue {
+		return nil, fmt.Errorf("unable to parse response, expected an array of frames")
+	}
+	for iter.ReadArray() {
+		d.readFrame(iter)
+		if iter.Error != nil {
+			break
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if iter.Error != nil {
+		return nil, fmt.Errorf("unable to parse response: %w", iter.Error)
+	}
+	if !d.completed {
+		return nil, fmt.Errorf("unable to parse response, response ended before the data set completed")
+	}
+
+	tr := &TableResponse{Exceptions: d.exceptions}
+	for _, t := range d.tables {
+		tr.Tables = append(tr.Tables, t.Table)
+	}
+	if len(tr.Tables) == 0 {
+		return nil, fmt.Errorf("unable to parse response, parsed response has no tables")
+	}
+	return tr, nil
+}
+
+func (d *v2Decoder) readFrame(iter *jsoniter.Iterator) {
+	var f v2Frame
+	for field := iter.ReadObject(); field != ""; field = iter.ReadObject() {
+		switch field {
+		case "FrameType":
+			f.FrameType = iter.ReadString()
+		case "TableId":
+			f.TableID = iter.ReadInt()
+		case "TableKind":
+			f.TableKind = iter.ReadString()
+		case "TableName":
+			f.TableName = iter.ReadString()
+		case "TableFragmentType":
+			f.FragmentType = iter.ReadString()
+		case "Columns":
+			iter.ReadVal(&f.Columns)
+		case "Rows":
+			f.HasRows = true
+			t := d.tableForRows(f)
+			if t == nil {
+				d.fail(iter, fmt.Errorf("unable to parse response, rows of unknown table %d", f.TableID))
+				return
+			}
+			d.readRows(iter, t)
+		case "HasErrors":
+			f.HasErrors = iter.ReadBool()
+		case "Cancelled":
+			f.Cancelled = iter.ReadBool()
+		case "OneApiErrors":
+			iter.ReadVal(&f.OneApiErrors)
+		default:
+			iter.Skip()
+		}
+		if iter.Error != nil {
+			return
+		}
+	}
+
+	switch f.FrameType {
+	case frameTypeTableHeader:
+		d.addTable(f)
+	case frameTypeDataTable:
+		if !f.HasRows {
+			d.addTable(f)
+		}
+	case frameTypeDataSetCompletion:
+		d.completed = true
+		for _, e := range f.OneApiErrors {
+			d.addException(e.text())
+		}
+		if f.HasErrors && len(d.exceptions) == 0 {
+			d.addException("query completed with errors")
+		}
+		if f.Cancelled {
+			d.addException("query was cancelled")
+		}
+	}
+}
+
+// addException records an exception once, as the same error is reported by both the failed
+// table and the completion of the data set.
+func (d *v2Decoder) addException(text string) {
+	if !slices.Contains(d.exceptions, text) {
+		d.exceptions = append(d.exceptions, text)
+	}
+}
+
+// tableForRows returns the table the rows of the current frame belong to.
+func (d *v2Decoder) tableForRows(f v2Frame) *v2Table {
+	switch f.FrameType {
+	case frameTypeDataTable:
+		return d.addTable(f)
+	case frameTypeTableFragment:
+		t, ok := d.tablesByID[f.TableID]
+		if !ok {
+			return nil
+		}
+		if f.FragmentType == fragmentTypeDataReplace {
+			t.reset()
+		}
+		return t
+	}
+	return nil
+}
+
+func (d *v2Decoder) addTable(f v2Frame) *v2Table {
+	t := &v2Table{Table: Table{
+		TableName: f.TableName,
+		TableKind: f.TableKind,
+		Columns:   f.Columns,
+	}}
+	if f.TableKind == TableKindPrimaryResult {
+		t.converters = make([]data.FieldConverter, len(f.Columns))
+		for i, col := range f.Columns {
+			converter, ok := converterMap[col.ColumnType]
+			if !ok {
+				d.err = fmt.Errorf("unsupported analytics column type %v", col.ColumnType)
+				return t
+			}
+			t.converters[i] = converter
+		}
+		t.reset()
+	}
+	d.tables = append(d.tables, t)
+	d.tablesByID[f.TableID] = t
+	return t
+}
+
+// reset discards all rows of the table.
+func (t *v2Table) reset() {
+	if t.converters == nil {
+		t.Rows = nil
+		return
+	}
+	t.fields = make([]*data.Field, len(t.Columns))
+	for i, col := range t.Columns {
+		t.fields[i] = data.NewFieldFromFieldType(t.converters[i].OutputFieldType, 0)
+		t.fields[i].Name = col.ColumnName
+	}
+}
+
+func (d *v2Decoder) readRows(iter *jsoniter.Iterator, t *v2Table) {
+	for iter.ReadArray() {
+		if d.err != nil {
+			d.fail(iter, d.err)
+			return
+		}
+		if iter.WhatIsNext() == jsoniter.ObjectValue {
+			var rowErr v2RowError
+			iter.ReadVal(&rowErr)
+			for _, e := range rowErr.OneApiErrors {
+				d.addException(e.text())
+			}
+			for _, e := range rowErr.Exceptions {
+				d.addException(e)
+			}
+			continue
+		}
+		if t.converters == nil {
+			t.Rows = append(t.Rows, iter.Read())
+			continue
+		}
+		if err := t.readRow(iter); err != nil {
+			d.fail(iter, err)
+			return
+		}
+	}
+}
+
+// readRow converts the values of a single row and appends them to the fields of the table.
+func (t *v2Table) readRow(iter *jsoniter.Iterator) error {
+	col := 0
+	for iter.ReadArray() {
+		if col >= len(t.fields) {
+			return fmt.Errorf("unable to parse rows, row has more values than the %d columns of table %q", len(t.fields), t.TableName)
+		}
+		v, err := t.converters[col].Converter(iter.Read())
+		if err != nil {
+			return err
+		}
+		t.fields[col].Append(v)
+		col++
+	}
+	if iter.Error == nil && col != len(t.fields) {
+		return fmt.Errorf("unable to parse rows, row has %d values but table %q has %d columns", col, t.TableName, len(t.fields))
+	}
+	return nil
+}
+
+// fail stops decoding the response and reports err instead of the resulting parser error.
+func (d *v2Decoder) fail(iter *jsoniter.Iterator, err error) {
+	d.err = err
+	iter.ReportError("TableFromV2JSON", err.Error())
+}
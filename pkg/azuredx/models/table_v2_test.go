@@ -0,0 +1,163 @@
+package models
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tableFromV2JSONFile(name string) (tr *TableResponse, err error) {
+	file, err := os.Open(path.Join("./testdata", name))
+	if err != nil {
+		return
+	}
+	defer file.Close() //nolint:errcheck
+	return TableFromV2JSON(file)
+}
+
+func TestV2ResponseToFrames(t *testing.T) {
+	tests := []struct {
+		name       string
+		v1TestFile string
+		v2TestFile string
+		format     string
+	}{
+		{
+			name:       "supported types should load with values",
+			v1TestFile: "supported_types_with_vals.json",
+			v2TestFile: "v2_supported_types_with_vals.json",
+			format:     data.VisTypeTable,
+		},
+		{
+			name:       "traces should be converted to dataframe appropriately",
+			v1TestFile: "adx_traces_table.json",
+			v2TestFile: "v2_traces_table.json",
+			format:     data.VisTypeTrace,
+		},
+		{
+			name:       "progressive fragments should be joined into a single frame",
+			v1TestFile: "multi_label_multi_value_time_table.json",
+			v2TestFile: "v2_multi_label_multi_value_time_table_progressive.json",
+			format:     "time_series",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v1, err := tableFromJSONFile(tt.v1TestFile)
+			require.NoError(t, err)
+			v2, err := tableFromV2JSONFile(tt.v2TestFile)
+			require.NoError(t, err)
+
+			expected, err := v1.ToDataFrames("query", tt.format)
+			require.NoError(t, err)
+			actual, err := v2.ToDataFrames("query", tt.format)
+			require.NoError(t, err)
+			// v1 responses carry no query statistics
+			for _, f := range actual {
+				f.Meta.Stats = nil
+			}
+
+			if diff := cmpFrames(expected, actual); diff != "" {
+				t.Errorf("v2 frames differ from v1 frames: %s", diff)
+			}
+		})
+	}
+
+	t.Run("keeps the query properties and completion information tables", func(t *testing.T) {
+		tr, err := tableFromV2JSONFile("v2_supported_types_with_vals.json")
+		require.NoError(t, err)
+		require.Len(t, tr.Tables, 3)
+		assert.Equal(t, TableKindQueryProperties, tr.Tables[0].TableKind)
+		assert.Len(t, tr.Tables[0].Rows, 1)
+		assert.Equal(t, TableKindPrimaryResult, tr.Tables[1].TableKind)
+		assert.Empty(t, tr.Tables[1].Rows)
+		assert.Equal(t, 1, tr.Tables[1].rowCount())
+		assert.Equal(t, TableKindQueryCompletionInformation, tr.Tables[2].TableKind)
+		assert.Len(t, tr.Tables[2].Rows, 3)
+	})
+
+	t.Run("data replace fragments discard the previous rows", func(t *testing.T) {
+		tr, err := tableFromV2JSONFile("v2_progressive_data_replace.json")
+		require.NoError(t, err)
+		frames, err := tr.ToDataFrames("", data.VisTypeTable)
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		require.Equal(t, 3, frames[0].Rows())
+		v, _ := frames[0].FloatAt(0, 0)
+		assert.Equal(t, float64(3), v)
+	})
+
+	t.Run("frames do not share values with the response", func(t *testing.T) {
+		tr, err := tableFromV2JSONFile("v2_progressive_data_replace.json")
+		require.NoError(t, err)
+		first, err := tr.ToDataFrames("", data.VisTypeTable)
+		require.NoError(t, err)
+		first[0].Fields[0].Set(0, first[0].Fields[0].CopyAt(1))
+		first[0].Fields[0].Name = "changed"
+
+		second, err := tr.ToDataFrames("", data.VisTypeTable)
+		require.NoError(t, err)
+		v, _ := second[0].FloatAt(0, 0)
+		assert.Equal(t, float64(3), v)
+		assert.NotEqual(t, "changed", second[0].Fields[0].Name)
+	})
+
+	t.Run("query with errors", func(t *testing.T) {
+		tr, err := tableFromV2JSONFile("v2_query_with_errors.json")
+		require.NoError(t, err)
+		// the error is reported by both the table and the data set completion
+		require.Len(t, tr.Exceptions, 1)
+		err = tr.ExceptionsError()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Query execution lacks memory resources")
+		frames, err := tr.ToDataFrames("", "")
+		require.NoError(t, err)
+		require.Len(t, frames, 1)
+		assert.Equal(t, 1, frames[0].Rows())
+	})
+
+	t.Run("truncated response", func(t *testing.T) {
+		_, err := TableFromV2JSON(strings.NewReader(`[{"FrameType":"DataSetHeader","Version":"v2.0"},{"FrameType":"DataTable","TableId":1,"TableKind":"PrimaryResult","TableName":"PrimaryResult","Columns":[{"ColumnName":"a","ColumnType":"long"}],"Rows":[[1],[2`))
+		assert.Error(t, err)
+	})
+
+	t.Run("response without data set completion", func(t *testing.T) {
+		_, err := TableFromV2JSON(strings.NewReader(`[{"FrameType":"DataSetHeader","Version":"v2.0"},{"FrameType":"DataTable","TableId":1,"TableKind":"PrimaryResult","TableName":"PrimaryResult","Columns":[{"ColumnName":"a","ColumnType":"long"}],"Rows":[[1]]}]`))
+		assert.ErrorContains(t, err, "response ended before the data set completed")
+	})
+
+	t.Run("row with too many values", func(t *testing.T) {
+		_, err := TableFromV2JSON(strings.NewReader(`[{"FrameType":"DataTable","TableId":1,"TableKind":"PrimaryResult","TableName":"PrimaryResult","Columns":[{"ColumnName":"a","ColumnType":"long"}],"Rows":[[1, 2]]},{"FrameType":"DataSetCompletion","HasErrors":false,"Cancelled":false}]`))
+		assert.ErrorContains(t, err, "row has more values than the 1 columns")
+	})
+
+	t.Run("unsupported column type", func(t *testing.T) {
+		_, err := TableFromV2JSON(strings.NewReader(`[{"FrameType":"DataTable","TableId":1,"TableKind":"PrimaryResult","TableName":"PrimaryResult","Columns":[{"ColumnName":"a","ColumnType":"unknown"}],"Rows":[["x"]]},{"FrameType":"DataSetCompletion","HasErrors":false,"Cancelled":false}]`))
+		assert.ErrorContains(t, err, "unsupported analytics column type unknown")
+	})
+}
+
+func cmpFrames(expected, actual data.Frames) string {
+	if len(expected) != len(actual) {
+		return "number of frames differ"
+	}
+	for i := range expected {
+		expectedJSON, err := data.FrameToJSON(expected[i], data.IncludeAll)
+		if err != nil {
+			return err.Error()
+		}
+		actualJSON, err := data.FrameToJSON(actual[i], data.IncludeAll)
+		if err != nil {
+			return err.Error()
+		}
+		if string(expectedJSON) != string(actualJSON) {
+			return string(expectedJSON) + "\n!=\n" + string(actualJSON)
+		}
+	}
+	return ""
+}
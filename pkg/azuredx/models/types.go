@@ -1,11 +1,44 @@
 package models
 
+import "encoding/json"
+
 // options are properties that can be set on the ADX Connection string.
 // https://docs.microsoft.com/en-us/azure/data-explorer/kusto/api/netfx/request-properties
 type options struct {
 	DataConsistency string `json:"queryconsistency,omitempty"`
 	CacheMaxAge     string `json:"query_results_cache_max_age,omitempty"`
 	ServerTimeout   string `json:"servertimeout,omitempty"`
+
+	// ResultsProgressiveEnabled makes the v2 REST API stream tables as a sequence of fragments.
+	ResultsProgressiveEnabled bool `json:"results_progressive_enabled,omitempty"`
+
+	// TruncationMaxRecords and TruncationMaxSize override the maximum number of records and
+	// the maximum size in bytes of a query result before the cluster truncates it.
+	TruncationMaxRecords int64 `json:"truncationmaxrecords,omitempty"`
+	TruncationMaxSize    int64 `json:"truncationmaxsize,omitempty"`
+
+	// Extra holds the allow-listed client request properties set by the query.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON sends the extra client request properties next to the other options.
+func (o options) MarshalJSON() ([]byte, error) {
+	type plainOptions options
+	b, err := json.Marshal(plainOptions(o))
+	if err != nil || len(o.Extra) == 0 {
+		return b, err
+	}
+
+	merged := map[string]interface{}{}
+	if err := json.Unmarshal(b, &merged); err != nil {
+		return nil, err
+	}
+	for name, value := range o.Extra {
+		if _, ok := merged[name]; !ok {
+			merged[name] = value
+		}
+	}
+	return json.Marshal(merged)
 }
 
 // RequestPayload is the information that makes up a Kusto query for Azure's Data Explorer API.
@@ -25,19 +58,33 @@ type AzureFrameMD struct {
 	ColumnTypes []string
 }
 
-// errorResponse is a minimal structure of Azure Data Explorer's JSON
-// error body,
+// ErrorResponse is Azure Data Explorer's JSON error body.
 type ErrorResponse struct {
-	Error struct {
-		Message     string `json:"message"`
-		Type        string `json:"@type"`
-		Description string `json:"@message"`
-	} `json:"error"`
+	Error ErrorDetails `json:"error"`
+}
+
+// text returns the most descriptive message of the error.
+func (e ErrorResponse) text() string {
+	return e.Error.text()
+}
+
+// text returns the most descriptive message of the error.
+func (d ErrorDetails) text() string {
+	if d.Description != "" {
+		return d.Description
+	}
+	if d.Message != "" {
+		return d.Message
+	}
+	return "unknown error"
 }
 
 // Properties is a property bag of connection string options.
 type Properties struct {
 	Options *options `json:"options,omitempty"`
+
+	// Parameters holds the values of the parameters declared by the query as Kusto literals.
+	Parameters map[string]string `json:"parameters,omitempty"`
 }
 
 type ClusterOption struct {
@@ -46,17 +93,30 @@ type ClusterOption struct {
 }
 
 // NewConnectionProperties creates ADX connection properties based on datasource settings.
-func NewConnectionProperties(s *DatasourceSettings, cs *CacheSettings) *Properties {
+// The options set on the query, when given, take precedence over the datasource settings.
+func NewConnectionProperties(s *DatasourceSettings, cs *CacheSettings, qm *QueryModel) *Properties {
 	cacheMaxAge := s.CacheMaxAge
 	if cs != nil {
 		cacheMaxAge = cs.CacheMaxAge
 	}
 
-	return &Properties{
-		&options{
-			DataConsistency: s.DataConsistency,
-			CacheMaxAge:     cacheMaxAge,
-			ServerTimeout:   s.ServerTimeoutValue,
-		},
+	o := &options{
+		DataConsistency:      s.DataConsistency,
+		CacheMaxAge:          cacheMaxAge,
+		ServerTimeout:        s.ServerTimeoutValue,
+		TruncationMaxRecords: s.TruncationMaxRecords,
+		TruncationMaxSize:    s.TruncationMaxSize,
+	}
+	if qm != nil {
+		if qm.TruncationMaxRecords > 0 {
+			o.TruncationMaxRecords = qm.TruncationMaxRecords
+		}
+		if qm.TruncationMaxSize > 0 {
+			o.TruncationMaxSize = qm.TruncationMaxSize
+		}
+		if len(qm.ClientRequestProperties) > 0 {
+			o.Extra = qm.ClientRequestProperties
+		}
 	}
+	return &Properties{Options: o}
 }
@@ -2,13 +2,17 @@ package azuredx
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 	"strings"
 
+	"github.com/grafana/grafana-azure-sdk-go/v2/azusercontext"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
 	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/helpers"
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/kql"
 	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
 )
 
@@ -17,6 +21,8 @@ func (adx *AzureDataExplorer) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/schema", adx.getSchema)
 	mux.HandleFunc("/generateQuery", adx.generateQuery)
 	mux.HandleFunc("/clusters", adx.getClusters)
+	mux.HandleFunc("/validate", adx.validateQuery)
+	mux.HandleFunc("/streamPath", adx.getStreamPath)
 }
 
 const ManagementApiPath = "/v1/rest/mgmt"
@@ -114,6 +120,8 @@ func (adx *AzureDataExplorer) generateQuery(rw http.ResponseWriter, req *http.Re
 	}
 }
 
+// getSchema returns the schema of a database, or of all the databases of the cluster. The database,
+// table and prefix query parameters narrow down the schema, as described by models.SchemaFilter.
 func (adx *AzureDataExplorer) getSchema(rw http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" {
 		respondWithError(rw, http.StatusMethodNotAllowed, "Invalid method", nil)
@@ -128,6 +136,8 @@ func (adx *AzureDataExplorer) getSchema(rw http.ResponseWriter, req *http.Reques
 	var cluster struct {
 		ClusterUri string `json:"clusterUri,omitempty"`
 		Database   string `json:"database,omitempty"`
+		// Refresh fetches the schema from the cluster rather than serving the cached one
+		Refresh bool `json:"refresh,omitempty"`
 	}
 
 	err = json.Unmarshal(body, &cluster)
@@ -139,14 +149,14 @@ func (adx *AzureDataExplorer) getSchema(rw http.ResponseWriter, req *http.Reques
 		cluster.ClusterUri = adx.settings.ClusterURL
 	}
 
-	query := ".show databases schema as json"
-
-	if cluster.Database != "" {
-		query = fmt.Sprintf(".show databases (['%s']) schema as json", cluster.Database)
+	query := req.URL.Query()
+	filter := models.SchemaFilter{
+		Database: query.Get("database"),
+		Table:    query.Get("table"),
+		Prefix:   query.Get("prefix"),
 	}
-	payload := models.RequestPayload{
-		CSL:         query,
-		QuerySource: "schema",
+	if cluster.Database == "" {
+		cluster.Database = filter.Database
 	}
 
 	sanitized, err := helpers.SanitizeClusterUri(cluster.ClusterUri)
@@ -154,21 +164,108 @@ func (adx *AzureDataExplorer) getSchema(rw http.ResponseWriter, req *http.Reques
 		respondWithError(rw, http.StatusBadRequest, "Invalid clusterUri", err)
 		return
 	}
-	application := adx.settings.Application
-	// Default to not sending the user request headers for schema requests
-	response, err := adx.client.KustoRequest(req.Context(), sanitized, ManagementApiPath, payload, false, application)
+	schema, err := adx.schema(req.Context(), sanitized, cluster.Database, cluster.Refresh)
 	if err != nil {
 		respondWithError(rw, http.StatusInternalServerError, "Azure query unsuccessful", err)
 		return
 	}
 
 	rw.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(rw).Encode(response)
+	err = json.NewEncoder(rw).Encode(schema.Filter(filter))
 	if err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// validateQuery reports the problems of a query without sending it to the cluster. Tables and
+// columns are checked against the cached schema, and only when there is one.
+// The query is checked as it is written in the editor, so the positions of the diagnostics match it:
+// macros are checked in place and template variables are left alone.
+func (adx *AzureDataExplorer) validateQuery(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		respondWithError(rw, http.StatusMethodNotAllowed, "Invalid method", nil)
+		return
+	}
+
+	var body struct {
+		Query      string `json:"query"`
+		Database   string `json:"database,omitempty"`
+		ClusterUri string `json:"clusterUri,omitempty"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if body.ClusterUri == "" && adx.settings != nil {
+		body.ClusterUri = adx.settings.ClusterURL
+	}
+	if body.Database == "" && adx.settings != nil {
+		body.Database = adx.settings.DefaultDatabase
+	}
+	sanitized, err := helpers.SanitizeClusterUri(body.ClusterUri)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid clusterUri", err)
+		return
+	}
+
+	opts := kql.Options{IsMacro: models.IsMacro}
+	if db := adx.schemas.database(sanitized, body.Database, adx.schemaUser(req.Context())); db != nil {
+		opts.Schema = db
+	}
+	diagnostics := kql.Validate(body.Query, opts)
+	if diagnostics == nil {
+		diagnostics = []kql.Diagnostic{}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(rw).Encode(struct {
+		Diagnostics []kql.Diagnostic `json:"diagnostics"`
+	}{diagnostics})
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// getStreamPath returns the Grafana Live channel path of the live stream of the query in the body,
+// which its subscription must use.
+func (adx *AzureDataExplorer) getStreamPath(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		respondWithError(rw, http.StatusMethodNotAllowed, "Invalid method", nil)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	var user *backend.User
+	if current, ok := azusercontext.GetCurrentUser(req.Context()); ok {
+		user = current.User
+	}
+	login := adx.streamLogin(user)
+	path, err := streamPath(body, login)
+	if err == nil {
+		_, err = parseStreamQuery(path, body, login)
+	}
+	if err != nil {
+		respondWithError(rw, http.StatusBadRequest, "Invalid stream query", err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(rw).Encode(struct {
+		Path string `json:"path"`
+	}{path})
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// getDatabases lists the databases of the cluster. The prefix query parameter keeps the databases
+// whose name starts with it, ignoring case.
 func (adx *AzureDataExplorer) getDatabases(rw http.ResponseWriter, req *http.Request) {
 	if req.Method != "POST" {
 		respondWithError(rw, http.StatusMethodNotAllowed, "Invalid method", nil)
@@ -206,13 +303,30 @@ func (adx *AzureDataExplorer) getDatabases(rw http.ResponseWriter, req *http.Req
 	application := adx.settings.Application
 	// Default to not sending the user request headers for schema requests
 	response, err := adx.client.KustoRequest(req.Context(), sanitized, ManagementApiPath, payload, false, application)
+	if err == nil {
+		err = response.ExceptionsError()
+	}
 	if err != nil {
 		respondWithError(rw, http.StatusInternalServerError, "Azure query unsuccessful", err)
 		return
 	}
+	databases, err := models.DatabasesFromTableResponse(response)
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Unexpected databases response", err)
+		return
+	}
+	if prefix := strings.ToLower(req.URL.Query().Get("prefix")); prefix != "" {
+		filtered := []models.DatabaseInfo{}
+		for _, db := range databases {
+			if strings.HasPrefix(strings.ToLower(db.Name), prefix) {
+				filtered = append(filtered, db)
+			}
+		}
+		databases = filtered
+	}
 
 	rw.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(rw).Encode(response)
+	err = json.NewEncoder(rw).Encode(databases)
 	if err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
 	}
@@ -224,31 +338,46 @@ func (adx *AzureDataExplorer) getClusters(rw http.ResponseWriter, req *http.Requ
 		return
 	}
 
+	if adx.settings.ClusterURL != "" {
+		if _, err := helpers.SanitizeClusterUri(adx.settings.ClusterURL); err != nil {
+			respondWithError(rw, http.StatusBadRequest, "Invalid clusterUri", err)
+			return
+		}
+	}
+
+	clusters, err := adx.clusters(req.Context())
+	if err != nil {
+		respondWithError(rw, http.StatusInternalServerError, "Azure query unsuccessful", err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(rw).Encode(clusters)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// clusters lists the clusters found by Azure Resource Graph, with the cluster of the settings first.
+func (adx *AzureDataExplorer) clusters(ctx context.Context) ([]models.ClusterOption, error) {
 	payload := models.ARGRequestPayload{Query: "resources | where type == \"microsoft.kusto/clusters\""}
 
 	headers := map[string]string{}
 
-	clusters, err := adx.client.ARGClusterRequest(req.Context(), payload, headers)
+	clusters, err := adx.client.ARGClusterRequest(ctx, payload, headers)
 	if err != nil {
-		respondWithError(rw, http.StatusInternalServerError, "Azure query unsuccessful", err)
-		return
+		return nil, err
 	}
 
 	if adx.settings.ClusterURL != "" {
 		sanitized, err := helpers.SanitizeClusterUri(adx.settings.ClusterURL)
 		if err != nil {
-			respondWithError(rw, http.StatusBadRequest, "Invalid clusterUri", err)
-			return
+			return nil, err
 		}
 
 		clusters = addClusterFromSettings(clusters, sanitized)
 	}
-
-	rw.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(rw).Encode(clusters)
-	if err != nil {
-		rw.WriteHeader(http.StatusInternalServerError)
-	}
+	return clusters, nil
 }
 
 // addClusterFromSettings Check to see if cluster URL from settings was found in results. If found, move it to the front of the list
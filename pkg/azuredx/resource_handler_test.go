@@ -8,9 +8,13 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/grafana/grafana-azure-sdk-go/v2/azusercontext"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/stretchr/testify/require"
 
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/kql"
 	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
 )
 
@@ -37,6 +41,12 @@ func TestResourceHandler(t *testing.T) {
 
 		mux.ServeHTTP(res, httptest.NewRequest("PUT", "/generateQuery", nil))
 		require.Equal(t, http.StatusMethodNotAllowed, res.Code)
+
+		mux.ServeHTTP(res, httptest.NewRequest("PUT", "/validate", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, res.Code)
+
+		mux.ServeHTTP(res, httptest.NewRequest("PUT", "/streamPath", nil))
+		require.Equal(t, http.StatusMethodNotAllowed, res.Code)
 	})
 
 	t.Run("When kust request fails route should return an error", func(t *testing.T) {
@@ -55,7 +65,7 @@ func TestResourceHandler(t *testing.T) {
 		require.Equal(t, httpError.Message, fmt.Sprintf("Azure query unsuccessful: %s", httpError.Error))
 	})
 
-	t.Run("When kust request was successful route should return a json table", func(t *testing.T) {
+	t.Run("When kust request was successful route should return the databases", func(t *testing.T) {
 		setup()
 		adx.client = &workingClient{}
 		adx.settings = &models.DatasourceSettings{
@@ -63,12 +73,137 @@ func TestResourceHandler(t *testing.T) {
 		}
 		mux.ServeHTTP(res, httptest.NewRequest("POST", "/databases", strings.NewReader("{}")))
 		require.Equal(t, http.StatusOK, res.Code)
-		tableResponse := models.TableResponse{}
-		err := json.NewDecoder(res.Body).Decode(&tableResponse)
+		databases := []models.DatabaseInfo{}
+		err := json.NewDecoder(res.Body).Decode(&databases)
 		require.Nil(t, err)
-		require.Len(t, tableResponse.Tables, 1)
-		require.Len(t, tableResponse.Tables[0].Columns, 2)
-		require.Len(t, tableResponse.Tables[0].Rows, 2)
+		require.Equal(t, []models.DatabaseInfo{{Name: "Grafana", PrettyName: "Grafana Logs"}, {Name: "Samples"}}, databases)
+	})
+
+	t.Run("When databases are searched only the matching ones should be returned", func(t *testing.T) {
+		setup()
+		adx.client = &workingClient{}
+		adx.settings = &models.DatasourceSettings{
+			ClusterURL: "some-baseurl",
+		}
+		mux.ServeHTTP(res, httptest.NewRequest("POST", "/databases?prefix=sam", strings.NewReader("{}")))
+		require.Equal(t, http.StatusOK, res.Code)
+		require.JSONEq(t, `[{"name": "Samples"}]`, res.Body.String())
+	})
+
+	t.Run("When the schema is filtered only the matching entities should be returned", func(t *testing.T) {
+		setup()
+		adx.client = newSchemaClient(t, &models.Schema{Databases: map[string]*models.DatabaseSchema{
+			"db": {
+				Name: "db",
+				Tables: map[string]*models.TableSchema{
+					"StormEvents": {Name: "StormEvents", OrderedColumns: []models.ColumnSchema{{Name: "State", Type: "System.String", CslType: "string"}}},
+					"Logs":        {Name: "Logs"},
+				},
+				ExternalTables: map[string]*models.TableSchema{
+					"StormArchive": {Name: "StormArchive"},
+				},
+				Functions: map[string]*models.FunctionSchema{
+					"stormCount": {
+						Name:            "stormCount",
+						Body:            "{ StormEvents | where State == state | count }",
+						FunctionKind:    "Unknown",
+						InputParameters: []models.ColumnSchema{{Name: "state", CslType: "string", CslDefaultValue: "'TEXAS'"}},
+					},
+				},
+			},
+		}}, "v1.0")
+		adx.settings = &models.DatasourceSettings{ClusterURL: schemaCluster, SchemaCacheTTL: time.Hour}
+
+		mux.ServeHTTP(res, httptest.NewRequest("POST", "/schema?database=db&prefix=storm", strings.NewReader("{}")))
+		require.Equal(t, http.StatusOK, res.Code)
+		require.JSONEq(t, `{"Databases": {"db": {
+			"Name": "db",
+			"Tables": {"StormEvents": {"Name": "StormEvents", "OrderedColumns": [{"Name": "State", "Type": "System.String", "CslType": "string"}]}},
+			"ExternalTables": {"StormArchive": {"Name": "StormArchive", "OrderedColumns": []}},
+			"MaterializedViews": {},
+			"Functions": {"stormCount": {
+				"Name": "stormCount",
+				"Body": "{ StormEvents | where State == state | count }",
+				"FunctionKind": "Unknown",
+				"InputParameters": [{"Name": "state", "CslType": "string", "CslDefaultValue": "'TEXAS'"}],
+				"OutputColumns": []
+			}}
+		}}}`, res.Body.String())
+
+		res = httptest.NewRecorder()
+		mux.ServeHTTP(res, httptest.NewRequest("POST", "/schema?table=Logs", strings.NewReader(`{"database": "db"}`)))
+		require.Equal(t, http.StatusOK, res.Code)
+		schema := models.Schema{}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&schema))
+		require.Len(t, schema.Databases["db"].Tables, 1)
+		require.Contains(t, schema.Databases["db"].Tables, "Logs")
+		require.Empty(t, schema.Databases["db"].ExternalTables)
+		require.Empty(t, schema.Databases["db"].Functions)
+	})
+
+	t.Run("When a query is validated its diagnostics should be returned without calling the cluster", func(t *testing.T) {
+		setup()
+		adx.client = &failingClient{}
+		adx.settings = &models.DatasourceSettings{
+			ClusterURL:      "https://cluster.kusto.windows.net",
+			DefaultDatabase: "db",
+		}
+		adx.schemas.set(schemaKey{cluster: "https://cluster.kusto.windows.net"}, &models.Schema{
+			Databases: map[string]*models.DatabaseSchema{
+				"db": {
+					Name: "db",
+					Tables: map[string]*models.TableSchema{
+						"StormEvents": {Name: "StormEvents", OrderedColumns: []models.ColumnSchema{{Name: "State", CslType: "string"}}},
+					},
+				},
+			},
+		}, "")
+
+		mux.ServeHTTP(res, httptest.NewRequest("POST", "/validate", strings.NewReader(`{"query": "StormEvents | where Sate == 'x' and $__timeFom"}`)))
+		require.Equal(t, http.StatusOK, res.Code)
+		var body struct {
+			Diagnostics []kql.Diagnostic `json:"diagnostics"`
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		require.Len(t, body.Diagnostics, 2)
+		require.Equal(t, "unknown macro $__timeFom", body.Diagnostics[0].Message)
+		require.Equal(t, "column 'Sate' does not exist in 'StormEvents'", body.Diagnostics[1].Message)
+	})
+
+	t.Run("When a query is validated without a schema only the syntax should be checked", func(t *testing.T) {
+		setup()
+		adx.settings = &models.DatasourceSettings{ClusterURL: "https://cluster.kusto.windows.net"}
+
+		mux.ServeHTTP(res, httptest.NewRequest("POST", "/validate", strings.NewReader(`{"query": "StormEvents | where Sate == 'x'", "database": "db"}`)))
+		require.Equal(t, http.StatusOK, res.Code)
+		require.JSONEq(t, `{"diagnostics": []}`, res.Body.String())
+	})
+
+	t.Run("When the stream path of a query is requested the path of its query and user should be returned", func(t *testing.T) {
+		setup()
+		adx.userResults = true
+		query := `{"resultFormat": "logs", "query": "Logs"}`
+		ctx := azusercontext.WithCurrentUser(context.Background(), azusercontext.CurrentUserContext{User: &backend.User{Login: "alice"}})
+
+		mux.ServeHTTP(res, httptest.NewRequest("POST", "/streamPath", strings.NewReader(query)).WithContext(ctx))
+		require.Equal(t, http.StatusOK, res.Code)
+		var body struct {
+			Path string `json:"path"`
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+		require.Equal(t, mustStreamPath(t, query, "alice"), body.Path)
+	})
+
+	t.Run("When the stream path of a query that cannot be streamed is requested a 400 should be returned", func(t *testing.T) {
+		setup()
+		mux.ServeHTTP(res, httptest.NewRequest("POST", "/streamPath", strings.NewReader(`{"resultFormat": "trace", "query": "Spans"}`)))
+		require.Equal(t, http.StatusBadRequest, res.Code)
+	})
+
+	t.Run("When the validation request is malformed a 400 should be returned", func(t *testing.T) {
+		setup()
+		mux.ServeHTTP(res, httptest.NewRequest("POST", "/validate", strings.NewReader("{")))
+		require.Equal(t, http.StatusBadRequest, res.Code)
 	})
 }
 
@@ -104,14 +239,15 @@ func (c *workingClient) KustoRequest(_ context.Context, _ string, _ string, _ mo
 	return &models.TableResponse{
 		Tables: []models.Table{
 			{
-				TableName: "table1",
+				TableName: "Table_0",
 				Columns: []models.Column{
-					{ColumnName: "col1"},
-					{ColumnName: "col2"},
+					{ColumnName: "DatabaseName"},
+					{ColumnName: "Version"},
+					{ColumnName: "PrettyName"},
 				},
 				Rows: []models.Row{
-					"val1",
-					"val2",
+					[]interface{}{"Grafana", "v1.0", "Grafana Logs"},
+					[]interface{}{"Samples", "v2.3", nil},
 				},
 			},
 		},
@@ -0,0 +1,246 @@
+package azuredx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-azure-sdk-go/v2/azusercontext"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+// schemaKey identifies a cached schema, which is the schema of a database or, when database is
+// empty, of all the databases of a cluster. The user is only set when the datasource authenticates
+// as the user, as users may then see different schemas.
+type schemaKey struct {
+	cluster  string
+	database string
+	user     string
+}
+
+type schemaEntry struct {
+	schema     *models.Schema
+	version    string
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+// schemaStore holds the schemas fetched from the clusters. They back the schema resource, and the
+// validation of queries, which never calls the cluster. The schemas it holds are never modified.
+type schemaStore struct {
+	mu      sync.Mutex
+	entries map[schemaKey]*schemaEntry
+}
+
+// get returns the cached schema for key, if any, and whether it is older than ttl.
+func (s *schemaStore) get(key schemaKey, ttl time.Duration) (*models.Schema, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return e.schema, time.Since(e.fetchedAt) >= ttl
+}
+
+// set caches a schema fetched when it was at version.
+func (s *schemaStore) set(key schemaKey, schema *models.Schema, version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = map[schemaKey]*schemaEntry{}
+	}
+	e, ok := s.entries[key]
+	if !ok {
+		e = &schemaEntry{}
+		s.entries[key] = e
+	}
+	e.schema, e.version, e.fetchedAt = schema, version, time.Now()
+}
+
+// startRefresh marks the schema of key as refreshing, and returns false if it already was.
+func (s *schemaStore) startRefresh(key schemaKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || e.refreshing {
+		return false
+	}
+	e.refreshing = true
+	return true
+}
+
+func (s *schemaStore) endRefresh(key schemaKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.refreshing = false
+	}
+}
+
+// renew serves the cached schema of key for another TTL if it is still at version.
+func (s *schemaStore) renew(key schemaKey, version string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || version == "" || e.version != version {
+		return false
+	}
+	e.fetchedAt = time.Now()
+	return true
+}
+
+// database returns the cached schema of a database, stale or not, from the schema of the database
+// or of all the databases of the cluster. It returns nil when neither was fetched.
+func (s *schemaStore) database(cluster string, database string, user string) *models.DatabaseSchema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range []schemaKey{{cluster, database, user}, {cluster, "", user}} {
+		if e, ok := s.entries[key]; ok {
+			if db, ok := e.schema.Databases[database]; ok {
+				return db
+			}
+		}
+	}
+	return nil
+}
+
+// schemaUser returns the user the schemas fetched in ctx are cached for.
+func (adx *AzureDataExplorer) schemaUser(ctx context.Context) string {
+	if !adx.userResults {
+		return ""
+	}
+	if user, ok := azusercontext.GetCurrentUser(ctx); ok && user.User != nil {
+		return user.User.Login
+	}
+	return ""
+}
+
+// schema returns the schema of a database, or of all the databases of the cluster when database is
+// empty. A cached schema is served for the schema cache TTL of the datasource. Past it, the stale
+// schema is still served while it is refreshed in the background, which only fetches the schema
+// again if its version changed. A refresh fetches the schema right away.
+func (adx *AzureDataExplorer) schema(ctx context.Context, cluster string, database string, refresh bool) (*models.Schema, error) {
+	key := schemaKey{cluster: cluster, database: database, user: adx.schemaUser(ctx)}
+	ttl := adx.settings.SchemaCacheTTL
+	if !refresh && ttl > 0 {
+		if schema, stale := adx.schemas.get(key, ttl); schema != nil {
+			if stale && adx.schemas.startRefresh(key) {
+				go adx.refreshSchema(context.WithoutCancel(ctx), key)
+			}
+			return schema, nil
+		}
+	}
+	return adx.fetchSchema(ctx, key)
+}
+
+// refreshSchema refreshes a cached schema unless its version is unchanged.
+func (adx *AzureDataExplorer) refreshSchema(ctx context.Context, key schemaKey) {
+	defer adx.schemas.endRefresh(key)
+	if adx.settings.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, adx.settings.QueryTimeout)
+		defer cancel()
+	}
+
+	version, err := adx.schemaVersion(ctx, key)
+	if err != nil {
+		backend.Logger.Debug("failed to read schema version", "cluster", key.cluster, "database", key.database, "error", err.Error())
+	}
+	if adx.schemas.renew(key, version) {
+		return
+	}
+	if _, err := adx.fetchSchema(ctx, key); err != nil {
+		backend.Logger.Warn("failed to refresh schema", "cluster", key.cluster, "database", key.database, "error", err.Error())
+	}
+}
+
+// fetchSchema fetches a schema from the cluster and caches it, unless the schema cache TTL is zero.
+// Callers fetching the same schema at the same time share a single request.
+func (adx *AzureDataExplorer) fetchSchema(ctx context.Context, key schemaKey) (*models.Schema, error) {
+	cached := adx.settings.SchemaCacheTTL > 0
+	inflightKey := strings.Join([]string{"schema", key.cluster, key.database, key.user}, "\x00")
+	response, err := adx.inflight.do(ctx, inflightKey, func(ctx context.Context) (*models.TableResponse, error) {
+		// the version is read before the schema, so a schema changing in between is fetched again
+		// on the next refresh rather than kept with a version it does not have
+		version := ""
+		if cached {
+			var err error
+			if version, err = adx.schemaVersion(ctx, key); err != nil {
+				backend.Logger.Debug("failed to read schema version", "cluster", key.cluster, "database", key.database, "error", err.Error())
+			}
+		}
+
+		query := ".show databases schema as json"
+		if key.database != "" {
+			query = fmt.Sprintf(".show databases (['%s']) schema as json", key.database)
+		}
+		payload := models.RequestPayload{
+			CSL:         query,
+			QuerySource: "schema",
+		}
+		// Default to not sending the user request headers for schema requests
+		response, err := adx.client.KustoRequest(ctx, key.cluster, ManagementApiPath, payload, false, adx.settings.Application)
+		if err == nil {
+			err = response.ExceptionsError()
+		}
+		if err != nil || !cached {
+			return response, err
+		}
+		schema, err := models.SchemaFromTableResponse(response)
+		if err != nil {
+			return nil, err
+		}
+		adx.schemas.set(key, schema, version)
+		return response, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !cached {
+		return models.SchemaFromTableResponse(response)
+	}
+	schema, _ := adx.schemas.get(key, 0)
+	return schema, nil
+}
+
+// schemaVersion returns the version of a cached schema, as reported by `.show databases`. The
+// version of the schema of all databases combines the versions of every database, so it changes
+// when a database is added or removed.
+func (adx *AzureDataExplorer) schemaVersion(ctx context.Context, key schemaKey) (string, error) {
+	payload := models.RequestPayload{
+		CSL:         ".show databases",
+		QuerySource: "schema",
+	}
+	response, err := adx.client.KustoRequest(ctx, key.cluster, ManagementApiPath, payload, false, adx.settings.Application)
+	if err == nil {
+		// a partial list of databases would give a version the schema does not have
+		err = response.ExceptionsError()
+	}
+	if err != nil {
+		return "", err
+	}
+	versions, err := models.DatabaseVersions(response)
+	if err != nil {
+		return "", err
+	}
+	if key.database != "" {
+		return versions[key.database], nil
+	}
+
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=%s;", name, versions[name])
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,247 @@
+package azuredx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-azure-sdk-go/v2/azusercontext"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+const schemaCluster = "https://cluster.kusto.windows.net"
+
+// schemaResponse encodes a schema as the response to `.show databases schema as json`.
+func schemaResponse(t *testing.T, schema *models.Schema) *models.TableResponse {
+	t.Helper()
+	b, err := json.Marshal(schema)
+	require.NoError(t, err)
+	return &models.TableResponse{Tables: []models.Table{{
+		TableName: "Table_0",
+		Columns:   []models.Column{{ColumnName: "DatabaseSchema", ColumnType: "string"}},
+		Rows:      []models.Row{[]interface{}{string(b)}},
+	}}}
+}
+
+// columns returns the columns of the table of tableSchema.
+func columns(t *testing.T, schema *models.Schema) []string {
+	t.Helper()
+	require.NotNil(t, schema)
+	columns, ok := schema.Databases["db"].Columns("T")
+	require.True(t, ok)
+	return columns
+}
+
+func tableSchema(columns ...string) *models.Schema {
+	t := &models.TableSchema{Name: "T"}
+	for _, c := range columns {
+		t.OrderedColumns = append(t.OrderedColumns, models.ColumnSchema{Name: c, CslType: "string"})
+	}
+	return &models.Schema{Databases: map[string]*models.DatabaseSchema{
+		"db": {Name: "db", Tables: map[string]*models.TableSchema{"T": t}},
+	}}
+}
+
+// schemaClient serves a schema and the versions of its databases, counting the commands it runs.
+type schemaClient struct {
+	fakeClient
+	t        *testing.T
+	mu       sync.Mutex
+	schema   *models.Schema
+	version  string
+	commands map[string]int
+	// versionExceptions are the exceptions of the responses of .show databases
+	versionExceptions []string
+}
+
+func newSchemaClient(t *testing.T, schema *models.Schema, version string) *schemaClient {
+	return &schemaClient{t: t, schema: schema, version: version, commands: map[string]int{}}
+}
+
+func (c *schemaClient) KustoRequest(_ context.Context, cluster string, path string, payload models.RequestPayload, enableUserTracking bool, _ string) (*models.TableResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	require.Equal(c.t, schemaCluster, cluster)
+	require.Equal(c.t, ManagementApiPath, path)
+	require.False(c.t, enableUserTracking)
+	c.commands[payload.CSL]++
+	if payload.CSL == ".show databases" {
+		return &models.TableResponse{Tables: []models.Table{{
+			Columns: []models.Column{{ColumnName: "DatabaseName"}, {ColumnName: "PersistentStorage"}, {ColumnName: "Version"}},
+			Rows:    []models.Row{[]interface{}{"db", "", c.version}},
+		}}, Exceptions: c.versionExceptions}, nil
+	}
+	return schemaResponse(c.t, c.schema), nil
+}
+
+func (c *schemaClient) count(command string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.commands[command]
+}
+
+func (c *schemaClient) update(schema *models.Schema, version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.schema, c.version = schema, version
+}
+
+const showSchema = ".show databases (['db']) schema as json"
+
+func TestSchemaCache(t *testing.T) {
+	newDatasource := func(client *schemaClient, ttl time.Duration) *AzureDataExplorer {
+		return &AzureDataExplorer{client: client, settings: &models.DatasourceSettings{SchemaCacheTTL: ttl, QueryTimeout: time.Second}}
+	}
+	key := schemaKey{cluster: schemaCluster, database: "db"}
+	expire := func(adx *AzureDataExplorer) {
+		adx.schemas.mu.Lock()
+		defer adx.schemas.mu.Unlock()
+		adx.schemas.entries[key].fetchedAt = time.Now().Add(-2 * time.Hour)
+	}
+	refreshed := func(adx *AzureDataExplorer) func() bool {
+		return func() bool {
+			adx.schemas.mu.Lock()
+			defer adx.schemas.mu.Unlock()
+			e := adx.schemas.entries[key]
+			return !e.refreshing && time.Since(e.fetchedAt) < time.Hour
+		}
+	}
+
+	t.Run("serves a fetched schema until it expires", func(t *testing.T) {
+		client := newSchemaClient(t, tableSchema("a"), "v1.0")
+		adx := newDatasource(client, time.Hour)
+
+		for i := 0; i < 3; i++ {
+			res, err := adx.schema(context.Background(), schemaCluster, "db", false)
+			require.NoError(t, err)
+			require.Equal(t, []string{"a"}, columns(t, res))
+		}
+		require.Equal(t, 1, client.count(showSchema))
+		require.Equal(t, 1, client.count(".show databases"))
+	})
+
+	t.Run("renews an expired schema whose version is unchanged", func(t *testing.T) {
+		client := newSchemaClient(t, tableSchema("a"), "v1.0")
+		adx := newDatasource(client, time.Hour)
+		_, err := adx.schema(context.Background(), schemaCluster, "db", false)
+		require.NoError(t, err)
+		expire(adx)
+
+		res, err := adx.schema(context.Background(), schemaCluster, "db", false)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a"}, columns(t, res))
+		require.Eventually(t, refreshed(adx), time.Second, time.Millisecond)
+		require.Equal(t, 1, client.count(showSchema))
+		require.Equal(t, 2, client.count(".show databases"))
+	})
+
+	t.Run("serves an expired schema while its new version is fetched", func(t *testing.T) {
+		client := newSchemaClient(t, tableSchema("a"), "v1.0")
+		adx := newDatasource(client, time.Hour)
+		_, err := adx.schema(context.Background(), schemaCluster, "db", false)
+		require.NoError(t, err)
+		expire(adx)
+		client.update(tableSchema("a", "b"), "v1.1")
+
+		res, err := adx.schema(context.Background(), schemaCluster, "db", false)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a"}, columns(t, res))
+		require.Eventually(t, refreshed(adx), time.Second, time.Millisecond)
+		require.Equal(t, 2, client.count(showSchema))
+
+		res, err = adx.schema(context.Background(), schemaCluster, "db", false)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, columns(t, res))
+		cols, ok := adx.schemas.database(schemaCluster, "db", "").Columns("T")
+		require.True(t, ok)
+		require.Equal(t, []string{"a", "b"}, cols)
+	})
+
+	t.Run("does not keep the version of a partial response", func(t *testing.T) {
+		client := newSchemaClient(t, tableSchema("a"), "v1.0")
+		client.versionExceptions = []string{"Partial query failure"}
+		adx := newDatasource(client, time.Hour)
+		_, err := adx.schema(context.Background(), schemaCluster, "db", false)
+		require.NoError(t, err)
+		adx.schemas.mu.Lock()
+		version := adx.schemas.entries[key].version
+		adx.schemas.mu.Unlock()
+		require.Empty(t, version)
+
+		// without a version, an expired schema is fetched again
+		expire(adx)
+		_, err = adx.schema(context.Background(), schemaCluster, "db", false)
+		require.NoError(t, err)
+		require.Eventually(t, refreshed(adx), time.Second, time.Millisecond)
+		require.Equal(t, 2, client.count(showSchema))
+	})
+
+	t.Run("fetches the schema again when asked to refresh it", func(t *testing.T) {
+		client := newSchemaClient(t, tableSchema("a"), "v1.0")
+		adx := newDatasource(client, time.Hour)
+		_, err := adx.schema(context.Background(), schemaCluster, "db", false)
+		require.NoError(t, err)
+		client.update(tableSchema("b"), "v1.1")
+
+		res, err := adx.schema(context.Background(), schemaCluster, "db", true)
+		require.NoError(t, err)
+		require.Equal(t, []string{"b"}, columns(t, res))
+		require.Equal(t, 2, client.count(showSchema))
+	})
+
+	t.Run("fetches the schema every time without a TTL", func(t *testing.T) {
+		client := newSchemaClient(t, tableSchema("a"), "v1.0")
+		adx := newDatasource(client, 0)
+		res, err := adx.schema(context.Background(), schemaCluster, "db", false)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a"}, columns(t, res))
+		require.Equal(t, 1, client.count(showSchema))
+
+		client.update(tableSchema("b"), "v1.1")
+		res, err = adx.schema(context.Background(), schemaCluster, "db", false)
+		require.NoError(t, err)
+		require.Equal(t, []string{"b"}, columns(t, res))
+		require.Equal(t, 2, client.count(showSchema))
+		require.Equal(t, 0, client.count(".show databases"))
+		require.Nil(t, adx.schemas.database(schemaCluster, "db", ""))
+	})
+
+	t.Run("caches schemas per user when authenticating as the user", func(t *testing.T) {
+		client := newSchemaClient(t, tableSchema("a"), "v1.0")
+		adx := newDatasource(client, time.Hour)
+		adx.userResults = true
+		for _, login := range []string{"alice", "bob", "alice"} {
+			ctx := azusercontext.WithCurrentUser(context.Background(), azusercontext.CurrentUserContext{User: &backend.User{Login: login}})
+			_, err := adx.schema(ctx, schemaCluster, "db", false)
+			require.NoError(t, err)
+		}
+		require.Equal(t, 2, client.count(showSchema))
+		require.NotNil(t, adx.schemas.database(schemaCluster, "db", "alice"))
+		require.Nil(t, adx.schemas.database(schemaCluster, "db", ""))
+	})
+}
+
+func TestSchemaStoreDatabase(t *testing.T) {
+	var s schemaStore
+	require.Nil(t, s.database(schemaCluster, "db", ""))
+
+	s.set(schemaKey{cluster: schemaCluster}, tableSchema("a"), "")
+	cols, ok := s.database(schemaCluster, "db", "").Columns("T")
+	require.True(t, ok)
+	require.Equal(t, []string{"a"}, cols)
+
+	// the schema of the database takes precedence over the one of all databases
+	s.set(schemaKey{cluster: schemaCluster, database: "db"}, tableSchema("b"), "")
+	cols, ok = s.database(schemaCluster, "db", "").Columns("T")
+	require.True(t, ok)
+	require.Equal(t, []string{"b"}, cols)
+
+	require.Nil(t, s.database(schemaCluster, "other", ""))
+	require.Nil(t, s.database(fmt.Sprintf("%s/other", schemaCluster), "db", ""))
+}
@@ -0,0 +1,85 @@
+package azuredx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+// inflightGroup collapses identical requests that are in flight at the same time into a single
+// upstream call, whose result is shared by every caller waiting for it.
+type inflightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+type inflightCall struct {
+	done    chan struct{}
+	result  *models.TableResponse
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do runs fn once for all callers using the same key at the same time. The call is not cancelled with
+// the caller that started it, so a cancelled caller does not fail the others, but it keeps the
+// deadline of that caller. It is cancelled once every caller waiting for it has gone away.
+func (g *inflightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (*models.TableResponse, error)) (*models.TableResponse, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*inflightCall{}
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := detach(ctx)
+		c = &inflightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go g.run(callCtx, key, c, fn)
+	} else {
+		inflightDeduplicated.Inc()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.result, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// detach returns a context with the values and the deadline of ctx, which is not cancelled with ctx.
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	}
+	return context.WithCancel(context.WithoutCancel(ctx))
+}
+
+func (g *inflightGroup) run(ctx context.Context, key string, c *inflightCall, fn func(ctx context.Context) (*models.TableResponse, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("unexpected error while running query: %v", r)
+		}
+		g.mu.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		c.cancel()
+		close(c.done)
+	}()
+	c.result, c.err = fn(ctx)
+}
@@ -0,0 +1,149 @@
+package azuredx
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+func TestInflightGroup(t *testing.T) {
+	t.Run("identical calls in flight share one result", func(t *testing.T) {
+		var g inflightGroup
+		var calls atomic.Int32
+		release := make(chan struct{})
+		fn := func(context.Context) (*models.TableResponse, error) {
+			calls.Add(1)
+			<-release
+			return &models.TableResponse{Tables: []models.Table{{TableName: "shared"}}}, nil
+		}
+
+		const waiters = 10
+		results := make([]*models.TableResponse, waiters)
+		var wg sync.WaitGroup
+		for i := 0; i < waiters; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				res, err := g.do(context.Background(), "key", fn)
+				require.NoError(t, err)
+				results[i] = res
+			}(i)
+		}
+		require.Eventually(t, func() bool {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			return g.calls["key"] != nil && g.calls["key"].waiters == waiters
+		}, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		require.Equal(t, int32(1), calls.Load())
+		for _, res := range results {
+			require.Same(t, results[0], res)
+		}
+		require.Empty(t, g.calls)
+	})
+
+	t.Run("calls with different keys are not shared", func(t *testing.T) {
+		var g inflightGroup
+		var calls atomic.Int32
+		fn := func(context.Context) (*models.TableResponse, error) {
+			calls.Add(1)
+			return &models.TableResponse{}, nil
+		}
+		_, err := g.do(context.Background(), "first", fn)
+		require.NoError(t, err)
+		_, err = g.do(context.Background(), "second", fn)
+		require.NoError(t, err)
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("a cancelled caller does not cancel the call of the others", func(t *testing.T) {
+		var g inflightGroup
+		release := make(chan struct{})
+		fn := func(ctx context.Context) (*models.TableResponse, error) {
+			select {
+			case <-release:
+				return &models.TableResponse{}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelled := make(chan error)
+		go func() {
+			_, err := g.do(ctx, "key", fn)
+			cancelled <- err
+		}()
+		done := make(chan error)
+		require.Eventually(t, func() bool {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			return g.calls["key"] != nil
+		}, time.Second, time.Millisecond)
+		go func() {
+			_, err := g.do(context.Background(), "key", fn)
+			done <- err
+		}()
+		require.Eventually(t, func() bool {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			return g.calls["key"].waiters == 2
+		}, time.Second, time.Millisecond)
+
+		cancel()
+		require.ErrorIs(t, <-cancelled, context.Canceled)
+		close(release)
+		require.NoError(t, <-done)
+	})
+
+	t.Run("the call is cancelled once every caller has gone away", func(t *testing.T) {
+		var g inflightGroup
+		callCancelled := make(chan struct{})
+		fn := func(ctx context.Context) (*models.TableResponse, error) {
+			<-ctx.Done()
+			close(callCancelled)
+			return nil, ctx.Err()
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := g.do(ctx, "key", fn)
+		require.ErrorIs(t, err, context.Canceled)
+		select {
+		case <-callCancelled:
+		case <-time.After(time.Second):
+			t.Fatal("call was not cancelled")
+		}
+	})
+
+	t.Run("the call keeps the deadline of the caller that started it", func(t *testing.T) {
+		var g inflightGroup
+		deadline := time.Now().Add(time.Minute)
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		var callDeadline time.Time
+		_, err := g.do(ctx, "key", func(ctx context.Context) (*models.TableResponse, error) {
+			callDeadline, _ = ctx.Deadline()
+			return nil, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, deadline, callDeadline)
+	})
+
+	t.Run("a panic is returned as an error to every caller", func(t *testing.T) {
+		var g inflightGroup
+		_, err := g.do(context.Background(), "key", func(context.Context) (*models.TableResponse, error) {
+			panic("boom")
+		})
+		require.ErrorContains(t, err, "boom")
+		require.Empty(t, g.calls)
+	})
+}
@@ -0,0 +1,307 @@
+package azuredx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-azure-sdk-go/v2/azusercontext"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+
+	// 100% compatible drop-in replacement of "encoding/json"
+	json "github.com/json-iterator/go"
+)
+
+// streamPathPrefix is the prefix of the Grafana Live channel paths of live tail queries.
+const streamPathPrefix = "tail/"
+
+// streamJSON reads and writes the queries of streams canonically, keeping numbers as they were
+// written and sorting the keys of objects, so a query always hashes to the same channel path.
+var streamJSON = json.Config{SortMapKeys: true, UseNumber: true}.Froze()
+
+// minStreamInterval is the shortest interval a live stream may run its query on.
+var minStreamInterval = time.Second
+
+var _ backend.StreamHandler = new(AzureDataExplorer)
+
+// SubscribeStream allows subscriptions to live tail queries that can run as a stream, on the channel
+// path of their query and user.
+func (adx *AzureDataExplorer) SubscribeStream(_ context.Context, req *backend.SubscribeStreamRequest) (*backend.SubscribeStreamResponse, error) {
+	if _, err := parseStreamQuery(req.Path, req.Data, adx.streamLogin(req.PluginContext.User)); err != nil {
+		backend.Logger.Debug("rejected stream subscription", "path", req.Path, "error", err.Error())
+		return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusNotFound}, nil
+	}
+	return &backend.SubscribeStreamResponse{Status: backend.SubscribeStreamStatusOK}, nil
+}
+
+// PublishStream rejects publications, as streams are only fed by their query.
+func (adx *AzureDataExplorer) PublishStream(_ context.Context, _ *backend.PublishStreamRequest) (*backend.PublishStreamResponse, error) {
+	return &backend.PublishStreamResponse{Status: backend.PublishStreamStatusPermissionDenied}, nil
+}
+
+// RunStream runs a live tail query until the last subscriber leaves. The query is re-run on its
+// interval with $__timeFrom moved forward to the latest time seen so far, and only the rows that were
+// not sent before are sent to the subscribers. The stream ends when the result of the query has no
+// time column to tell the new rows by.
+func (adx *AzureDataExplorer) RunStream(ctx context.Context, req *backend.RunStreamRequest, sender *backend.StreamSender) error {
+	user := req.PluginContext.User
+	sq, err := parseStreamQuery(req.Path, req.Data, adx.streamLogin(user))
+	if err != nil {
+		return err
+	}
+	if user != nil {
+		ctx = azusercontext.WithCurrentUser(ctx, azusercontext.CurrentUserContext{User: user})
+	}
+
+	// the rows of a stream are appended to each other, so time series stay in the long format
+	if sq.Format == "time_series" {
+		sq.Format = "table"
+	}
+	interval := sq.Interval(minStreamInterval)
+	tail := newStreamTail(sq.TimeColumn)
+	from := time.Now().Add(-interval)
+	if sq.From != 0 {
+		from = time.UnixMilli(sq.From)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for run := 0; ; run++ {
+		if tail.seen {
+			from = tail.last
+		}
+		frame, err := adx.runStreamQuery(ctx, req.Path, sq, from, interval, user)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil && (run == 0 || models.IsPermanentError(err)):
+			// a query that never ran, or that the cluster rejects, will not succeed on the next
+			// tick, so the stream is ended
+			return err
+		case err != nil:
+			backend.Logger.Warn("failed to run stream query", "path", req.Path, "error", err.Error())
+		default:
+			rows, err := tail.next(frame)
+			if err != nil {
+				return err
+			}
+			if rows != nil && (rows.Rows() > 0 || (rows.Meta != nil && len(rows.Meta.Notices) > 0)) {
+				if err := sender.SendFrame(rows, data.IncludeAll); err != nil {
+					return err
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runStreamQuery runs the query of a stream from the given time until now, bypassing the query
+// cache, and returns its first frame.
+func (adx *AzureDataExplorer) runStreamQuery(ctx context.Context, path string, sq *models.StreamQuery, from time.Time, interval time.Duration, user *backend.User) (*data.Frame, error) {
+	q := backend.DataQuery{
+		RefID:     path,
+		TimeRange: backend.TimeRange{From: from, To: time.Now()},
+		Interval:  interval,
+	}
+	resp := adx.executeQuery(ctx, q, sq.QueryModel, &models.CacheSettings{TimeRange: &q.TimeRange}, user)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	if len(resp.Frames) == 0 {
+		return nil, nil
+	}
+	return resp.Frames[0], nil
+}
+
+// streamLogin returns the login of the user whose streams are not shared with other users, which are
+// those of all users when the datasource authenticates as the user, as a stream runs as its first
+// subscriber.
+func (adx *AzureDataExplorer) streamLogin(user *backend.User) string {
+	if !adx.userResults || user == nil {
+		return ""
+	}
+	return user.Login
+}
+
+// streamPath returns the channel path of the live stream of a query, a hash of the query and of the
+// login of its user, so subscribers only share the stream of the same query run as the same user.
+// Where the stream starts is left out of the hash, as the stream runs from where it started for its
+// first subscriber.
+func streamPath(raw []byte, login string) (string, error) {
+	var payload map[string]interface{}
+	if err := streamJSON.Unmarshal(raw, &payload); err != nil {
+		return "", backend.DownstreamError(fmt.Errorf("malformed stream query: %w", err))
+	}
+	delete(payload, "liveFrom")
+	canonical, err := streamJSON.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(canonical)
+	if login != "" {
+		h.Write([]byte{0})
+		h.Write([]byte(login))
+	}
+	return streamPathPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseStreamQuery reads the query of a live tail stream from the data of its subscription, which
+// must be the query the path of the stream is for.
+func parseStreamQuery(path string, raw []byte, login string) (*models.StreamQuery, error) {
+	if !strings.HasPrefix(path, streamPathPrefix) {
+		return nil, backend.DownstreamError(fmt.Errorf("unknown stream path %q", path))
+	}
+	expected, err := streamPath(raw, login)
+	if err != nil {
+		return nil, err
+	}
+	if path != expected {
+		return nil, backend.DownstreamError(fmt.Errorf("stream path %q is not the path of its query and user", path))
+	}
+	sq := &models.StreamQuery{}
+	if err := json.Unmarshal(raw, sq); err != nil {
+		return nil, backend.DownstreamError(fmt.Errorf("malformed stream query: %w", err))
+	}
+	if err := sq.Validate(); err != nil {
+		return nil, err
+	}
+	return sq, nil
+}
+
+// streamTail tracks the rows a stream has sent. As every run of the query includes the latest time
+// seen so far, the rows at that time are remembered so they are not sent twice.
+type streamTail struct {
+	timeColumn string
+	seen       bool
+	last       time.Time
+	// boundary holds the fingerprints of the rows sent at the last time.
+	boundary map[[sha256.Size]byte]struct{}
+}
+
+func newStreamTail(timeColumn string) *streamTail {
+	return &streamTail{timeColumn: timeColumn, boundary: map[[sha256.Size]byte]struct{}{}}
+}
+
+// next returns the rows of frame that were not sent before, and remembers them as sent. Rows
+// without a time cannot be told apart from the rows sent before, so they are left out with a notice.
+// A frame without a time column is an error, as none of its rows could be sent only once.
+func (t *streamTail) next(frame *data.Frame) (*data.Frame, error) {
+	if frame == nil {
+		return nil, nil
+	}
+	timeIdx := t.timeFieldIndex(frame)
+	if timeIdx < 0 {
+		if t.timeColumn != "" {
+			return nil, backend.DownstreamError(fmt.Errorf("the result of the live query has no datetime column %q to follow", t.timeColumn))
+		}
+		return nil, backend.DownstreamError(errors.New("the result of the live query has no datetime column to tell its new rows by: add one to the result"))
+	}
+
+	out := frame.EmptyCopy()
+	last := t.last
+	untimed := 0
+	// boundary is only set once a row at the last time is sent
+	var boundary map[[sha256.Size]byte]struct{}
+	for i := 0; i < frame.Rows(); i++ {
+		ts, ok := rowTime(frame.Fields[timeIdx], i)
+		if !ok {
+			untimed++
+			continue
+		}
+		row := frame.RowCopy(i)
+		fingerprint := rowFingerprint(row)
+		if t.seen && ts.Before(t.last) {
+			continue
+		}
+		if _, sent := t.boundary[fingerprint]; sent && ts.Equal(t.last) {
+			continue
+		}
+		out.AppendRow(row...)
+
+		switch {
+		case ts.After(last):
+			last = ts
+			boundary = map[[sha256.Size]byte]struct{}{fingerprint: {}}
+		case ts.Equal(last):
+			if boundary == nil {
+				// the last time has not moved, so the rows sent at it before remain sent
+				boundary = make(map[[sha256.Size]byte]struct{}, len(t.boundary)+1)
+				for k := range t.boundary {
+					boundary[k] = struct{}{}
+				}
+			}
+			boundary[fingerprint] = struct{}{}
+		}
+	}
+	if boundary != nil {
+		t.seen = true
+		t.last, t.boundary = last, boundary
+	}
+	if untimed > 0 {
+		out.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Rows without a value in %s were not sent, as the stream follows rows by their time: %d", frame.Fields[timeIdx].Name, untimed),
+		})
+	}
+	return out, nil
+}
+
+// timeFieldIndex returns the index of the time column of the stream in frame, or -1 without one.
+func (t *streamTail) timeFieldIndex(frame *data.Frame) int {
+	for i, f := range frame.Fields {
+		if t.timeColumn != "" {
+			if f.Name == t.timeColumn {
+				return i
+			}
+			continue
+		}
+		if f.Type() == data.FieldTypeTime || f.Type() == data.FieldTypeNullableTime {
+			return i
+		}
+	}
+	return -1
+}
+
+func rowTime(f *data.Field, i int) (time.Time, bool) {
+	switch v := f.At(i).(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// rowFingerprint hashes the values of a row, following the pointers of nullable values.
+func rowFingerprint(row []interface{}) [sha256.Size]byte {
+	h := sha256.New()
+	for _, v := range row {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				v = nil
+			} else {
+				v = rv.Elem().Interface()
+			}
+		}
+		fmt.Fprintf(h, "%v\x00", v)
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
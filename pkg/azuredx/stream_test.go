@@ -0,0 +1,290 @@
+package azuredx
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/azure-data-explorer-datasource/pkg/azuredx/models"
+)
+
+func tailFrame(times []time.Time, messages []string) *data.Frame {
+	return data.NewFrame("", data.NewField("TimeGenerated", nil, times), data.NewField("Message", nil, messages))
+}
+
+// nextRows returns the number of rows of frame the tail sends.
+func nextRows(t *testing.T, tail *streamTail, frame *data.Frame) int {
+	t.Helper()
+	rows, err := tail.next(frame)
+	require.NoError(t, err)
+	return rows.Rows()
+}
+
+func TestStreamTail(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1, t2 := t0.Add(time.Second), t0.Add(2*time.Second)
+
+	tail := newStreamTail("")
+	rows, err := tail.next(tailFrame([]time.Time{t0, t1, t1}, []string{"a", "b", "c"}))
+	require.NoError(t, err)
+	require.Equal(t, 3, rows.Rows())
+	require.Equal(t, t1, tail.last)
+
+	// the next run starts at t1 and returns the rows at t1 again
+	rows, err = tail.next(tailFrame([]time.Time{t1, t1, t1, t2}, []string{"b", "c", "d", "e"}))
+	require.NoError(t, err)
+	require.Equal(t, 2, rows.Rows())
+	require.Equal(t, "d", rows.Fields[1].At(0))
+	require.Equal(t, "e", rows.Fields[1].At(1))
+	require.Equal(t, t2, tail.last)
+
+	rows, err = tail.next(tailFrame([]time.Time{t2}, []string{"e"}))
+	require.NoError(t, err)
+	require.Equal(t, 0, rows.Rows())
+	require.Equal(t, t2, tail.last)
+
+	t.Run("rows at the last time are remembered across runs", func(t *testing.T) {
+		tail := newStreamTail("")
+		require.Equal(t, 1, nextRows(t, tail, tailFrame([]time.Time{t0}, []string{"a"})))
+		require.Equal(t, 1, nextRows(t, tail, tailFrame([]time.Time{t0, t0}, []string{"a", "b"})))
+		require.Equal(t, 0, nextRows(t, tail, tailFrame([]time.Time{t0, t0}, []string{"a", "b"})))
+	})
+
+	t.Run("nullable values are compared by value", func(t *testing.T) {
+		tail := newStreamTail("")
+		frame := func() *data.Frame {
+			message := "a"
+			return data.NewFrame("", data.NewField("TimeGenerated", nil, []*time.Time{&t0}), data.NewField("Message", nil, []*string{&message}))
+		}
+		require.Equal(t, 1, nextRows(t, tail, frame()))
+		require.Equal(t, 0, nextRows(t, tail, frame()))
+	})
+
+	t.Run("follows the configured time column", func(t *testing.T) {
+		tail := newStreamTail("IngestionTime")
+		frame := data.NewFrame("",
+			data.NewField("TimeGenerated", nil, []time.Time{t2, t0}),
+			data.NewField("IngestionTime", nil, []time.Time{t0, t1}),
+		)
+		require.Equal(t, 2, nextRows(t, tail, frame))
+		require.Equal(t, t1, tail.last)
+	})
+
+	t.Run("frames without a time column are rejected", func(t *testing.T) {
+		tail := newStreamTail("")
+		_, err := tail.next(data.NewFrame("", data.NewField("Count", nil, []int64{1})))
+		require.ErrorContains(t, err, "has no datetime column")
+		require.True(t, backend.IsDownstreamError(err))
+
+		tail = newStreamTail("IngestionTime")
+		_, err = tail.next(tailFrame([]time.Time{t0}, []string{"a"}))
+		require.ErrorContains(t, err, `has no datetime column "IngestionTime"`)
+	})
+
+	t.Run("rows without a time are left out with a notice", func(t *testing.T) {
+		tail := newStreamTail("")
+		frame := data.NewFrame("", data.NewField("TimeGenerated", nil, []*time.Time{&t0, nil}), data.NewField("Message", nil, []string{"a", "b"}))
+		rows, err := tail.next(frame)
+		require.NoError(t, err)
+		require.Equal(t, 1, rows.Rows())
+		require.Len(t, rows.Meta.Notices, 1)
+		require.Equal(t, "Rows without a value in TimeGenerated were not sent, as the stream follows rows by their time: 1", rows.Meta.Notices[0].Text)
+	})
+}
+
+// mustStreamPath returns the channel path of the stream of a query.
+func mustStreamPath(t *testing.T, raw string, login string) string {
+	t.Helper()
+	path, err := streamPath([]byte(raw), login)
+	require.NoError(t, err)
+	return path
+}
+
+func TestStreamPath(t *testing.T) {
+	query := `{"resultFormat": "logs", "query": "Logs", "liveIntervalMs": 5000}`
+	path := mustStreamPath(t, query, "")
+	require.Regexp(t, `^tail/[0-9a-f]{64}$`, path)
+
+	t.Run("the order of keys and where the stream starts do not change the path", func(t *testing.T) {
+		require.Equal(t, path, mustStreamPath(t, `{"liveIntervalMs": 5000, "query": "Logs", "liveFrom": 1000, "resultFormat": "logs"}`, ""))
+	})
+
+	t.Run("any other difference of the query changes the path", func(t *testing.T) {
+		require.NotEqual(t, path, mustStreamPath(t, `{"resultFormat": "logs", "query": "Logs", "liveIntervalMs": 5000, "clientRequestProperties": {"query_datascope": "hotcache"}}`, ""))
+		require.NotEqual(t, path, mustStreamPath(t, `{"resultFormat": "logs", "query": "Logs", "liveIntervalMs": 5000, "parameters": {"a": {"type": "long", "value": 1}}}`, ""))
+	})
+
+	t.Run("the user changes the path", func(t *testing.T) {
+		require.NotEqual(t, path, mustStreamPath(t, query, "alice"))
+		require.NotEqual(t, mustStreamPath(t, query, "alice"), mustStreamPath(t, query, "bob"))
+	})
+
+	t.Run("malformed query", func(t *testing.T) {
+		_, err := streamPath([]byte(`{`), "")
+		require.Error(t, err)
+	})
+}
+
+func TestParseStreamQuery(t *testing.T) {
+	query := `{"resultFormat": "logs", "query": "Logs", "database": "db", "liveIntervalMs": 5000, "liveFrom": 1000, "liveTimeColumn": "IngestionTime"}`
+	sq, err := parseStreamQuery(mustStreamPath(t, query, ""), []byte(query), "")
+	require.NoError(t, err)
+	require.Equal(t, "Logs", sq.Query)
+	require.Equal(t, "db", sq.Database)
+	require.Equal(t, int64(1000), sq.From)
+	require.Equal(t, "IngestionTime", sq.TimeColumn)
+	require.Equal(t, 5*time.Second, sq.Interval(time.Second))
+
+	_, err = parseStreamQuery("other/abc", []byte(`{"resultFormat": "logs"}`), "")
+	require.Error(t, err)
+	_, err = parseStreamQuery("tail/abc", []byte(query), "")
+	require.ErrorContains(t, err, "is not the path of its query and user")
+	_, err = parseStreamQuery(mustStreamPath(t, query, "alice"), []byte(query), "bob")
+	require.ErrorContains(t, err, "is not the path of its query and user")
+	for _, invalid := range []string{`{"resultFormat": "trace"}`, `{"resultFormat": "logs", "clientRequestProperties": {"servertimeout": "1h"}}`} {
+		_, err = parseStreamQuery(mustStreamPath(t, invalid, ""), []byte(invalid), "")
+		require.Error(t, err)
+	}
+}
+
+func TestStreamQueryInterval(t *testing.T) {
+	require.Equal(t, models.DefaultStreamInterval, (&models.StreamQuery{}).Interval(time.Second))
+	require.Equal(t, time.Second, (&models.StreamQuery{IntervalMs: 10}).Interval(time.Second))
+}
+
+func TestSubscribeStream(t *testing.T) {
+	adx := &AzureDataExplorer{}
+	query := []byte(`{"resultFormat": "logs", "query": "Logs"}`)
+	alice := backend.PluginContext{User: &backend.User{Login: "alice"}}
+	bob := backend.PluginContext{User: &backend.User{Login: "bob"}}
+	res, err := adx.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{PluginContext: alice, Path: mustStreamPath(t, string(query), ""), Data: query})
+	require.NoError(t, err)
+	require.Equal(t, backend.SubscribeStreamStatusOK, res.Status)
+
+	res, err = adx.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: mustStreamPath(t, `{"resultFormat": "logs", "query": "Other"}`, ""), Data: query})
+	require.NoError(t, err)
+	require.Equal(t, backend.SubscribeStreamStatusNotFound, res.Status)
+
+	t.Run("users do not share streams when the datasource authenticates as the user", func(t *testing.T) {
+		adx := &AzureDataExplorer{userResults: true}
+		path := mustStreamPath(t, string(query), "alice")
+		res, err := adx.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{PluginContext: alice, Path: path, Data: query})
+		require.NoError(t, err)
+		require.Equal(t, backend.SubscribeStreamStatusOK, res.Status)
+
+		res, err = adx.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{PluginContext: bob, Path: path, Data: query})
+		require.NoError(t, err)
+		require.Equal(t, backend.SubscribeStreamStatusNotFound, res.Status)
+
+		err = adx.RunStream(context.Background(), &backend.RunStreamRequest{PluginContext: bob, Path: path, Data: query}, nil)
+		require.ErrorContains(t, err, "is not the path of its query and user")
+	})
+
+	res, err = adx.SubscribeStream(context.Background(), &backend.SubscribeStreamRequest{Path: "unknown"})
+	require.NoError(t, err)
+	require.Equal(t, backend.SubscribeStreamStatusNotFound, res.Status)
+
+	publish, err := adx.PublishStream(context.Background(), &backend.PublishStreamRequest{Path: "tail/abc"})
+	require.NoError(t, err)
+	require.Equal(t, backend.PublishStreamStatusPermissionDenied, publish.Status)
+}
+
+type framePacketSender struct {
+	mu      sync.Mutex
+	packets []*backend.StreamPacket
+	sent    chan struct{}
+}
+
+func (s *framePacketSender) Send(p *backend.StreamPacket) error {
+	s.mu.Lock()
+	s.packets = append(s.packets, p)
+	s.mu.Unlock()
+	s.sent <- struct{}{}
+	return nil
+}
+
+func TestRunStream(t *testing.T) {
+	previous := minStreamInterval
+	minStreamInterval = time.Millisecond
+	defer func() { minStreamInterval = previous }()
+
+	var mu sync.Mutex
+	var queries []string
+	results := [][]models.Row{
+		{[]interface{}{"2024-01-01T00:00:00Z", "a"}, []interface{}{"2024-01-01T00:00:01Z", "b"}},
+		{[]interface{}{"2024-01-01T00:00:01Z", "b"}, []interface{}{"2024-01-01T00:00:02Z", "c"}},
+	}
+	kustoRequestMock = func(_ string, _ string, payload models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, payload.CSL)
+		rows := results[len(results)-1]
+		if len(queries) <= len(results) {
+			rows = results[len(queries)-1]
+		}
+		return &models.TableResponse{Tables: []models.Table{{
+			TableName: "PrimaryResult",
+			TableKind: models.TableKindPrimaryResult,
+			Columns:   []models.Column{{ColumnName: "TimeGenerated", ColumnType: "datetime"}, {ColumnName: "Message", ColumnType: "string"}},
+			Rows:      rows,
+		}}}, nil
+	}
+
+	adx := &AzureDataExplorer{client: &fakeClient{}, settings: &models.DatasourceSettings{ClusterURL: "base-url", DefaultDatabase: "db", CacheMaxAge: "5m"}, cache: newQueryCache(models.DefaultQueryCacheSize)}
+	sender := &framePacketSender{sent: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	query := `{"resultFormat": "logs", "query": "Logs | where $__timeFilter(TimeGenerated)", "liveIntervalMs": 1, "liveFrom": 1704067200000}`
+	go func() {
+		done <- adx.RunStream(ctx, &backend.RunStreamRequest{
+			Path: mustStreamPath(t, query, ""),
+			Data: []byte(query),
+		}, backend.NewStreamSender(sender))
+	}()
+
+	<-sender.sent
+	<-sender.sent
+	cancel()
+	require.NoError(t, <-done)
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	require.Len(t, sender.packets, 2)
+	var first, second data.Frame
+	require.NoError(t, first.UnmarshalJSON(sender.packets[0].Data))
+	require.NoError(t, second.UnmarshalJSON(sender.packets[1].Data))
+	require.Equal(t, 2, first.Rows())
+	require.Equal(t, 1, second.Rows())
+	require.Equal(t, "c", *second.Fields[1].At(0).(*string))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Contains(t, queries[0], "datetime(2024-01-01T00:00:00Z)")
+	// the second run starts at the last time seen
+	require.Contains(t, queries[1], "datetime(2024-01-01T00:00:01Z)")
+}
+
+func TestRunStreamWithoutTimeColumn(t *testing.T) {
+	kustoRequestMock = func(_ string, _ string, _ models.RequestPayload, _ bool, _ string) (*models.TableResponse, error) {
+		return &models.TableResponse{Tables: []models.Table{{
+			TableName: "PrimaryResult",
+			TableKind: models.TableKindPrimaryResult,
+			Columns:   []models.Column{{ColumnName: "Count", ColumnType: "long"}},
+			Rows:      []models.Row{[]interface{}{json.Number("1")}},
+		}}}, nil
+	}
+
+	adx := &AzureDataExplorer{client: &fakeClient{}, settings: &models.DatasourceSettings{ClusterURL: "base-url", DefaultDatabase: "db"}}
+	query := `{"resultFormat": "table", "query": "Logs | count"}`
+	err := adx.RunStream(context.Background(), &backend.RunStreamRequest{
+		Path: mustStreamPath(t, query, ""),
+		Data: []byte(query),
+	}, backend.NewStreamSender(&framePacketSender{sent: make(chan struct{}, 1)}))
+	require.ErrorContains(t, err, "has no datetime column")
+}
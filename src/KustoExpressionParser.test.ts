@@ -1,7 +1,9 @@
 import { TemplateSrv } from '@grafana/runtime';
+import { readFileSync } from 'fs';
+import { join } from 'path';
 import { createOperator, valueToPropertyType } from 'components/QueryEditor/VisualQueryEditor/utils/utils';
 import { AdxColumnSchema, AutoCompleteQuery, defaultQuery, QueryExpression } from 'types';
-import { DYNAMIC_TYPE_ARRAY_DELIMITER, KustoExpressionParser } from './KustoExpressionParser';
+import { DYNAMIC_TYPE_ARRAY_DELIMITER, escapeColumn, KustoExpressionParser } from './KustoExpressionParser';
 import { QueryEditorPropertyType } from './schema/types';
 import {
   QueryEditorExpressionType,
@@ -1427,6 +1429,117 @@ describe('KustoExpressionParser', () => {
 
       expect(parser.toQuery(expression)).toEqual('TestDB' + '\n| where ["Duration"] < timespan(\'00:10:00\')');
     });
+
+    it('should quote names and values that contain quotes', () => {
+      const expression = createQueryExpression({
+        from: createProperty("Storm'Events"),
+        where: createWhereArray([
+          createOperator('state"name', '==', "O'Hare \\ Chicago"),
+          createOperator('city', 'in', ["it's", 'x']),
+        ]),
+      });
+
+      expect(parser.toQuery(expression)).toEqual(
+        "['Storm\\'Events']" +
+          '\n| where ["state\\"name"] == \'O\\\'Hare \\\\ Chicago\'' +
+          "\n| where [\"city\"] in ('it\\'s', 'x')"
+      );
+    });
+
+    it('should quote table names that are not identifiers', () => {
+      const expression = createQueryExpression({
+        from: createProperty('Storm#Events'),
+      });
+
+      expect(parser.toQuery(expression)).toEqual("['Storm#Events']");
+    });
+
+    it.each([
+      ['$table', '$table'],
+      ['${table}', '${table}'],
+      ['${table:raw}', '${table:raw}'],
+      ["MyFunction($__timeFrom, 'a,b', 10, ${var:csv})", "MyFunction($__timeFrom, 'a,b', 10, ${var:csv})"],
+      ['MyFunction()', 'MyFunction()'],
+      ['$table | union Secret', "['$table | union Secret']"],
+      ['StormEvents | take 1 //(', "['StormEvents | take 1 //(']"],
+      ['MyFunction(a) | union Secret', "['MyFunction(a) | union Secret']"],
+    ])('should only leave table names that are variables or function calls unquoted: %s', (table, expected) => {
+      expect(parser.toQuery(createQueryExpression({ from: createProperty(table) }))).toEqual(expected);
+    });
+
+    it('should quote values that only start with a template variable', () => {
+      const templateSrv: TemplateSrv = {
+        getVariables: jest.fn().mockReturnValue([{ id: 'x', name: 'x' }]),
+        replace: jest.fn(),
+        containsTemplate: jest.fn(),
+        updateTimeRange: jest.fn(),
+      };
+      const parser = new KustoExpressionParser(templateSrv);
+
+      const expression = createQueryExpression({
+        from: createProperty('T'),
+        where: createWhereArray([
+          createOperator('a', '==', '${x:y} or 1==1 | union Secret'),
+          createOperator('b', 'in', '${x:csv}'),
+          createOperator('c', '==', '${x}'),
+        ]),
+      });
+
+      expect(parser.toQuery(expression)).toEqual(
+        'T' +
+          "\n| where [\"a\"] == '${x:y} or 1==1 | union Secret'" +
+          '\n| where ["b"] in ${x:csv}' +
+          '\n| where ["c"] == ${x}'
+      );
+    });
+  });
+});
+
+describe('escapeColumn', () => {
+  it.each([
+    ['Name', '["Name"]'],
+    ['a b', '["a b"]'],
+    ['["a b"]', '["a b"]'],
+    ['Col["a"]["b"]', 'Col["a"]["b"]'],
+    ['Col["a\\"b"]', 'Col["a\\"b"]'],
+    ['x"] | take 1 //["y"]', '["x\\"] | take 1 //[\\"y\\"]"]'],
+    ['Col["a"] | take 1', '["Col[\\"a\\"] | take 1"]'],
+    ['a\\b', '["a\\\\b"]'],
+  ])('escapes %s', (column, expected) => {
+    expect(escapeColumn(column)).toEqual(expected);
+  });
+});
+
+interface GoldenCase {
+  name: string;
+  expression: QueryExpression;
+  columns?: AdxColumnSchema[];
+  query: string;
+  unresolved?: string[];
+}
+
+// The backend compiles the same expressions to the same queries, see pkg/azuredx/expression.
+describe('KustoExpressionParser golden queries shared with the backend', () => {
+  const goldenCases: GoldenCase[] = JSON.parse(
+    readFileSync(join(__dirname, '..', 'pkg', 'azuredx', 'expression', 'testdata', 'golden.json'), 'utf8')
+  );
+
+  it.each(goldenCases)('$name', ({ expression, columns, query, unresolved }) => {
+    // the template variables the backend leaves for the browser to replace are the ones that exist
+    const names = (unresolved ?? [])
+      .join(' ')
+      .split(/(?=\$)/)
+      .map((value) => value.match(/^\$\{?(\w+)/)?.[1])
+      .filter((name): name is string => !!name);
+    const templateSrv: TemplateSrv = {
+      getVariables: jest.fn().mockReturnValue(names.map((name) => ({ id: name, name }))),
+      replace: jest.fn(),
+      containsTemplate: jest.fn(),
+      updateTimeRange: jest.fn(),
+    };
+    const parser = new KustoExpressionParser(templateSrv);
+
+    expect(parser.toQuery(expression, columns)).toEqual(query);
   });
 });
 
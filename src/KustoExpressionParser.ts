@@ -20,17 +20,34 @@ import {
 } from './types/expressions';
 
 interface ParseContext {
+  // the time column the query is filtered and ordered by, escaped, or cast to datetime when it is dynamic
   timeColumn?: string;
   castIfDynamic: (column: string, schemaName?: string) => string;
 }
 
 export const DYNAMIC_TYPE_ARRAY_DELIMITER = '["`indexer`"]';
 
+// dynamicSelector matches columns that are already escaped or that select dynamic properties, such as
+// ["a b"] and Col["a"]["b"]
+const dynamicSelector = /^(?:[A-Za-z_][A-Za-z0-9_]*)?(?:\["(?:[^"\\\n]|\\.)*"\])+$/;
+
 export const escapeColumn = (column: string) => {
-  // If a column is escaped or a dynamic column with a selector we return it as is
-  return column.match(/\[".*"\]/) ? column : `["${column}"]`;
+  return dynamicSelector.test(column) ? column : `["${column.replace(/[\\"]/g, '\\$&')}"]`;
 };
 
+// tableArgument is an argument of a function a schema mapping calls: a variable, an identifier, a
+// number, a timespan or a string.
+const tableArgument = String.raw`\s*(?:\$\w+|\$\{\w+(?::\w+)?\}|[A-Za-z_][A-Za-z0-9_]*|-?\d+(?:\.\d+)?[A-Za-z]*|'(?:[^'\\\n]|\\.)*'|"(?:[^"\\\n]|\\.)*")\s*`;
+// tableVariable matches tables named by a template variable, such as $table and ${table}
+const tableVariable = /^\$(?:\w+|\{\w+(?::\w+)?\})$/;
+// tableFunction matches the schema mappings that call a function, such as MyFunction($__timeFrom, 'x', 10)
+const tableFunction = new RegExp(String.raw`^[A-Za-z_][A-Za-z0-9_]*\((?:${tableArgument}(?:,${tableArgument})*)?\)$`);
+
+// templateVariable matches the values left for the browser to replace: $var, '$var', ${var} and ${var:format}
+const templateVariable = /^(?:\$(\w+)|'\$(\w+)'|\$\{(\w+)(?::\w+)?\})$/;
+
+const quoteString = (value: string) => `'${value.replace(/[\\']/g, '\\$&')}'`;
+
 export class KustoExpressionParser {
   constructor(private templateSrv: TemplateSrv = getTemplateSrv()) {}
 
@@ -114,7 +131,7 @@ export class KustoExpressionParser {
       return;
     }
 
-    parts.push(`extend ${escapeColumn(context.timeColumn)} = ${escapeColumn(context.timeColumn)} + ${timeshift}`);
+    parts.push(`extend ${context.timeColumn} = ${context.timeColumn} + ${timeshift}`);
   }
 
   private appendTimeFilter(
@@ -131,17 +148,17 @@ export class KustoExpressionParser {
 
     if (timeshift) {
       parts.push(
-        `where ${escapeColumn(context.timeColumn)} between (($__timeFrom - ${timeshift}) .. ($__timeTo - ${timeshift}))`
+        `where ${context.timeColumn} between (($__timeFrom - ${timeshift}) .. ($__timeTo - ${timeshift}))`
       );
       return;
     }
 
     if (context.timeColumn.includes('todatetime')) {
-      parts.push(`where ${escapeColumn(context.timeColumn)} between ($__timeFrom .. $__timeTo)`);
+      parts.push(`where ${context.timeColumn} between ($__timeFrom .. $__timeTo)`);
       return;
     }
 
-    parts.push(`where $__timeFilter(${escapeColumn(context.timeColumn)})`);
+    parts.push(`where $__timeFilter(${context.timeColumn})`);
   }
 
   private appendOrderBy(
@@ -158,7 +175,7 @@ export class KustoExpressionParser {
     const noReduce = Array.isArray(reduce.expressions) && reduce.expressions.length === 0;
 
     if (noGroupBy && noReduce) {
-      parts.push(`order by ${escapeColumn(context.timeColumn)} asc`);
+      parts.push(`order by ${context.timeColumn} asc`);
       return;
     }
 
@@ -170,7 +187,7 @@ export class KustoExpressionParser {
     });
 
     if (hasInterval) {
-      parts.push(`order by ${escapeColumn(context.timeColumn)} asc`);
+      parts.push(`order by ${context.timeColumn} asc`);
       return;
     }
   }
@@ -330,11 +347,11 @@ export class KustoExpressionParser {
       case QueryEditorPropertyType.Boolean:
         return val;
       case QueryEditorPropertyType.DateTime:
-        return `datetime('${val}')`;
+        return `datetime(${quoteString(String(val))})`;
       case QueryEditorPropertyType.TimeSpan:
-        return `timespan('${val}')`;
+        return `timespan(${quoteString(String(val))})`;
       default:
-        return `'${val}'`;
+        return quoteString(String(val));
     }
   }
 
@@ -374,11 +391,10 @@ export class KustoExpressionParser {
   }
 
   private formatProperty(property: string): string {
-    const specialCharacters = /[\s\.-]/; // space, dot, or dash
-    const schemaMappingCharacters = /[\$\(]/; // $ or (
+    const identifier = /^[A-Za-z_][A-Za-z0-9_]*$/;
 
-    if (specialCharacters.test(property) && !schemaMappingCharacters.test(property)) {
-      return `['${property}']`;
+    if (property && !identifier.test(property) && !tableVariable.test(property) && !tableFunction.test(property)) {
+      return `['${property.replace(/[\\']/g, '\\$&')}']`;
     }
 
     return property;
@@ -390,10 +406,13 @@ export class KustoExpressionParser {
     }
 
     const val = typeof value === 'string' ? value : value.value || '';
+    const match = templateVariable.exec(val);
+    if (!match) {
+      return false;
+    }
+    const name = match[1] ?? match[2] ?? match[3];
 
-    return !!this.templateSrv.getVariables().find((variable: any) => {
-      return `$${variable?.name}` === val || `'$${variable?.name}'` === val || val.startsWith(`\$\{${variable?.name}:`);
-    });
+    return !!this.templateSrv.getVariables().find((variable: any) => variable?.name === name);
   }
 }
 
@@ -427,7 +446,7 @@ const defaultTimeColumn = (columns?: AdxColumnSchema[], expression?: QueryExpres
   });
 
   if (firstLevelColumn) {
-    return firstLevelColumn?.Name;
+    return escapeColumn(firstLevelColumn.Name);
   }
 
   const column = columns?.find((col) => col.CslType === 'datetime');
@@ -489,7 +508,7 @@ const replaceByIndex = (
 };
 
 const isValidTimeSpan = (value: string) => {
-  return /^(\d{1,15}(?:d|h|ms|s|m){0,1})$/gm.test(value);
+  return /^(\d{1,15}(?:d|h|ms|s|m){0,1})$/.test(value);
 };
 
 const detectTimeshift = (
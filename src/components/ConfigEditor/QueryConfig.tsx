@@ -59,6 +59,26 @@ const QueryConfig: React.FC<QueryConfigProps> = ({ options, updateJsonData }) =>
         />
       </Field>
 
+      <Field
+        label={t('components.query-config.label-max-concurrent-queries', 'Max concurrent queries')}
+        description={t(
+          'components.query-config.description-max-concurrent-queries',
+          'The maximum number of queries of a single request, such as the queries of a panel, that run against the cluster at the same time. Defaults to 8.'
+        )}
+      >
+        <Input
+          type="number"
+          value={jsonData.maxConcurrentQueries}
+          id="adx-max-concurrent-queries"
+          // eslint-disable-next-line @grafana/i18n/no-untranslated-strings
+          placeholder="8"
+          width={18}
+          onChange={(ev: React.ChangeEvent<HTMLInputElement>) =>
+            updateJsonData('maxConcurrentQueries', ev.target.value ? Number(ev.target.value) : undefined)
+          }
+        />
+      </Field>
+
       <Field
         label={t('components.query-config.label-use-dynamic-caching', 'Use dynamic caching')}
         description={t(
@@ -90,6 +110,99 @@ const QueryConfig: React.FC<QueryConfigProps> = ({ options, updateJsonData }) =>
         />
       </Field>
 
+      <Field
+        label={t('components.query-config.label-query-cache-size', 'Query cache size')}
+        description={t(
+          'components.query-config.description-query-cache-size',
+          'The number of query results kept in memory. Results are only cached when a cache max age applies to the query. Defaults to 256.'
+        )}
+      >
+        <Input
+          type="number"
+          value={jsonData.queryCacheSize}
+          id="adx-query-cache-size"
+          // eslint-disable-next-line @grafana/i18n/no-untranslated-strings
+          placeholder="256"
+          width={18}
+          onChange={(ev: React.ChangeEvent<HTMLInputElement>) =>
+            updateJsonData('queryCacheSize', ev.target.value ? Number(ev.target.value) : undefined)
+          }
+        />
+      </Field>
+
+      <Field
+        label={t('components.query-config.label-schema-cache-ttl', 'Schema cache TTL')}
+        description={t(
+          'components.query-config.description-schema-cache-ttl',
+          'How long a fetched schema is used before it is refreshed. A stale schema is still used while it refreshes, and is only fetched again when it changed. Defaults to 5m, 0s disables the cache.'
+        )}
+      >
+        <Input
+          value={jsonData.schemaCacheTTL}
+          id="adx-schema-cache-ttl"
+          // eslint-disable-next-line @grafana/i18n/no-untranslated-strings
+          placeholder="5m"
+          width={18}
+          onChange={(ev: React.ChangeEvent<HTMLInputElement>) => updateJsonData('schemaCacheTTL', ev.target.value)}
+        />
+      </Field>
+
+      <Field
+        label={t('components.query-config.label-partial-results-as-errors', 'Partial results as errors')}
+        description={t(
+          'components.query-config.description-partial-results-as-errors',
+          'When a query only partly succeeds the results returned so far are shown with a warning. Enable this to fail such queries instead, for example so alerts do not evaluate incomplete data.'
+        )}
+      >
+        <Switch
+          value={jsonData.partialResultsAsErrors}
+          id="adx-partial-results-as-errors"
+          onChange={(ev: React.ChangeEvent<HTMLInputElement>) =>
+            updateJsonData('partialResultsAsErrors', ev.target.checked)
+          }
+        />
+      </Field>
+
+      <Field
+        label={t('components.query-config.label-truncation-max-records', 'Max result records')}
+        description={t(
+          'components.query-config.description-truncation-max-records',
+          'The maximum number of records returned by a query. Defaults to the limit of the cluster.'
+        )}
+      >
+        <Input
+          type="number"
+          value={jsonData.truncationMaxRecords}
+          id="adx-truncation-max-records"
+          // eslint-disable-next-line @grafana/i18n/no-untranslated-strings
+          placeholder="500000"
+          width={18}
+          onChange={(ev: React.ChangeEvent<HTMLInputElement>) =>
+            updateJsonData('truncationMaxRecords', ev.target.value ? Number(ev.target.value) : undefined)
+          }
+        />
+      </Field>
+
+      <Field
+        label={t('components.query-config.label-truncation-max-size', 'Max result size')}
+        description={t(
+          'components.query-config.description-truncation-max-size',
+          'The maximum size in bytes of the result of a query. Defaults to the limit of the cluster.'
+        )}
+      >
+        <Input
+          type="number"
+          value={jsonData.truncationMaxSize}
+          id="adx-truncation-max-size"
+          // eslint-disable-next-line @grafana/i18n/no-untranslated-strings
+          placeholder="67108864"
+          width={18}
+          onChange={(ev: React.ChangeEvent<HTMLInputElement>) =>
+            updateJsonData('truncationMaxSize', ev.target.value ? Number(ev.target.value) : undefined)
+          }
+        />
+      </Field>
+
       <Field
         label={t('components.query-config.label-data-consistency', 'Data consistency')}
         description={
@@ -38,6 +38,20 @@ const TrackingConfig: React.FC<TrackingConfigProps> = ({ options, updateJsonData
           }
         />
       </Field>
+
+      <Field
+        label={t('components.tracking-config.label-audit-log', 'Audit log')}
+        description={t(
+          'components.tracking-config.description-audit-log',
+          'Record every executed query with the Grafana user, cluster, database, a hash of the query, its duration and row count. Entries are written to the plugin logs, or to the file set by the GF_PLUGIN_AUDIT_LOG_PATH environment variable.'
+        )}
+      >
+        <Switch
+          id="adx-audit-log"
+          value={jsonData.auditLog}
+          onChange={(ev: React.ChangeEvent<HTMLInputElement>) => updateJsonData('auditLog', ev.target.checked)}
+        />
+      </Field>
     </ConfigSubSection>
   );
 };
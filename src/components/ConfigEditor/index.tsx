@@ -54,6 +54,7 @@ const ConfigEditor: React.FC<ConfigEditorProps> = (props) => {
         options.jsonData.cacheMaxAge ||
         options.jsonData.useSchemaMapping ||
         options.jsonData.enableUserTracking ||
+        options.jsonData.auditLog ||
         options.jsonData.application ||
         options.secureJsonFields['OpenAIAPIKey']
       ),
@@ -149,6 +149,35 @@ T | make-series avg(HatInventory) on Timestamp from $__timeFrom to $__timeTo ste
               ms
             </Trans>
           </li>
+          <li>
+            <Trans i18nKey="components.editor-help.interval-ms" values={{ macro: '$__interval_ms', example: '5000' }}>
+              {'{{macro}}'}: {'{{example}}'}. The same bin size as a number of milliseconds
+            </Trans>
+          </li>
+          {/* eslint-disable-next-line @grafana/i18n/no-untranslated-strings */}
+          <li>$__timeFilterUnix(epochColumn): epochColumn &ge; 1528222198 and epochColumn &le; 1528229398</li>
+          <li>
+            <Trans
+              i18nKey="components.editor-help.time-bin"
+              values={{ macro: '$__timeBin(datetimeColumn)', example: 'bin(datetimeColumn, 5000ms)' }}
+            >
+              {'{{macro}}'}: {'{{example}}'}. The bin size may be given as second argument
+            </Trans>
+          </li>
+          <li>
+            <Trans i18nKey="components.editor-help.time-bin-tz" values={{ macro: '$__timeBinTz(datetimeColumn, 1d)' }}>
+              {'{{macro}}'}: bins in the timezone of the dashboard
+            </Trans>
+          </li>
+          <li>
+            <Trans
+              i18nKey="components.editor-help.time-group"
+              values={{ macro: '$__timeGroup(datetimeColumn, 1h, 0)', example: 'make-series count() $__timeGroup(TimeGenerated, 1h, 0)' }}
+            >
+              {'{{macro}}'}: the axis of a make-series over the time range, with bins without rows filled with 0. Example:{' '}
+              {'{{example}}'}
+            </Trans>
+          </li>
         </p>
 
         <p>
@@ -3,7 +3,7 @@ import React from 'react';
 import { selectors } from 'test/selectors';
 
 import { mockDatasource, mockQuery } from '../__fixtures__/Datasource';
-import { RawQueryEditor } from './RawQueryEditor';
+import { RawQueryEditor, utf16Offset } from './RawQueryEditor';
 
 jest.mock('@grafana/runtime', () => {
   const original = jest.requireActual('@grafana/runtime');
@@ -40,3 +40,12 @@ describe('RawQueryEditor', () => {
     await screen.findByTestId('Spinner');
   });
 });
+
+describe('utf16Offset', () => {
+  it('should map byte offsets of the UTF-8 query to offsets of the editor', () => {
+    const query = "T | where a == 'é😀' and Sate";
+    expect(utf16Offset(query, 28)).toBe(query.indexOf('Sate'));
+    expect(utf16Offset('abc', 1)).toBe(1);
+    expect(utf16Offset('abc', 5)).toBe(3);
+  });
+});
@@ -2,9 +2,10 @@ import { QueryEditorProps, SelectableValue } from '@grafana/data';
 import { getTemplateSrv, reportInteraction } from '@grafana/runtime';
 import { CodeEditor, Monaco, MonacoEditor } from '@grafana/ui';
 import { AdxDataSource } from 'datasource';
+import { debounce } from 'lodash';
 import React, { useCallback, useEffect, useRef, useState } from 'react';
 import { selectors } from 'test/selectors';
-import { AdxDataSourceOptions, AdxSchema, KustoQuery } from 'types';
+import { AdxDataSourceOptions, AdxSchema, KustoErrorDetails, KustoQuery, QueryDiagnostic } from 'types';
 
 import { getFunctions, getSignatureHelp } from './Suggestions';
 
@@ -26,6 +27,8 @@ export const RawQueryEditor: React.FC<RawQueryEditorProps> = (props) => {
   const [worker, setWorker] = useState<Worker>();
   const [variables] = useState(getTemplateSrv().getVariables());
   const editorRef = useRef<MonacoEditor | null>(null);
+  const monacoRef = useRef<Monaco | null>(null);
+  const [mounted, setMounted] = useState(false);
 
   const onRawQueryChange = useCallback(() => {
     const kql = editorRef.current?.getValue() || '';
@@ -53,6 +56,8 @@ export const RawQueryEditor: React.FC<RawQueryEditorProps> = (props) => {
 
   const handleEditorMount = (editor: MonacoEditor, monaco: Monaco) => {
     editorRef.current = editor;
+    monacoRef.current = monaco;
+    setMounted(true);
     monaco.languages.registerSignatureHelpProvider('kusto', {
       signatureHelpTriggerCharacters: ['(', ')'],
       provideSignatureHelp: getSignatureHelp,
@@ -103,6 +108,69 @@ export const RawQueryEditor: React.FC<RawQueryEditorProps> = (props) => {
     }
   }, [worker, schema, variables, props.database]);
 
+  useEffect(() => {
+    const model = editorRef.current?.getModel();
+    if (!model || !monacoRef.current) {
+      return;
+    }
+    // the cluster locates errors in the executed query, so they are only marked while the editor
+    // holds the same query
+    const frame = props.data?.series.find((f) => f.refId === query.refId && f.meta?.custom?.kustoError);
+    const kustoError: KustoErrorDetails | undefined = frame?.meta?.custom?.kustoError;
+    const monaco = monacoRef.current;
+    const markers =
+      kustoError?.line && frame?.meta?.executedQueryString === query.query
+        ? [
+            {
+              severity: monaco.MarkerSeverity.Error,
+              message: kustoError.message,
+              startLineNumber: kustoError.line,
+              startColumn: (kustoError.position ?? 0) + 1,
+              endLineNumber: kustoError.line,
+              endColumn: (kustoError.position ?? 0) + 1 + Math.max(kustoError.token?.length ?? 0, 1),
+            },
+          ]
+        : [];
+    monaco.editor.setModelMarkers(model, 'adx', markers);
+  }, [props.data, query.refId, query.query]);
+
+  // the query is validated by the backend as it is edited, without running it
+  const { datasource, database } = props;
+  const clusterUri = query.clusterUri ?? '';
+  useEffect(() => {
+    const editor = editorRef.current;
+    const monaco = monacoRef.current;
+    const model = editor?.getModel();
+    if (!mounted || !editor || !monaco || !model) {
+      return;
+    }
+    const validate = debounce(() => {
+      const text = model.getValue();
+      datasource
+        .validateQuery(text, database, clusterUri)
+        .then((diagnostics) => {
+          // the query may have changed while it was validated
+          if (model.isDisposed() || model.getValue() !== text) {
+            return;
+          }
+          monaco.editor.setModelMarkers(
+            model,
+            'adx-validate',
+            diagnostics.map((diagnostic) => diagnosticMarker(monaco, model, text, diagnostic))
+          );
+        })
+        .catch(() => {
+          // validation is a hint, the query still runs without it
+        });
+    }, 500);
+    const subscription = editor.onDidChangeModelContent(validate);
+    validate();
+    return () => {
+      subscription.dispose();
+      validate.cancel();
+    };
+  }, [mounted, datasource, database, clusterUri]);
+
   if (!schema) {
     return null;
   }
@@ -123,3 +191,37 @@ export const RawQueryEditor: React.FC<RawQueryEditorProps> = (props) => {
     </div>
   );
 };
+
+type EditorModel = NonNullable<ReturnType<MonacoEditor['getModel']>>;
+
+// diagnosticMarker marks a diagnostic of the backend in the editor. The backend counts offsets in
+// bytes of the UTF-8 query, while the editor counts them in UTF-16 code units.
+function diagnosticMarker(monaco: Monaco, model: EditorModel, text: string, diagnostic: QueryDiagnostic) {
+  const start = model.getPositionAt(utf16Offset(text, diagnostic.offset));
+  const end = model.getPositionAt(utf16Offset(text, diagnostic.offset + Math.max(diagnostic.length, 1)));
+  return {
+    severity: diagnostic.severity === 'error' ? monaco.MarkerSeverity.Error : monaco.MarkerSeverity.Warning,
+    message: diagnostic.message,
+    startLineNumber: start.lineNumber,
+    startColumn: start.column,
+    endLineNumber: end.lineNumber,
+    endColumn: end.column,
+  };
+}
+
+// utf16Offset returns the offset in text of a byte offset of its UTF-8 encoding.
+export function utf16Offset(text: string, byteOffset: number): number {
+  let bytes = 0;
+  for (let i = 0; i < text.length; i++) {
+    if (bytes >= byteOffset) {
+      return i;
+    }
+    const code = text.codePointAt(i) ?? 0;
+    bytes += code < 0x80 ? 1 : code < 0x800 ? 2 : code < 0x10000 ? 3 : 4;
+    if (code >= 0x10000) {
+      // the second code unit of a surrogate pair
+      i++;
+    }
+  }
+  return text.length;
+}
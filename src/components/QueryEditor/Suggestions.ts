@@ -63,6 +63,75 @@ export function getFunctions(variables: TypedVariableModel[]): Record<string, Ad
       InputParameters: [],
       OutputColumns: [],
     },
+    $__interval_ms: {
+      Name: '$__interval_ms',
+      Body: '{ 1000 }',
+      FunctionKind: 'Unknown',
+      DocString: 'Built-in variable that returns `$__timeInterval` as a number of milliseconds.',
+      InputParameters: [],
+      OutputColumns: [],
+    },
+    $__timeFilterUnix: {
+      Name: '$__timeFilterUnix',
+      Body: '{ true }',
+      FunctionKind: 'Unknown',
+      InputParameters: [
+        { Name: 'epochColumn', CslType: 'long', Type: 'System.Int64' },
+        { Name: 'unit', CslType: 'string', Type: 'System.String', CslDefaultValue: 's' },
+      ],
+      OutputColumns: [],
+      DocString:
+        '##### Macro that uses the selected timerange in Grafana to filter a column of epoch times.\n\n' +
+        '- `$__timeFilterUnix(epochColumn)` -> For epoch seconds\n\n' +
+        '- `$__timeFilterUnix(epochColumn, ms)` -> For epoch milliseconds',
+    },
+    $__timeBin: {
+      Name: '$__timeBin',
+      Body: '{ bin(TimeGenerated, 1s) }',
+      FunctionKind: 'Unknown',
+      InputParameters: [
+        { Name: 'timeColumn', CslType: 'datetime', Type: 'System.DateTime' },
+        { Name: 'interval', CslType: 'timespan', Type: 'System.TimeSpan', CslDefaultValue: '$__timeInterval' },
+      ],
+      OutputColumns: [],
+      DocString:
+        '##### Macro that bins a datetime column.\n\n' +
+        '`$__timeBin(' +
+        defaultTimeField +
+        ')` expands to `bin(' +
+        defaultTimeField +
+        ', $__timeInterval)`. The bin size may be given as second argument.',
+    },
+    $__timeBinTz: {
+      Name: '$__timeBinTz',
+      Body: '{ bin(TimeGenerated, 1s) }',
+      FunctionKind: 'Unknown',
+      InputParameters: [
+        { Name: 'timeColumn', CslType: 'datetime', Type: 'System.DateTime' },
+        { Name: 'interval', CslType: 'timespan', Type: 'System.TimeSpan', CslDefaultValue: '$__timeInterval' },
+      ],
+      OutputColumns: [],
+      DocString:
+        '##### Macro that bins a datetime column in the timezone of the dashboard.\n\n' +
+        'Daily bins start at midnight in the timezone of the dashboard rather than in UTC.',
+    },
+    $__timeGroup: {
+      Name: '$__timeGroup',
+      Body: '{ on TimeGenerated from $__timeFrom to $__timeTo step $__timeInterval }',
+      FunctionKind: 'Unknown',
+      InputParameters: [
+        { Name: 'timeColumn', CslType: 'datetime', Type: 'System.DateTime' },
+        { Name: 'interval', CslType: 'timespan', Type: 'System.TimeSpan', CslDefaultValue: '$__timeInterval' },
+        { Name: 'fill', CslType: 'string', Type: 'System.String' },
+      ],
+      OutputColumns: [],
+      DocString:
+        '##### Macro that builds the axis of a make-series over the selected timerange.\n\n' +
+        'Bins without rows are filled with the fill value, which may be `null`.\n\n' +
+        'Example: `make-series count() $__timeGroup(' +
+        defaultTimeField +
+        ', 1h, 0) by Category`',
+    },
     $__contains: {
       Name: '$__contains',
       Body: `{ colName in ('value1','value2') }`,
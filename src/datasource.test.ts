@@ -48,7 +48,7 @@ describe('AdxDataSource', () => {
   });
 
   describe('when performing getDatabases', () => {
-    const response = setupTableResponse();
+    const response = setupDatabasesResponse();
 
     beforeEach(() => {
       ctx.ds = new AdxDataSource(ctx.instanceSettings);
@@ -66,30 +66,27 @@ describe('AdxDataSource', () => {
 
   describe('when performing getSchema', () => {
     const response = {
-      Tables: [
-        {
-          TableName: 'Table_0',
-          Columns: [
-            {
-              ColumnName: 'DatabaseSchema',
-              DataType: 'String',
+      Databases: {
+        Grafana: {
+          Name: 'Grafana',
+          Tables: {
+            MyLogs: {
+              Name: 'MyLogs',
+              OrderedColumns: [
+                { Name: 'Level', Type: 'System.String', CslType: 'string' },
+                { Name: 'Timestamp', Type: 'System.DateTime', CslType: 'datetime' },
+                { Name: 'UserId', Type: 'System.String', CslType: 'string' },
+                { Name: 'TraceId', Type: 'System.String', CslType: 'string' },
+                { Name: 'Message', Type: 'System.String', CslType: 'string' },
+                { Name: 'ProcessId', Type: 'System.Int32', CslType: 'int' },
+              ],
             },
-          ],
-          Rows: [
-            [
-              '{"Plugins":[{"Name":"preview"},{"Name":"pivot"}],' +
-                '"Databases":{"Grafana":{"Name":"Grafana","Tables":{"MyLogs":{"Name":"MyLogs",' +
-                '"OrderedColumns":[{"Name":"Level","Type":"System.String","CslType":"string"},' +
-                '{"Name":"Timestamp","Type":"System.DateTime","CslType":"datetime"},' +
-                '{"Name":"UserId","Type":"System.String","CslType":"string"},' +
-                '{"Name":"TraceId","Type":"System.String","CslType":"string"},' +
-                '{"Name":"Message","Type":"System.String","CslType":"string"},' +
-                '{"Name":"ProcessId","Type":"System.Int32","CslType":"int"}]}},' +
-                '"MajorVersion":5,"MinorVersion":3,"Functions":{},"DatabaseAccessMode":"ReadWrite"}}}',
-            ],
-          ],
+          },
+          ExternalTables: {},
+          MaterializedViews: {},
+          Functions: {},
         },
-      ],
+      },
     };
 
     beforeEach(() => {
@@ -294,47 +291,6 @@ describe('sortStartsWithValuesFirst', () => {
   });
 });
 
-function setupTableResponse() {
-  return {
-    Tables: [
-      {
-        TableName: 'Table_0',
-        Columns: [
-          { ColumnName: 'DatabaseName', DataType: 'String' },
-          { ColumnName: 'PersistentStorage', DataType: 'String' },
-          { ColumnName: 'Version', DataType: 'String' },
-          { ColumnName: 'IsCurrent', DataType: 'Boolean' },
-          { ColumnName: 'DatabaseAccessMode', DataType: 'String' },
-          { ColumnName: 'PrettyName', DataType: 'String' },
-          {
-            ColumnName: 'CurrentUserIsUnrestrictedViewer',
-            DataType: 'Boolean',
-          },
-          { ColumnName: 'DatabaseId', DataType: 'Guid' },
-        ],
-        Rows: [
-          [
-            'Grafana',
-            'https://4bukustoragekus86a3c.blob.core.windows.net/grafanamd201806201624130602',
-            'v5.2',
-            false,
-            'ReadWrite',
-            null,
-            false,
-            '1955a3ed-0668-4d00-a2e5-9c4e610ef057',
-          ],
-          [
-            'Sample',
-            'https://4bukustoragekus86a3c.blob.core.windows.net/grafanamd201806201624130602',
-            'v5.2',
-            false,
-            'ReadWrite',
-            null,
-            false,
-            '2955a3ed-0668-4d00-a2e5-9c4e610ef057',
-          ],
-        ],
-      },
-    ],
-  };
+function setupDatabasesResponse() {
+  return [{ name: 'Grafana' }, { name: 'Sample', prettyName: 'Samples' }];
 }
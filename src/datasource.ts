@@ -1,12 +1,21 @@
 import {
   DataFrame,
   DataQueryRequest,
+  DataQueryResponse,
   DataSourceInstanceSettings,
+  LiveChannelScope,
   QueryFixAction,
   ScopedVars,
   TimeRange,
 } from '@grafana/data';
-import { BackendSrv, DataSourceWithBackend, getBackendSrv, getTemplateSrv, TemplateSrv } from '@grafana/runtime';
+import {
+  BackendSrv,
+  DataSourceWithBackend,
+  getBackendSrv,
+  getGrafanaLiveSrv,
+  getTemplateSrv,
+  TemplateSrv,
+} from '@grafana/runtime';
 import { escapeColumn, KustoExpressionParser } from 'KustoExpressionParser';
 import { map } from 'lodash';
 import { AdxSchemaMapper } from 'schema/AdxSchemaMapper';
@@ -17,7 +26,7 @@ import { QueryEditorPropertyType } from './schema/types';
 import { VariableSupport } from 'variables';
 import { migrateAnnotation } from './migrations/annotation';
 import interpolateKustoQuery from './query_builder';
-import { DatabaseItem, KustoDatabaseList, ResponseParser } from './response_parser';
+import { DatabaseItem, ResponseParser } from './response_parser';
 import {
   AdxColumnSchema,
   AdxDataSourceOptions,
@@ -25,14 +34,16 @@ import {
   AdxSchemaDefinition,
   AutoCompleteQuery,
   ClusterOption,
+  DatabaseOption,
   defaultQuery,
   EditorMode,
   KustoQuery,
+  QueryDiagnostic,
   QueryExpression,
 } from './types';
 
 import { createOperator } from 'components/QueryEditor/VisualQueryEditor/utils/utils';
-import { lastValueFrom } from 'rxjs';
+import { from, lastValueFrom, merge, mergeMap, Observable } from 'rxjs';
 import {
   QueryEditorExpressionType,
   QueryEditorOperatorExpression,
@@ -99,6 +110,39 @@ export class AdxDataSource extends DataSourceWithBackend<KustoQuery, AdxDataSour
     return true;
   }
 
+  query(request: DataQueryRequest<KustoQuery>): Observable<DataQueryResponse> {
+    const timezone = resolveTimezone(request.timezone);
+    request = { ...request, targets: request.targets.map((target) => ({ ...target, timezone })) };
+    const live = request.targets.filter((target) => target.live && this.filterQuery(target));
+    if (!live.length) {
+      return super.query(request);
+    }
+
+    const streams = live.map((target) => {
+      const query = this.applyTemplateVariables(target, request.scopedVars);
+      // the backend names the channel after the query and the user, so only the same query run as
+      // the same user shares a stream
+      return from(this.postResource<{ path: string }>('streamPath', query)).pipe(
+        mergeMap(({ path }) =>
+          getGrafanaLiveSrv().getDataStream({
+            key: `${request.requestId}.${target.refId}`,
+            addr: {
+              scope: LiveChannelScope.DataSource,
+              namespace: this.uid,
+              path,
+              data: { ...query, liveFrom: request.range.from.valueOf() },
+            },
+          })
+        )
+      );
+    });
+    const rest = request.targets.filter((target) => !target.live);
+    if (rest.length) {
+      streams.push(super.query({ ...request, targets: rest }));
+    }
+    return merge(...streams);
+  }
+
   applyTemplateVariables(target: KustoQuery, scopedVars: ScopedVars): KustoQuery {
     const query = interpolateKustoQuery(
       target.query,
@@ -111,6 +155,7 @@ export class AdxDataSource extends DataSourceWithBackend<KustoQuery, AdxDataSour
       query,
       clusterUri: this.templateSrv.replace(target.clusterUri, scopedVars),
       database: this.templateSrv.replace(target.database, scopedVars),
+      alias: target.alias && this.templateSrv.replace(target.alias, scopedVars),
     };
   }
 
@@ -124,7 +169,7 @@ export class AdxDataSource extends DataSourceWithBackend<KustoQuery, AdxDataSour
     }
     const replacedClusterUri = this.templateSrv.replace(clusterUri, this.templateSrv.getVariables() as any);
 
-    return this.postResource<KustoDatabaseList>('databases', { clusterUri: replacedClusterUri }).then((response) => {
+    return this.postResource<DatabaseOption[]>('databases', { clusterUri: replacedClusterUri }).then((response) => {
       return new ResponseParser().parseDatabases(response);
     });
   }
@@ -135,6 +180,16 @@ export class AdxDataSource extends DataSourceWithBackend<KustoQuery, AdxDataSour
     });
   }
 
+  // validateQuery reports the problems of a query as it is written in the editor, so the positions of
+  // the diagnostics are positions in the editor.
+  async validateQuery(query: string, database: string, clusterUri: string): Promise<QueryDiagnostic[]> {
+    return this.postResource<{ diagnostics: QueryDiagnostic[] }>('validate', {
+      query,
+      database: this.templateSrv.replace(database, this.templateSrv.getVariables() as any),
+      clusterUri: this.templateSrv.replace(clusterUri, this.templateSrv.getVariables() as any),
+    }).then((response) => response.diagnostics);
+  }
+
   getClusters(): Promise<ClusterOption[]> {
     return this.getResource('clusters');
   }
@@ -177,9 +232,11 @@ export class AdxDataSource extends DataSourceWithBackend<KustoQuery, AdxDataSour
     return cache<AdxSchema>(
       `${this.id}.${replacedClusterUri}.${replacedDatabase}.schema.overview`,
       () =>
-        this.postResource(`schema`, { clusterUri: replacedClusterUri, database: replacedDatabase }).then(
-          new ResponseParser().parseSchemaResult
-        ),
+        this.postResource<AdxSchema>(`schema`, {
+          clusterUri: replacedClusterUri,
+          database: replacedDatabase,
+          refresh: refreshCache,
+        }),
       refreshCache
     );
   }
@@ -580,3 +637,11 @@ export const sortStartsWithValuesFirst = (arr: string[], searchText: string) =>
 
   return arr;
 };
+
+// resolveTimezone returns the IANA timezone of a dashboard timezone, which $__timeBinTz bins in.
+export function resolveTimezone(timezone: string | undefined): string {
+  if (!timezone || timezone === 'browser') {
+    return Intl.DateTimeFormat().resolvedOptions().timeZone;
+  }
+  return timezone === 'utc' ? 'UTC' : timezone;
+}
@@ -1,5 +1,5 @@
-import { ClusterOption } from 'types';
-import { KustoDatabaseList, ResponseParser, parseClustersResponse } from './response_parser';
+import { ClusterOption, DatabaseOption } from 'types';
+import { ResponseParser, parseClustersResponse } from './response_parser';
 
 describe('ResponseParser', () => {
   let parser: ResponseParser;
@@ -9,20 +9,12 @@ describe('ResponseParser', () => {
   });
 
   describe('parseDatabases', () => {
-    it('should parse database list with full row data', () => {
-      const mockResults: KustoDatabaseList = {
-        Tables: [
-          {
-            TableName: 'Table_0',
-            Columns: [],
-            Rows: [
-              ['db1', 'field1', 'field2', 'field3', 'field4', 'Database One'],
-              ['db2', 'field1', 'field2', 'field3', 'field4', 'Database Two'],
-              ['db3', 'field1', 'field2', 'field3', 'field4', 'Database Three'],
-            ],
-          },
-        ],
-      };
+    it('should use the pretty names of the databases as text', () => {
+      const mockResults: DatabaseOption[] = [
+        { name: 'db1', prettyName: 'Database One' },
+        { name: 'db2', prettyName: 'Database Two' },
+        { name: 'db3', prettyName: 'Database Three' },
+      ];
 
       const result = parser.parseDatabases(mockResults);
 
@@ -33,51 +25,14 @@ describe('ResponseParser', () => {
       ]);
     });
 
-    it('should use first column as text when sixth column is empty', () => {
-      const mockResults: KustoDatabaseList = {
-        Tables: [
-          {
-            TableName: 'Table_0',
-            Columns: [],
-            Rows: [
-              ['db1', 'field1', 'field2', 'field3', 'field4', ''],
-              ['db2', 'field1', 'field2', 'field3', 'field4', null],
-              ['db3', 'field1', 'field2', 'field3', 'field4', undefined],
-            ],
-          },
-        ],
-      };
+    it('should use the name as text when there is no pretty name', () => {
+      const mockResults: DatabaseOption[] = [{ name: 'db1', prettyName: '' }, { name: 'db2' }];
 
       const result = parser.parseDatabases(mockResults);
 
       expect(result).toEqual([
         { text: 'db1', value: 'db1' },
         { text: 'db2', value: 'db2' },
-        { text: 'db3', value: 'db3' },
-      ]);
-    });
-
-    it('should handle multiple tables', () => {
-      const mockResults: KustoDatabaseList = {
-        Tables: [
-          {
-            TableName: 'Table_0',
-            Columns: [],
-            Rows: [['db1', 'field1', 'field2', 'field3', 'field4', 'Database One']],
-          },
-          {
-            TableName: 'Table_1',
-            Columns: [],
-            Rows: [['db2', 'field1', 'field2', 'field3', 'field4', 'Database Two']],
-          },
-        ],
-      };
-
-      const result = parser.parseDatabases(mockResults);
-
-      expect(result).toEqual([
-        { text: 'Database One', value: 'db1' },
-        { text: 'Database Two', value: 'db2' },
       ]);
     });
 
@@ -86,27 +41,8 @@ describe('ResponseParser', () => {
       expect(result).toEqual([]);
     });
 
-    it('should handle empty tables array', () => {
-      const mockResults: KustoDatabaseList = {
-        Tables: [],
-      };
-
-      const result = parser.parseDatabases(mockResults);
-      expect(result).toEqual([]);
-    });
-
-    it('should handle tables with empty rows', () => {
-      const mockResults: KustoDatabaseList = {
-        Tables: [
-          {
-            TableName: 'Table_0',
-            Columns: [],
-            Rows: [],
-          },
-        ],
-      };
-
-      const result = parser.parseDatabases(mockResults);
+    it('should handle an empty list', () => {
+      const result = parser.parseDatabases([]);
       expect(result).toEqual([]);
     });
   });
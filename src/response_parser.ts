@@ -1,5 +1,5 @@
 import { SelectableValue } from '@grafana/data';
-import { AdxSchema, ClusterOption } from 'types';
+import { ClusterOption, DatabaseOption } from 'types';
 
 export interface DataTarget {
   target: string;
@@ -27,16 +27,6 @@ export interface Variable {
 }
 
 // API interfaces
-export interface KustoDatabaseList {
-  Tables: KustoDatabaseItem[];
-}
-
-export interface KustoDatabaseItem {
-  TableName: string;
-  Columns: any[];
-  Rows: any[];
-}
-
 export interface KustoDatabase {
   Name: string;
   Tables: { [key: string]: KustoTable };
@@ -70,24 +60,11 @@ export interface DatabaseItem {
 }
 
 export class ResponseParser {
-  parseDatabases(results: KustoDatabaseList): DatabaseItem[] {
-    const databases: DatabaseItem[] = [];
+  parseDatabases(results: DatabaseOption[]): DatabaseItem[] {
     if (!results) {
-      return databases;
+      return [];
     }
-
-    for (const table of results.Tables) {
-      for (const row of table.Rows) {
-        databases.push({ text: row[5] || row[0], value: row[0] });
-      }
-    }
-
-    return databases;
-  }
-
-  parseSchemaResult(results: any) {
-    const schemaJson = results.Tables[0].Rows[0][0];
-    return JSON.parse(schemaJson) as AdxSchema;
+    return results.map((db) => ({ text: db.prettyName || db.name, value: db.name }));
   }
 
   parseOpenAIResponse(results: any) {
@@ -23,6 +23,11 @@ export interface QueryExpression {
   timeshift?: QueryEditorPropertyExpression;
 }
 
+export interface KustoQueryParameter {
+  type: 'string' | 'datetime' | 'long' | 'real' | 'dynamic' | 'timespan';
+  value: unknown;
+}
+
 type QuerySource = 'raw' | 'schema' | 'autocomplete' | 'visual' | 'openai';
 export interface KustoQuery extends DataQuery {
   query: string;
@@ -37,6 +42,17 @@ export interface KustoQuery extends DataQuery {
   queryType: AdxQueryType;
   table?: string;
   OpenAI?: boolean;
+  allResultTables?: boolean;
+  truncationMaxRecords?: number;
+  truncationMaxSize?: number;
+  clientRequestProperties?: Record<string, string | number | boolean>;
+  parameters?: Record<string, KustoQueryParameter>;
+  // run the query as a live stream that only returns new rows
+  live?: boolean;
+  liveIntervalMs?: number;
+  liveTimeColumn?: string;
+  // IANA timezone of the dashboard, set when the query runs
+  timezone?: string;
 }
 
 export interface AutoCompleteQuery {
@@ -66,6 +82,11 @@ export interface ClusterOption {
   uri: string;
 }
 
+export interface DatabaseOption {
+  name: string;
+  prettyName?: string;
+}
+
 export const defaultQuery: Pick<KustoQuery, 'query' | 'expression' | 'querySource' | 'pluginVersion' | 'queryType'> = {
   query: '',
   querySource: EditorMode.Raw,
@@ -118,9 +139,16 @@ export interface AdxDataSourceOptions extends AzureDataSourceJsonData {
   dataConsistency: string;
   cacheMaxAge: string;
   dynamicCaching: boolean;
+  maxConcurrentQueries?: number;
+  partialResultsAsErrors?: boolean;
+  queryCacheSize?: number;
+  schemaCacheTTL?: string;
+  truncationMaxRecords?: number;
+  truncationMaxSize?: number;
   useSchemaMapping: boolean;
   schemaMappings?: Array<Partial<SchemaMapping>>;
   enableUserTracking: boolean;
+  auditLog?: boolean;
   clusterUrl: string;
   application: string;
   enableSecureSocksProxy?: boolean;
@@ -148,6 +176,8 @@ export interface AdxDatabaseSchema {
 
 export interface AdxTableSchema {
   Name: string;
+  Folder?: string;
+  DocString?: string;
   OrderedColumns: AdxColumnSchema[];
 }
 
@@ -156,6 +186,7 @@ export interface AdxColumnSchema {
   CslType: string;
   Type?: string;
   CslDefaultValue?: string;
+  DocString?: string;
   isDynamic?: boolean;
 }
 
@@ -165,11 +196,38 @@ export interface AdxFunctionSchema {
   Name: string;
   InputParameters: AdxFunctionInputParameterSchema[];
   OutputColumns: AdxColumnSchema[];
+  Folder?: string;
   DocString?: string;
 }
 
 export interface AdxFunctionInputParameterSchema extends AdxColumnSchema {}
 
+export interface KustoErrorDetails {
+  statusCode: number;
+  status: string;
+  code?: string;
+  errorCode?: string;
+  type?: string;
+  message: string;
+  permanent: boolean;
+  // line is 1-based and position is 0-based, both are missing when the error has no position
+  line?: number;
+  position?: number;
+  token?: string;
+  clientRequestId?: string;
+  activityId?: string;
+  causes?: Array<{ code?: string; type?: string; message: string }>;
+}
+
+export interface QueryDiagnostic {
+  severity: 'error' | 'warning';
+  message: string;
+  line: number;
+  column: number;
+  offset: number;
+  length: number;
+}
+
 export type AdxSchemaDefinition = string | AdxSchemaDefinition[] | { [k: string]: AdxSchemaDefinition };
 
 export enum FormatOptions {